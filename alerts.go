@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertConfig is the configuration of one alert rule, from an
+// [alert "name"] section in the configuration file.
+type AlertConfig struct {
+	Type      string
+	Threshold float64
+	Ratio     float64
+	For       string
+	Group     string
+	Severity  string
+}
+
+// AlertState is the state of an alert.
+type AlertState string
+
+const (
+	AlertPending  AlertState = "pending"
+	AlertFiring   AlertState = "firing"
+	AlertResolved AlertState = "resolved"
+)
+
+// Alert is an instance of a rule being triggered for a subject (a
+// server IP or a group name).
+type Alert struct {
+	Rule       string     `json:"rule"`
+	Type       string     `json:"type"`
+	Severity   string     `json:"severity"`
+	Subject    string     `json:"subject"`
+	Name       string     `json:"name"`
+	State      AlertState `json:"state"`
+	Message    string     `json:"message"`
+	Value      float64    `json:"value"`
+	ActiveAt   time.Time  `json:"active_at"`
+	FiredAt    time.Time  `json:"fired_at"`
+	ResolvedAt time.Time  `json:"resolved_at"`
+}
+
+func (a *Alert) key() string {
+	return a.Rule + "/" + a.Subject
+}
+
+// AlertRule is a parsed alert rule.
+type AlertRule struct {
+	Name      string
+	Type      string
+	Threshold float64
+	Ratio     float64
+	For       time.Duration
+	Group     string
+	Severity  string
+}
+
+var alertDefaultThresholds = map[string]float64{
+	"stale":     30,
+	"lowqps":    0,
+	"restart":   300,
+	"version":   0,
+	"discovery": 1,
+}
+
+// alertRulesFromConfig builds the rules from the [alert] sections.
+func alertRulesFromConfig(cfg map[string]*AlertConfig) ([]*AlertRule, error) {
+	rules := []*AlertRule{}
+	for name, ac := range cfg {
+		def, ok := alertDefaultThresholds[ac.Type]
+		if !ok {
+			return nil, fmt.Errorf("alert '%s': unknown type '%s'", name, ac.Type)
+		}
+		rule := &AlertRule{
+			Name:      name,
+			Type:      ac.Type,
+			Threshold: ac.Threshold,
+			Ratio:     ac.Ratio,
+			Group:     ac.Group,
+			Severity:  ac.Severity,
+		}
+		if rule.Threshold == 0 {
+			rule.Threshold = def
+		}
+		if len(rule.Severity) == 0 {
+			rule.Severity = "warning"
+		}
+		if len(ac.For) > 0 {
+			d, err := time.ParseDuration(ac.For)
+			if err != nil {
+				return nil, fmt.Errorf("alert '%s': invalid 'for': %s", name, err)
+			}
+			rule.For = d
+		}
+		if rule.Type == "lowqps" && rule.Threshold <= 0 && rule.Ratio <= 0 {
+			return nil, fmt.Errorf("alert '%s': lowqps needs a threshold or a ratio", name)
+		}
+		rules = append(rules, rule)
+	}
+	sort.Sort(alertRulesByName(rules))
+	return rules, nil
+}
+
+type alertRulesByName []*AlertRule
+
+func (s alertRulesByName) Len() int           { return len(s) }
+func (s alertRulesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s alertRulesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (r *AlertRule) matches(st *Status) bool {
+	if len(r.Group) == 0 {
+		return true
+	}
+	for _, g := range st.Groups {
+		if g == r.Group {
+			return true
+		}
+	}
+	return false
+}
+
+// alertCondition is a rule being true for a subject at evaluation time.
+type alertCondition struct {
+	rule    *AlertRule
+	subject string
+	name    string
+	message string
+	value   float64
+}
+
+// AlertEngine evaluates the alert rules against the hub's status and
+// keeps track of the state of each alert.
+type AlertEngine struct {
+	sync.RWMutex
+	rules    []*AlertRule
+	active   map[string]*Alert
+	resolved []*Alert
+
+	discovery *DiscoveryTracker
+
+	handlers []func(Alert)
+
+	running  bool
+	quit     chan bool
+	quitOnce sync.Once
+	done     chan bool
+}
+
+// alertInterval is how often the alert rules are evaluated.
+const alertInterval = 5 * time.Second
+
+// maxResolvedAlerts is how many resolved alerts are kept for the API.
+const maxResolvedAlerts = 100
+
+func NewAlertEngine(rules []*AlertRule) *AlertEngine {
+	return &AlertEngine{
+		rules:  rules,
+		active: make(map[string]*Alert),
+		quit:   make(chan bool),
+		done:   make(chan bool),
+	}
+}
+
+// SetRules replaces the rules. Alerts for rules that no longer
+// exist are dropped.
+func (e *AlertEngine) SetRules(rules []*AlertRule) {
+	e.Lock()
+	defer e.Unlock()
+	e.rules = rules
+	names := make(map[string]bool)
+	for _, rule := range rules {
+		names[rule.Name] = true
+	}
+	for key, alert := range e.active {
+		if !names[alert.Rule] {
+			delete(e.active, key)
+		}
+	}
+}
+
+// SetDiscovery makes the discovery results available to the
+// discovery rules.
+func (e *AlertEngine) SetDiscovery(dt *DiscoveryTracker) {
+	e.Lock()
+	defer e.Unlock()
+	e.discovery = dt
+}
+
+// OnTransition registers a function to be called (synchronously)
+// whenever an alert starts firing or is resolved.
+func (e *AlertEngine) OnTransition(fn func(Alert)) {
+	e.Lock()
+	defer e.Unlock()
+	e.handlers = append(e.handlers, fn)
+}
+
+// Run evaluates the rules against the hub every interval until the
+// engine is stopped.
+func (e *AlertEngine) Run(hub *StatusHub, interval time.Duration) {
+	e.Lock()
+	e.running = true
+	e.Unlock()
+	defer close(e.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.Evaluate(hub.Status(), time.Now())
+		case <-e.quit:
+			return
+		}
+	}
+}
+
+// Stop stops the evaluation loop, so servers disappearing during
+// shutdown don't resolve their alerts.
+func (e *AlertEngine) Stop() {
+	e.RLock()
+	running := e.running
+	e.RUnlock()
+	e.quitOnce.Do(func() { close(e.quit) })
+	if running {
+		<-e.done
+	}
+}
+
+// Active returns the pending and firing alerts.
+func (e *AlertEngine) Active() []Alert {
+	e.RLock()
+	defer e.RUnlock()
+	rv := []Alert{}
+	for _, alert := range e.active {
+		rv = append(rv, *alert)
+	}
+	sort.Sort(alertsByKey(rv))
+	return rv
+}
+
+// Resolved returns the most recently resolved alerts, newest first.
+func (e *AlertEngine) Resolved() []Alert {
+	e.RLock()
+	defer e.RUnlock()
+	rv := make([]Alert, 0, len(e.resolved))
+	for i := len(e.resolved) - 1; i >= 0; i-- {
+		rv = append(rv, *e.resolved[i])
+	}
+	return rv
+}
+
+type alertsByKey []Alert
+
+func (s alertsByKey) Len() int           { return len(s) }
+func (s alertsByKey) Less(i, j int) bool { return s[i].key() < s[j].key() }
+func (s alertsByKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Evaluate checks all rules and updates the alert states. It returns
+// the alerts that started firing or were resolved.
+func (e *AlertEngine) Evaluate(statuses []*Status, now time.Time) []Alert {
+	e.Lock()
+
+	conditions := make(map[string]*alertCondition)
+	for _, rule := range e.rules {
+		for _, cond := range e.check(rule, statuses, now) {
+			conditions[rule.Name+"/"+cond.subject] = cond
+		}
+	}
+
+	transitions := []Alert{}
+
+	for key, cond := range conditions {
+		alert, ok := e.active[key]
+		if !ok {
+			alert = &Alert{
+				Rule:     cond.rule.Name,
+				Type:     cond.rule.Type,
+				Severity: cond.rule.Severity,
+				Subject:  cond.subject,
+				State:    AlertPending,
+				ActiveAt: now,
+			}
+			e.active[key] = alert
+		}
+		alert.Name = cond.name
+		alert.Message = cond.message
+		alert.Value = cond.value
+
+		if alert.State == AlertPending && now.Sub(alert.ActiveAt) >= cond.rule.For {
+			alert.State = AlertFiring
+			alert.FiredAt = now
+			transitions = append(transitions, *alert)
+		}
+	}
+
+	for key, alert := range e.active {
+		if _, ok := conditions[key]; ok {
+			continue
+		}
+		delete(e.active, key)
+		if alert.State != AlertFiring {
+			continue
+		}
+		alert.State = AlertResolved
+		alert.ResolvedAt = now
+		transitions = append(transitions, *alert)
+		e.resolved = append(e.resolved, alert)
+		if len(e.resolved) > maxResolvedAlerts {
+			e.resolved = e.resolved[len(e.resolved)-maxResolvedAlerts:]
+		}
+	}
+
+	handlers := e.handlers
+	e.Unlock()
+
+	sort.Sort(alertsByKey(transitions))
+	for _, alert := range transitions {
+		log.Printf("Alert %s for %s (%s): %s", alert.State, alert.Subject, alert.Rule, alert.Message)
+		for _, fn := range handlers {
+			fn(alert)
+		}
+	}
+
+	return transitions
+}
+
+func (e *AlertEngine) check(rule *AlertRule, statuses []*Status, now time.Time) []*alertCondition {
+	rv := []*alertCondition{}
+
+	add := func(subject, name, message string, value float64) {
+		rv = append(rv, &alertCondition{rule, subject, name, message, value})
+	}
+
+	switch rule.Type {
+
+	case "stale":
+		for _, st := range statuses {
+			if !rule.matches(st) {
+				continue
+			}
+			if st.LastStatusUpdate.IsZero() {
+				add(st.IP, st.Name, "no status received", 0)
+				continue
+			}
+			age := now.Sub(st.LastStatusUpdate).Seconds()
+			if age > rule.Threshold {
+				add(st.IP, st.Name, fmt.Sprintf("last update %.0f seconds ago", age), age)
+			}
+		}
+
+	case "lowqps":
+		threshold := rule.Threshold
+		if rule.Ratio > 0 {
+			qps := []float64{}
+			for _, st := range statuses {
+				if rule.matches(st) && !st.LastStatusUpdate.IsZero() {
+					qps = append(qps, st.Qps1)
+				}
+			}
+			if len(qps) == 0 {
+				break
+			}
+			threshold = percentile(qps, 0.5) * rule.Ratio
+		}
+		for _, st := range statuses {
+			if !rule.matches(st) || st.LastStatusUpdate.IsZero() {
+				continue
+			}
+			if st.Qps1 < threshold {
+				add(st.IP, st.Name, fmt.Sprintf("%.1f qps is below %.1f", st.Qps1, threshold), st.Qps1)
+			}
+		}
+
+	case "restart":
+		for _, st := range statuses {
+			if !rule.matches(st) {
+				continue
+			}
+			if st.LastRestart == nil {
+				continue
+			}
+			ago := now.Sub(*st.LastRestart)
+			if ago.Seconds() > rule.Threshold {
+				continue
+			}
+			add(st.IP, st.Name, fmt.Sprintf("restarted %s ago", DayDuration{ago}.DayString()), float64(st.Restarts))
+		}
+
+	case "version":
+		groups := make(map[string]map[string][]string)
+		for _, st := range statuses {
+			if !rule.matches(st) || len(st.Version) == 0 {
+				continue
+			}
+			for _, g := range st.Groups {
+				if len(rule.Group) > 0 && g != rule.Group {
+					continue
+				}
+				if groups[g] == nil {
+					groups[g] = make(map[string][]string)
+				}
+				groups[g][st.Version] = append(groups[g][st.Version], st.IP)
+			}
+		}
+		for group, versions := range groups {
+			if len(versions) < 2 {
+				continue
+			}
+			vs := []string{}
+			for v, ips := range versions {
+				sort.Strings(ips)
+				vs = append(vs, fmt.Sprintf("%s (%s)", v, strings.Join(ips, ", ")))
+			}
+			sort.Strings(vs)
+			add(group, group, "versions differ: "+strings.Join(vs, "; "), float64(len(versions)))
+		}
+
+	case "discovery":
+		if e.discovery == nil {
+			break
+		}
+		for _, src := range e.discovery.Status().Sources {
+			if src.OK || float64(src.ConsecutiveFailures) < rule.Threshold {
+				continue
+			}
+			reason := src.Error
+			if len(reason) == 0 {
+				reason = "could not add " + strings.Join(src.Failures, "; ")
+			}
+			add(src.Config, src.Config, fmt.Sprintf("failed %d times: %s", src.ConsecutiveFailures, reason), float64(src.ConsecutiveFailures))
+		}
+	}
+
+	return rv
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type AlertSuite struct {
+}
+
+var _ = Suite(&AlertSuite{})
+
+func (s *AlertSuite) TestConfig(c *C) {
+	_, err := alertRulesFromConfig(map[string]*AlertConfig{
+		"x": {Type: "nope"},
+	})
+	c.Check(err, ErrorMatches, "alert 'x': unknown type 'nope'")
+
+	_, err = alertRulesFromConfig(map[string]*AlertConfig{
+		"x": {Type: "lowqps"},
+	})
+	c.Check(err, ErrorMatches, ".*needs a threshold or a ratio")
+
+	rules, err := alertRulesFromConfig(map[string]*AlertConfig{
+		"b": {Type: "stale", For: "10s"},
+		"a": {Type: "restart"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(rules, HasLen, 2)
+	c.Check(rules[0].Name, Equals, "a")
+	c.Check(rules[0].Threshold, Equals, float64(300))
+	c.Check(rules[1].For, Equals, 10*time.Second)
+	c.Check(rules[1].Severity, Equals, "warning")
+}
+
+func (s *AlertSuite) TestStale(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-stale", "up": 10})
+	ip, ep := fm.Endpoint()
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetConnectionSettings(&ConnectionSettings{
+		DialTimeout:      time.Second,
+		HandshakeTimeout: time.Second,
+		ReadTimeout:      time.Second,
+		MinBackoff:       50 * time.Millisecond,
+		MaxBackoff:       100 * time.Millisecond,
+	})
+	c.Assert(hub.AddNameEndpoint(ip.String(), ep), IsNil)
+	waitStatus(c, hub, func(st *Status) bool { return st.Uptime > 0 })
+
+	rules, _ := alertRulesFromConfig(map[string]*AlertConfig{
+		"stale": {Type: "stale", Threshold: 1, For: "500ms"},
+	})
+	e := NewAlertEngine(rules)
+	transitions := []Alert{}
+	e.OnTransition(func(a Alert) { transitions = append(transitions, a) })
+
+	c.Check(e.Evaluate(hub.Status(), time.Now()), HasLen, 0)
+	c.Check(e.Active(), HasLen, 0)
+
+	// the port is closed now; the connection keeps failing
+	fm.Close()
+	waitState(c, hub, StateBackoff)
+	start := time.Now()
+	for len(transitions) == 0 && time.Since(start) < 5*time.Second {
+		e.Evaluate(hub.Status(), time.Now())
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Assert(transitions, HasLen, 1)
+	c.Check(transitions[0].State, Equals, AlertFiring)
+	c.Check(transitions[0].Subject, Equals, ip.String())
+	c.Check(transitions[0].Message, Matches, "last update [0-9]+ seconds ago")
+
+	// firing alerts are only announced once
+	e.Evaluate(hub.Status(), time.Now())
+	c.Check(transitions, HasLen, 1)
+
+	// resolved when the server is heard from again
+	st := hub.Status()[0].clone()
+	st.LastStatusUpdate = time.Now()
+	e.Evaluate([]*Status{st}, time.Now())
+	c.Assert(transitions, HasLen, 2)
+	c.Check(transitions[1].State, Equals, AlertResolved)
+	c.Check(e.Active(), HasLen, 0)
+	c.Check(e.Resolved(), HasLen, 1)
+}
+
+func (s *AlertSuite) TestRules(c *C) {
+	now := time.Now()
+	rules, _ := alertRulesFromConfig(map[string]*AlertConfig{
+		"qps":     {Type: "lowqps", Ratio: 0.5, Group: "edge"},
+		"restart": {Type: "restart"},
+		"version": {Type: "version"},
+	})
+	e := NewAlertEngine(rules)
+
+	statuses := []*Status{
+		{IP: "192.0.2.1", Groups: []string{"edge"}, Version: "2.4.1", Qps1: 100, Uptime: 1000, LastStatusUpdate: now},
+		{IP: "192.0.2.2", Groups: []string{"edge"}, Version: "2.4.1", Qps1: 110, Uptime: 1000, LastStatusUpdate: now},
+		{IP: "192.0.2.3", Groups: []string{"edge"}, Version: "2.4.0", Qps1: 20, Uptime: 1000, LastStatusUpdate: now},
+		{IP: "192.0.2.4", Groups: []string{"core"}, Version: "2.4.0", Qps1: 1, Uptime: 1000, LastStatusUpdate: now},
+	}
+
+	transitions := e.Evaluate(statuses, now)
+	c.Assert(transitions, HasLen, 2)
+	c.Check(transitions[0].Rule, Equals, "qps")
+	c.Check(transitions[0].Subject, Equals, "192.0.2.3")
+	c.Check(transitions[1].Rule, Equals, "version")
+	c.Check(transitions[1].Subject, Equals, "edge")
+	c.Check(transitions[1].Message, Equals, "versions differ: 2.4.0 (192.0.2.3); 2.4.1 (192.0.2.1, 192.0.2.2)")
+
+	restarted := now.Add(2 * time.Second)
+	statuses[3].Uptime = 3
+	statuses[3].Restarts = 1
+	statuses[3].LastRestart = &restarted
+	transitions = e.Evaluate(statuses, now.Add(5*time.Second))
+	c.Assert(transitions, HasLen, 1)
+	c.Check(transitions[0].Rule, Equals, "restart")
+	c.Check(transitions[0].Subject, Equals, "192.0.2.4")
+	c.Check(transitions[0].Message, Equals, "restarted 3s ago")
+
+	statuses[3].Uptime = 400
+	transitions = e.Evaluate(statuses, now.Add(400*time.Second))
+	c.Assert(transitions, HasLen, 1)
+	c.Check(transitions[0].State, Equals, AlertResolved)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultPollInterval is how often HTTP endpoints are polled if the
+// configuration doesn't say.
+const defaultPollInterval = 5 * time.Second
+
+// Collector gets status updates from a server over one protocol.
+type Collector interface {
+	// Collect sends the updates from the server to the hub until
+	// the connection fails or sc is stopped, calling sc.streaming
+	// for each. It returns nil if it was stopped.
+	Collect(sc *ServerConnection) error
+	String() string
+}
+
+// newCollector returns a collector for the endpoint's protocol.
+func newCollector(ep Endpoint) Collector {
+	if ep.Protocol == "http" {
+		return &httpCollector{}
+	}
+	return &websocketCollector{}
+}
+
+// parseProtocol parses the protocol setting or the scheme of a
+// server entry. The websocket is "".
+func parseProtocol(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "ws", "websocket":
+		return "", nil
+	case "http":
+		return "http", nil
+	}
+	return "", fmt.Errorf("invalid protocol '%s', expected websocket or http", s)
+}
+
+// defaultPath returns the usual path of the endpoint for the
+// protocol.
+func defaultPath(protocol string) string {
+	if protocol == "http" {
+		return "/status"
+	}
+	return defaultEndpoint.Path
+}
+
+// websocketCollector follows the /monitor websocket, which sends an
+// update every second or so.
+type websocketCollector struct{}
+
+func (wc *websocketCollector) String() string { return "websocket" }
+
+func (wc *websocketCollector) Collect(sc *ServerConnection) error {
+	cs := sc.connection.Settings()
+	conn, err := net.DialTimeout("tcp", sc.Endpoint.Address(sc.IP), cs.DialTimeout)
+	if err != nil {
+		return err
+	}
+	url, err := sc.Endpoint.URL(sc.IP)
+	if err != nil {
+		log.Println("Could not parse url", err)
+		conn.Close()
+		return fmt.Errorf("Invalid monitor path '%s'", sc.Endpoint.Path)
+	}
+	header := http.Header{}
+	header.Add("Origin", "http://monitor.pgeodns")
+	header.Add("Host", sc.IP.String())
+	header.Add("Set-WebSocket-Protocol", "chat")
+
+	sc.stateMsg(StateHandshaking, "")
+	conn.SetDeadline(time.Now().Add(cs.HandshakeTimeout))
+	ws, _, err := websocket.NewClient(conn, url, header, 1024, 1024)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Could not upgrade WS on '%s': %s", sc.IP, err)
+	}
+	conn.SetDeadline(time.Time{})
+	sc.sessions.connect()
+	err = wc.read(sc, ws, cs.ReadTimeout)
+	log.Println("server reader stopped")
+	cerr := conn.Close()
+	if cerr != nil && !sc.stopped() {
+		log.Printf("Error closing connection to %s: %s", sc.IP, cerr)
+	}
+	return err
+}
+
+func (wc *websocketCollector) read(sc *ServerConnection, ws *websocket.Conn, timeout time.Duration) error {
+
+	// log.Println("Response", resp)
+
+	status := new(ServerUpdate)
+	status.ConnID = sc.ConnID
+
+	// close the websocket properly when the connection is stopped,
+	// rather than waiting for the read deadline
+	readDone := make(chan bool)
+	closed := make(chan bool)
+	defer func() {
+		close(readDone)
+		<-closed
+	}()
+	go func() {
+		defer close(closed)
+		select {
+		case <-sc.quit:
+		case <-readDone:
+			if !sc.stopped() {
+				return
+			}
+		}
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "monitor stopping")
+		ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		ws.Close()
+	}()
+
+	for {
+
+		select {
+		case <-sc.quit:
+			log.Println("server reader got quit message")
+			return nil
+
+		default:
+
+			ws.SetReadDeadline(time.Now().Add(timeout))
+			op, r, err := ws.NextReader()
+			if err != nil {
+				if sc.stopped() {
+					log.Println("server reader got quit message")
+					return nil
+				}
+				return fmt.Errorf("Error reading from server: %s", err)
+			}
+			msg, err := ioutil.ReadAll(r)
+
+			// log.Println("op", op, "msg", string(msg), "err", err)
+
+			if op == websocket.TextMessage {
+				// the arbiter keeps the last update, so decode
+				// into a copy rather than changing it
+				update := *status
+				update.Groups = nil
+				err = json.Unmarshal(msg, &update)
+				if err != nil {
+					log.Printf("Unmarshall err from '%s': '%s', data: '%s'\n", sc.IP.String(), err, msg)
+				}
+				sc.sessions.message(len(msg), err != nil)
+				status = &update
+				// log.Printf("Got status: %#v\n", status)
+				sc.updateChan <- status
+				sc.streaming()
+			} else {
+				log.Println("op", op, "msg", string(msg), "err", err)
+			}
+
+			// os.Exit(0)
+		}
+	}
+}
+
+// httpCollector polls the /status JSON of servers that don't have
+// the websocket or where it's firewalled. The JSON has the same
+// fields as the websocket updates; the qps is worked out from the
+// query counts if it isn't there, and the uptime from the start time.
+type httpCollector struct {
+	lastQueries int64
+	lastPoll    time.Time
+}
+
+func (hc *httpCollector) String() string { return "http" }
+
+func (hc *httpCollector) Collect(sc *ServerConnection) error {
+	url, err := sc.Endpoint.URL(sc.IP)
+	if err != nil {
+		return fmt.Errorf("Invalid status path '%s'", sc.Endpoint.Path)
+	}
+	interval := sc.Endpoint.Interval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	// cancel a request in progress when the connection is stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-sc.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	cs := sc.connection.Settings()
+	transport := &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: cs.DialTimeout}).DialContext,
+		ResponseHeaderTimeout: cs.ReadTimeout,
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: cs.DialTimeout + cs.ReadTimeout}
+	hc.lastPoll = time.Time{}
+	connected := false
+	for {
+		update, size, err := hc.poll(ctx, client, url.String(), sc.ConnID)
+		if sc.stopped() {
+			return nil
+		}
+		if size > 0 {
+			if err == nil && !connected {
+				sc.sessions.connect()
+				connected = true
+			}
+			sc.sessions.message(size, err != nil)
+		}
+		if err != nil {
+			return err
+		}
+		sc.updateChan <- update
+		sc.streaming()
+
+		select {
+		case <-sc.quit:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// poll gets the status once. The size is that of the JSON, or 0 if
+// there was none to decode.
+func (hc *httpCollector) poll(ctx context.Context, client *http.Client, url string, connID int) (*ServerUpdate, int, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error polling server: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("Error polling server: %s returned %s", url, res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error polling server: %s", err)
+	}
+
+	update := new(ServerUpdate)
+	err = json.Unmarshal(data, update)
+	if err != nil {
+		return nil, len(data), fmt.Errorf("Could not read status from %s: %s", url, err)
+	}
+	update.ConnID = connID
+
+	now := time.Now()
+	if update.Uptime == 0 && update.Started > 0 {
+		update.Uptime = now.Unix() - int64(update.Started)
+	}
+	if update.Qps == 0 && !hc.lastPoll.IsZero() && update.Queries >= hc.lastQueries {
+		update.Qps = float64(update.Queries-hc.lastQueries) / now.Sub(hc.lastPoll).Seconds()
+	}
+	hc.lastQueries, hc.lastPoll = update.Queries, now
+	return update, len(data), nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type CollectorSuite struct{}
+
+var _ = Suite(&CollectorSuite{})
+
+// fakeStatus is a geodns /status endpoint; the query count goes up by
+// 10 with each request.
+type fakeStatus struct {
+	sync.Mutex
+	srv      *httptest.Server
+	queries  int64
+	started  int64
+	requests int
+	code     int
+}
+
+func newFakeStatus() *fakeStatus {
+	fs := &fakeStatus{code: http.StatusOK, started: time.Now().Add(-time.Hour).Unix()}
+	fs.srv = httptest.NewServer(http.HandlerFunc(fs.serve))
+	return fs
+}
+
+func (fs *fakeStatus) serve(w http.ResponseWriter, r *http.Request) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.requests++
+	if r.URL.Path != "/status" {
+		http.NotFound(w, r)
+		return
+	}
+	if fs.code != http.StatusOK {
+		w.WriteHeader(fs.code)
+		return
+	}
+	fs.queries += 10
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      "ns1",
+		"uuid":    "uuid-http",
+		"v":       "2.7.0",
+		"qs":      fs.queries,
+		"started": fs.started,
+	})
+}
+
+// restart starts the counters over, as a restarted geodns does.
+func (fs *fakeStatus) restart() {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.queries = 0
+	fs.started = time.Now().Unix()
+}
+
+func (fs *fakeStatus) setCode(code int) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.code = code
+}
+
+func (fs *fakeStatus) Endpoint() (net.IP, Endpoint) {
+	host, port, _ := net.SplitHostPort(fs.srv.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return net.ParseIP(host), Endpoint{
+		Port:     p,
+		Path:     "/status",
+		Protocol: "http",
+		Interval: 100 * time.Millisecond,
+	}
+}
+
+func (s *CollectorSuite) TestConfig(c *C) {
+	def := Endpoint{Port: 8053, Path: "/monitor"}
+
+	tests := []struct {
+		entry string
+		host  string
+		ep    Endpoint
+	}{
+		{"ws://ns1.example.com", "ns1.example.com", def},
+		{"http://ns1.example.com", "ns1.example.com", Endpoint{Port: 8053, Path: "/status", Protocol: "http"}},
+		{"http://ns1.example.com:9053/geodns/status", "ns1.example.com",
+			Endpoint{Port: 9053, Path: "/geodns/status", Protocol: "http"}},
+		{"HTTP://[2001:db8::53]:9053", "2001:db8::53", Endpoint{Port: 9053, Path: "/status", Protocol: "http"}},
+	}
+	for _, t := range tests {
+		host, ep, err := parseServerEntry(t.entry, def)
+		c.Check(err, IsNil)
+		c.Check(host, Equals, t.host, Commentf(t.entry))
+		c.Check(ep, Equals, t.ep, Commentf(t.entry))
+	}
+
+	_, _, err := parseServerEntry("https://ns1.example.com", def)
+	c.Check(err, ErrorMatches, "invalid protocol 'https'.* in 'https://ns1.example.com'")
+
+	cfg := new(AppConfig)
+	cfg.Servers.Protocol = "http"
+	cfg.Servers.PollInterval = "30s"
+	ep := cfg.Endpoint()
+	c.Check(ep, Equals, Endpoint{Port: 8053, Path: "/status", Protocol: "http", Interval: 30 * time.Second})
+
+	// a websocket entry when http is the default
+	_, wsEp, err := parseServerEntry("websocket://ns2.example.com", ep)
+	c.Check(err, IsNil)
+	c.Check(wsEp.Protocol, Equals, "")
+	c.Check(wsEp.Path, Equals, "/monitor")
+
+	cfg.Servers.Protocol = "gopher"
+	c.Check(cfg.validate(), ErrorMatches, "invalid servers protocol.*")
+	cfg.Servers.Protocol = "websocket"
+	cfg.Servers.PollInterval = "10ms"
+	c.Check(cfg.validate(), ErrorMatches, "servers pollinterval must be at least 1s")
+
+	c.Check(newCollector(def).String(), Equals, "websocket")
+	c.Check(newCollector(ep).String(), Equals, "http")
+}
+
+func (s *CollectorSuite) TestHTTP(c *C) {
+	fs := newFakeStatus()
+	defer fs.srv.Close()
+
+	hub := NewHub()
+	defer hub.Stop()
+	ip, ep := fs.Endpoint()
+	c.Assert(hub.AddNameEndpoint(ip.String(), ep), IsNil)
+
+	var st *Status
+	for i := 0; i < 50; i++ {
+		if sts := hub.Status(); len(sts) == 1 && sts[0].Qps > 0 {
+			st = sts[0]
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Assert(st, NotNil)
+	c.Check(st.UUID, Equals, "uuid-http")
+	c.Check(st.Status, Equals, "Ok")
+	c.Check(st.Uptime >= 3600, Equals, true)
+	c.Check(st.Queries >= 20, Equals, true)
+
+	fs.setCode(http.StatusServiceUnavailable)
+	for i := 0; i < 50; i++ {
+		if sts := hub.Status(); len(sts) == 1 && sts[0].Status != "Ok" {
+			st = sts[0]
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Check(st.Status, Matches, "Error polling server: .* returned 503 Service Unavailable")
+}
+
+func (s *CollectorSuite) TestStop(c *C) {
+	fs := newFakeStatus()
+	defer fs.srv.Close()
+
+	updates := make(chan *ServerUpdate, 100)
+	msgs := make(chan *ServerStatusMsg, 100)
+	ip, ep := fs.Endpoint()
+	ep.Interval = time.Hour
+	sc := NewServerConnection(ip, ep, updates, msgs)
+	sc.Start(1)
+
+	timeout := time.After(5 * time.Second)
+	for got := false; !got; {
+		select {
+		case up := <-updates:
+			got = up.UUID == "uuid-http"
+		case <-timeout:
+			c.Fatal("no update from the status endpoint")
+		}
+	}
+
+	// stopping doesn't wait for the poll interval
+	sc.Stop()
+	select {
+	case <-sc.Done():
+	case <-time.After(2 * time.Second):
+		c.Fatal("connection didn't stop")
+	}
+}
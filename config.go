@@ -1,11 +1,16 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"code.google.com/p/gcfg"
 )
@@ -13,12 +18,79 @@ import (
 // AppConfig is the 'master' application configuration
 type AppConfig struct {
 	Servers struct {
-		A      []string
-		Domain []string
-		Txt    []string
+		A            []string
+		Domain       []string
+		Txt          []string
+		Srv          []string
+		Axfr         []string
+		File         []string
+		URL          []string
+		Interval     string
+		Port         int
+		Path         string
+		Protocol     string
+		PollInterval string
+		Family       string
+		RemoveAfter  string
+		Pin          []string
 	}
+	Resolver struct {
+		Nameserver []string
+		Protocol   string
+		Timeout    string
+		ServerName string
+		CA         string
+		MaxTTL     string
+	}
+	HTTP struct {
+		Listen []string
+		Cert   string
+		Key    string
+		Socket string
+	}
+	History struct {
+		Path string
+		Tier []string
+	}
+	Connection struct {
+		DialTimeout      string
+		HandshakeTimeout string
+		ReadTimeout      string
+		Backoff          string
+		MaxBackoff       string
+	}
+	Probe struct {
+		Query    []string
+		Protocol []string
+		Interval string
+		Timeout  string
+		Port     int
+	}
+	State struct {
+		Path     string
+		Interval string
+	}
+	Consistency struct {
+		Zone     []string
+		Query    []string
+		Interval string
+	}
+	Alert  map[string]*AlertConfig
+	Notify map[string]*NotifyConfig
 }
 
+// defaultDiscoveryInterval is how often the servers are rediscovered
+// if the configuration doesn't say.
+const defaultDiscoveryInterval = 20 * time.Second
+
+// defaultHTTPListen is the dashboard address if neither a listen
+// address nor a unix socket is configured.
+const defaultHTTPListen = ":2090"
+
+// configWatchInterval is how often the configuration file is checked
+// for changes.
+var configWatchInterval = 2 * time.Second
+
 func configRead(fileName string) (*AppConfig, error) {
 	cfg := new(AppConfig)
 
@@ -26,70 +98,369 @@ func configRead(fileName string) (*AppConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = cfg.validate()
+	if err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
-func configure(hub *StatusHub) {
+// validate checks the parts of the configuration that gcfg can't, so
+// a bad configuration is rejected before anything is changed.
+func (cfg *AppConfig) validate() error {
+	if len(cfg.Servers.Interval) > 0 {
+		d, err := time.ParseDuration(cfg.Servers.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid servers interval: %s", err)
+		}
+		if d < time.Second {
+			return fmt.Errorf("servers interval must be at least 1s")
+		}
+	}
+	if cfg.Servers.Port < 0 || cfg.Servers.Port > 65535 {
+		return fmt.Errorf("invalid servers port %d", cfg.Servers.Port)
+	}
+	if len(cfg.Servers.Path) > 0 && !strings.HasPrefix(cfg.Servers.Path, "/") {
+		return fmt.Errorf("servers path must start with /")
+	}
+	if _, err := parseProtocol(cfg.Servers.Protocol); err != nil {
+		return fmt.Errorf("invalid servers protocol: %s", err)
+	}
+	if len(cfg.Servers.PollInterval) > 0 {
+		d, err := time.ParseDuration(cfg.Servers.PollInterval)
+		if err != nil {
+			return fmt.Errorf("invalid servers pollinterval: %s", err)
+		}
+		if d < time.Second {
+			return fmt.Errorf("servers pollinterval must be at least 1s")
+		}
+	}
+	if _, err := discoverersFromConfig(cfg); err != nil {
+		return err
+	}
+	if _, err := resolverSettingsFromConfig(cfg); err != nil {
+		return err
+	}
+	if _, err := parseFamily(cfg.Servers.Family); err != nil {
+		return err
+	}
+	if _, err := removalSettingsFromConfig(cfg); err != nil {
+		return err
+	}
+	for _, listen := range cfg.HTTP.Listen {
+		if _, _, err := net.SplitHostPort(listen); err != nil {
+			return fmt.Errorf("invalid http listen address '%s': %s", listen, err)
+		}
+	}
+	if (len(cfg.HTTP.Cert) > 0) != (len(cfg.HTTP.Key) > 0) {
+		return fmt.Errorf("http needs both cert and key for TLS")
+	}
+	if _, err := connectionSettingsFromConfig(cfg); err != nil {
+		return err
+	}
+	if _, err := probeSettingsFromConfig(cfg); err != nil {
+		return err
+	}
+	if _, err := consistencySettingsFromConfig(cfg); err != nil {
+		return err
+	}
+	if len(cfg.State.Interval) > 0 {
+		if _, err := time.ParseDuration(cfg.State.Interval); err != nil {
+			return fmt.Errorf("invalid state interval: %s", err)
+		}
+	}
+	if _, err := parseSeriesTiers(cfg.History.Tier); err != nil {
+		return err
+	}
+	if _, err := alertRulesFromConfig(cfg.Alert); err != nil {
+		return err
+	}
+	for name, nc := range cfg.Notify {
+		if _, err := newNotifyChannel(name, nc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DiscoveryInterval returns how long to wait between discovery runs.
+func (cfg *AppConfig) DiscoveryInterval() time.Duration {
+	d, err := time.ParseDuration(cfg.Servers.Interval)
+	if err != nil || d == 0 {
+		return defaultDiscoveryInterval
+	}
+	return d
+}
+
+// StateInterval returns how often the hub state should be saved.
+func (cfg *AppConfig) StateInterval() time.Duration {
+	d, err := time.ParseDuration(cfg.State.Interval)
+	if err != nil || d <= 0 {
+		return defaultStateInterval
+	}
+	return d
+}
+
+// Family returns the address families names are resolved to.
+func (cfg *AppConfig) Family() Family {
+	f, _ := parseFamily(cfg.Servers.Family)
+	return f
+}
 
-	cfg, err := configRead(*configFile)
+// Endpoint returns the monitor protocol, port and path for servers
+// that don't specify their own.
+func (cfg *AppConfig) Endpoint() Endpoint {
+	ep := defaultEndpoint
+	ep.Protocol, _ = parseProtocol(cfg.Servers.Protocol)
+	ep.Path = defaultPath(ep.Protocol)
+	if cfg.Servers.Port > 0 {
+		ep.Port = cfg.Servers.Port
+	}
+	if len(cfg.Servers.Path) > 0 {
+		ep.Path = cfg.Servers.Path
+	}
+	if d, err := time.ParseDuration(cfg.Servers.PollInterval); err == nil && d > 0 {
+		ep.Interval = d
+	}
+	return ep
+}
+
+// parseServerEntry splits an a= or domain= entry of the form
+// [protocol://]host[:port][/path] into the host and the monitor
+// endpoint, using def for the parts that aren't specified. IPv6
+// addresses with a port must be in brackets.
+func parseServerEntry(entry string, def Endpoint) (string, Endpoint, error) {
+	ep := def
+	host := strings.TrimSpace(entry)
+	if i := strings.Index(host, "://"); i >= 0 {
+		protocol, err := parseProtocol(host[:i])
+		if err != nil {
+			return "", ep, fmt.Errorf("%s in '%s'", err, entry)
+		}
+		if protocol != ep.Protocol {
+			ep.Protocol, ep.Path = protocol, defaultPath(protocol)
+		}
+		host = host[i+3:]
+	}
+	if i := strings.Index(host, "/"); i >= 0 {
+		host, ep.Path = host[:i], host[i:]
+	}
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		port, err := strconv.Atoi(p)
+		if err != nil || port < 1 || port > 65535 {
+			return "", ep, fmt.Errorf("invalid port in '%s'", entry)
+		}
+		host, ep.Port = h, port
+	}
+	if len(host) == 0 {
+		return "", ep, fmt.Errorf("missing host in '%s'", entry)
+	}
+	return host, ep, nil
+}
+
+// ConfigStatus describes the last (attempted) configuration reload.
+type ConfigStatus struct {
+	File        string    `json:"file"`
+	Loaded      time.Time `json:"loaded"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastError   string    `json:"last_error"`
+	Reloads     int       `json:"reloads"`
+	Interval    string    `json:"interval"`
+}
+
+// ConfigManager keeps the last good configuration and reloads it
+// when the file changes or the process gets a SIGHUP.
+type ConfigManager struct {
+	sync.RWMutex
+	fileName string
+	cfg      *AppConfig
+	modTime  time.Time
+	size     int64
+	status   ConfigStatus
+	handlers []func(*AppConfig)
+
+	running  bool
+	quit     chan bool
+	quitOnce sync.Once
+	done     chan bool
+}
+
+// NewConfigManager reads the configuration file. Unlike later
+// reloads a bad configuration here is an error.
+func NewConfigManager(fileName string) (*ConfigManager, error) {
+	cm := &ConfigManager{
+		fileName: fileName,
+		quit:     make(chan bool),
+		done:     make(chan bool),
+	}
+	cm.status.File = fileName
+	err := cm.Reload()
 	if err != nil {
-		log.Printf("Could not read config file: %s\n", err)
-		os.Exit(2)
+		return nil, err
 	}
+	return cm, nil
+}
 
-	hub.MarkConfigurationStart()
-	wg := &sync.WaitGroup{}
-	errch := make(chan error, 20)
+// Config returns the current configuration.
+func (cm *ConfigManager) Config() *AppConfig {
+	cm.RLock()
+	defer cm.RUnlock()
+	return cm.cfg
+}
 
-	for _, server := range cfg.Servers.A {
-		log.Println("Adding", server)
-		wg.Add(1)
-		hub.AddNameBackground(server, errch)
+// Status returns information about the last reload.
+func (cm *ConfigManager) Status() ConfigStatus {
+	cm.RLock()
+	defer cm.RUnlock()
+	return cm.status
+}
+
+// OnReload registers a function to be called with each new
+// configuration.
+func (cm *ConfigManager) OnReload(fn func(*AppConfig)) {
+	cm.Lock()
+	defer cm.Unlock()
+	cm.handlers = append(cm.handlers, fn)
+}
+
+func (cm *ConfigManager) stat() (time.Time, int64) {
+	fi, err := os.Stat(cm.fileName)
+	if err != nil {
+		return time.Time{}, 0
 	}
+	return fi.ModTime(), fi.Size()
+}
 
-	for _, domain := range cfg.Servers.Domain {
-		log.Println("Adding NSes for", domain)
+// changed returns true if the file was modified since it was last
+// read.
+func (cm *ConfigManager) changed() bool {
+	modTime, size := cm.stat()
+	cm.RLock()
+	defer cm.RUnlock()
+	return !modTime.Equal(cm.modTime) || size != cm.size
+}
 
-		nses, err := net.LookupNS(domain)
+// Reload reads the configuration file. If it can't be read or isn't
+// valid the error is recorded and the previous configuration is
+// kept.
+func (cm *ConfigManager) Reload() error {
+	modTime, size := cm.stat()
+	cfg, err := configRead(cm.fileName)
 
-		log.Printf("NSes: %#v: %s\n", nses, err)
-		for _, ns := range nses {
-			log.Printf("Adding '%s'\n", ns.Host)
-			wg.Add(1)
-			hub.AddNameBackground(ns.Host, errch)
-		}
+	cm.Lock()
+	cm.status.LastAttempt = time.Now()
+	// don't try the same broken file again until it changes
+	cm.modTime, cm.size = modTime, size
+	if err != nil {
+		cm.status.LastError = err.Error()
+		cm.Unlock()
+		log.Printf("Could not read config file: %s", err)
+		return err
 	}
+	cm.cfg = cfg
+	cm.status.LastError = ""
+	cm.status.Loaded = cm.status.LastAttempt
+	cm.status.Reloads++
+	cm.status.Interval = cfg.DiscoveryInterval().String()
+	handlers := cm.handlers
+	cm.Unlock()
 
-	for _, txtconfig := range cfg.Servers.Txt {
+	configReloads.Inc()
+	for _, fn := range handlers {
+		fn(cfg)
+	}
+	return nil
+}
 
-		x := strings.SplitN(txtconfig, ",", 2)
-		txtname := strings.TrimSpace(x[0])
-		txtbase := strings.TrimSpace(x[1])
+// Run runs the server discovery every interval, and right away when
+// the configuration has been reloaded, until it's stopped.
+func (cm *ConfigManager) Run(hub *StatusHub) {
+	cm.Lock()
+	cm.running = true
+	cm.Unlock()
+	defer close(cm.done)
 
-		log.Println("Adding TXT for", txtname, txtbase)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
 
-		txts, err := net.LookupTXT(txtname)
-		log.Printf("TXTs: %#v: %s\n", txts, err)
+	watch := time.NewTicker(configWatchInterval)
+	defer watch.Stop()
 
-		names := []string{}
+	for {
+		cfg := cm.Config()
+		log.Println("running configuration...")
+		configure(hub, cfg)
 
-		for _, txt := range txts {
-			for _, name := range strings.Split(txt, " ") {
-				names = append(names, name)
+		timer := time.NewTimer(cfg.DiscoveryInterval())
+	wait:
+		for {
+			select {
+			case <-timer.C:
+				break wait
+			case <-cm.quit:
+				timer.Stop()
+				return
+			case <-hup:
+				log.Println("Got SIGHUP, reloading configuration")
+				if cm.Reload() == nil {
+					break wait
+				}
+			case <-watch.C:
+				if !cm.changed() {
+					continue
+				}
+				log.Println("Configuration file changed, reloading")
+				if cm.Reload() == nil {
+					break wait
+				}
 			}
 		}
+		timer.Stop()
+	}
+}
 
-		nameSlice := []string{"", txtbase}
-		for _, name := range names {
-			nameSlice[0] = name
-			hub.AddNameBackground(strings.Join(nameSlice, "."), errch)
-		}
+// Stop stops the discovery loop, waiting for a running discovery to
+// finish.
+func (cm *ConfigManager) Stop() {
+	cm.RLock()
+	running := cm.running
+	cm.RUnlock()
+	cm.quitOnce.Do(func() { close(cm.quit) })
+	if running {
+		<-cm.done
+	}
+}
+
+func configure(hub *StatusHub, cfg *AppConfig) {
+
+	// the configuration has already been validated
+	discoverers, _ := discoverersFromConfig(cfg)
+
+	rs, _ := removalSettingsFromConfig(cfg)
+	hub.SetFamily(cfg.Family())
+	hub.SetRemoval(rs)
+	hub.MarkConfigurationStart()
+	wg := &sync.WaitGroup{}
+	errch := make(chan error, 20)
+
+	started := time.Now()
+	results := discover(discoverers, hub.Resolver())
+	run := newDiscoveryRun(results, started)
+
+	for _, target := range discoveredTargets(results) {
+		log.Printf("Adding '%s' from %s", target.Host, target.Source.Config)
+		wg.Add(1)
+		hub.AddNameBackground(target.Host, target.Endpoint, target.Source, errch)
 	}
 
 	go func() {
 		for err := range errch {
 			if err != nil {
 				log.Println(err)
+				if ae, ok := err.(*AddError); ok {
+					run.addFailed(ae)
+				}
 			}
 			wg.Done()
 		}
@@ -97,6 +468,8 @@ func configure(hub *StatusHub) {
 
 	wg.Wait()
 	close(errch)
+	hub.MarkDiscoveryFailed(failedDiscoverers(results))
 	hub.MarkConfigurationEnd()
+	hub.Discovery().Record(run, time.Now())
 
 }
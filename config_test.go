@@ -0,0 +1,184 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConfigSuite struct {
+	dir string
+}
+
+var _ = Suite(&ConfigSuite{})
+
+func (s *ConfigSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "dnsmonitor-config")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *ConfigSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *ConfigSuite) write(c *C, name, data string) string {
+	fileName := filepath.Join(s.dir, name)
+	err := ioutil.WriteFile(fileName, []byte(data), 0644)
+	c.Assert(err, IsNil)
+	return fileName
+}
+
+func (s *ConfigSuite) TestValidate(c *C) {
+	_, err := configRead(s.write(c, "a.conf", "[servers]\ninterval=soon\n"))
+	c.Check(err, ErrorMatches, "invalid servers interval.*")
+
+	_, err = configRead(s.write(c, "b.conf", "[servers]\ntxt=abc\n"))
+	c.Check(err, ErrorMatches, "invalid txt 'abc'.*")
+
+	_, err = configRead(s.write(c, "c.conf", "[alert \"x\"]\ntype=nope\n"))
+	c.Check(err, ErrorMatches, "alert 'x': unknown type.*")
+
+	_, err = configRead(s.write(c, "e.conf", "[servers]\nfamily=ipx\n"))
+	c.Check(err, ErrorMatches, "invalid family 'ipx'.*")
+
+	cfg, err := configRead(s.write(c, "d.conf", "[servers]\na=127.0.0.1\n"))
+	c.Assert(err, IsNil)
+	c.Check(cfg.DiscoveryInterval(), Equals, defaultDiscoveryInterval)
+	c.Check(cfg.Family(), Equals, FamilyBoth)
+}
+
+func (s *ConfigSuite) TestReload(c *C) {
+	fileName := s.write(c, "dnsmonitor.conf", "[servers]\na=127.0.0.1\ninterval=5s\n")
+
+	cm, err := NewConfigManager(fileName)
+	c.Assert(err, IsNil)
+	c.Check(cm.Config().DiscoveryInterval(), Equals, 5*time.Second)
+	c.Check(cm.changed(), Equals, false)
+
+	reloaded := 0
+	cm.OnReload(func(*AppConfig) { reloaded++ })
+
+	s.write(c, "dnsmonitor.conf", "[servers\na=127.0.0.1\n")
+	c.Check(cm.changed(), Equals, true)
+	c.Check(cm.Reload(), NotNil)
+	c.Check(cm.changed(), Equals, false)
+	c.Check(reloaded, Equals, 0)
+
+	// the old configuration is kept
+	c.Check(cm.Config().Servers.A, DeepEquals, []string{"127.0.0.1"})
+	status := cm.Status()
+	c.Check(status.LastError, Not(Equals), "")
+	c.Check(status.Reloads, Equals, 1)
+
+	s.write(c, "dnsmonitor.conf", "[servers]\na=127.0.0.2\n")
+	c.Check(cm.Reload(), IsNil)
+	c.Check(reloaded, Equals, 1)
+	c.Check(cm.Config().Servers.A, DeepEquals, []string{"127.0.0.2"})
+	status = cm.Status()
+	c.Check(status.LastError, Equals, "")
+	c.Check(status.Reloads, Equals, 2)
+	c.Check(status.Interval, Equals, "20s")
+}
+
+func (s *ConfigSuite) TestServerEntry(c *C) {
+	def := Endpoint{Port: 8053, Path: "/monitor"}
+
+	tests := []struct {
+		entry string
+		host  string
+		ep    Endpoint
+	}{
+		{"ns1.example.com", "ns1.example.com", def},
+		{"ns1.example.com:9053", "ns1.example.com", Endpoint{Port: 9053, Path: "/monitor"}},
+		{"192.0.2.1:9053/status/ws", "192.0.2.1", Endpoint{Port: 9053, Path: "/status/ws"}},
+		{"2001:db8::53", "2001:db8::53", def},
+		{"[2001:db8::53]:9053", "2001:db8::53", Endpoint{Port: 9053, Path: "/monitor"}},
+	}
+	for _, t := range tests {
+		host, ep, err := parseServerEntry(t.entry, def)
+		c.Check(err, IsNil)
+		c.Check(host, Equals, t.host, Commentf(t.entry))
+		c.Check(ep, Equals, t.ep, Commentf(t.entry))
+	}
+
+	_, _, err := parseServerEntry("ns1.example.com:http", def)
+	c.Check(err, ErrorMatches, "invalid port.*")
+
+	_, err = configRead(s.write(c, "a.conf", "[servers]\na=ns1.example.com:99999\n"))
+	c.Check(err, ErrorMatches, "invalid port in 'ns1.example.com:99999'")
+
+	_, err = configRead(s.write(c, "b.conf", "[http]\ncert=cert.pem\n"))
+	c.Check(err, ErrorMatches, "http needs both cert and key.*")
+
+	cfg, err := configRead(s.write(c, "c.conf", "[servers]\nport=9053\n[http]\nlisten=127.0.0.1:0\nlisten=[::1]:0\n"))
+	c.Assert(err, IsNil)
+	c.Check(cfg.Endpoint(), Equals, Endpoint{Port: 9053, Path: "/monitor"})
+	c.Check(cfg.HTTP.Listen, HasLen, 2)
+}
+
+func (s *ConfigSuite) TestConfigureTxt(c *C) {
+	stub := newStubDNS(c,
+		"servers.example.test. 300 IN TXT \"ns1 ns2\"",
+		"ns1.example.test. 300 IN A 127.0.0.1",
+	)
+	defer stub.Close()
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-13", "up": 10})
+	defer fm.Close()
+	_, ep := fm.Endpoint()
+
+	rcfg := new(AppConfig)
+	rcfg.Resolver.Nameserver = []string{net.JoinHostPort("127.0.0.1", strconv.Itoa(stub.Port))}
+	rcfg.Resolver.Timeout = "200ms"
+	rs, err := resolverSettingsFromConfig(rcfg)
+	c.Assert(err, IsNil)
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetResolver(NewResolver(rs))
+
+	// all the names of a txt entry are added before configure
+	// returns, and their errors are counted
+	cfg := new(AppConfig)
+	cfg.Servers.Txt = []string{"servers.example.test,example.test"}
+	cfg.Servers.Family = "ipv4"
+	cfg.Servers.Port = ep.Port
+	configure(hub, cfg)
+	sts := hub.Status()
+	c.Assert(sts, HasLen, 1)
+	c.Check(sts[0].IP, Equals, "127.0.0.1")
+	c.Assert(sts[0].Sources, HasLen, 1)
+	c.Check(sts[0].Sources[0].Config, Equals, "txt=servers.example.test,example.test")
+	status := hub.Discovery().Status()
+	c.Assert(status.Sources, HasLen, 1)
+	c.Check(status.Sources[0].Targets, Equals, 2)
+	c.Check(status.Sources[0].Failures, HasLen, 1)
+}
+
+func (s *ConfigSuite) TestStop(c *C) {
+	fileName := s.write(c, "dnsmonitor.conf", "[servers]\ninterval=1h\n")
+	cm, err := NewConfigManager(fileName)
+	c.Assert(err, IsNil)
+
+	hub := NewHub()
+	defer hub.Stop()
+
+	done := make(chan bool)
+	go func() {
+		cm.Run(hub)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cm.Stop()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		c.Fatal("configuration loop didn't stop")
+	}
+}
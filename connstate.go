@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ConnState is the state of the connection to a server.
+type ConnState string
+
+const (
+	StateConnecting  ConnState = "connecting"
+	StateHandshaking ConnState = "handshaking"
+	StateStreaming   ConnState = "streaming"
+	StateBackoff     ConnState = "backoff"
+	StateStopped     ConnState = "stopped"
+)
+
+// connStates are all the states, for the metrics.
+var connStates = []ConnState{StateConnecting, StateHandshaking, StateStreaming, StateBackoff, StateStopped}
+
+// backoffJitter is the part of each backoff delay that's random, so
+// connections that failed together don't all retry together.
+const backoffJitter = 0.5
+
+// ConnectionSettings are the timeouts and retry delays of the server
+// connections.
+type ConnectionSettings struct {
+	DialTimeout time.Duration
+	// HandshakeTimeout limits the websocket upgrade.
+	HandshakeTimeout time.Duration
+	// ReadTimeout is how long to wait for the next update on the
+	// websocket, or for the response to an HTTP poll.
+	ReadTimeout time.Duration
+	// MinBackoff is the delay before the first retry after a
+	// failure; it doubles with each failure after that, up to
+	// MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+var defaultConnectionSettings = &ConnectionSettings{
+	DialTimeout:      5 * time.Second,
+	HandshakeTimeout: 5 * time.Second,
+	ReadTimeout:      3 * time.Second,
+	MinBackoff:       time.Second,
+	MaxBackoff:       30 * time.Second,
+}
+
+// connectionSettingsFromConfig reads the [connection] section.
+func connectionSettingsFromConfig(cfg *AppConfig) (*ConnectionSettings, error) {
+	cs := *defaultConnectionSettings
+	durations := []struct {
+		name  string
+		value string
+		d     *time.Duration
+	}{
+		{"dialtimeout", cfg.Connection.DialTimeout, &cs.DialTimeout},
+		{"handshaketimeout", cfg.Connection.HandshakeTimeout, &cs.HandshakeTimeout},
+		{"readtimeout", cfg.Connection.ReadTimeout, &cs.ReadTimeout},
+		{"backoff", cfg.Connection.Backoff, &cs.MinBackoff},
+		{"maxbackoff", cfg.Connection.MaxBackoff, &cs.MaxBackoff},
+	}
+	for _, setting := range durations {
+		if len(setting.value) == 0 {
+			continue
+		}
+		d, err := time.ParseDuration(setting.value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid connection %s '%s'", setting.name, setting.value)
+		}
+		*setting.d = d
+	}
+	if cs.MaxBackoff < cs.MinBackoff {
+		return nil, fmt.Errorf("connection maxbackoff must be at least the backoff")
+	}
+	return &cs, nil
+}
+
+// backoff is the delay before the next connection attempt.
+type backoff struct {
+	failures int
+	random   func() float64
+}
+
+func newBackoff() *backoff {
+	return &backoff{random: rand.Float64}
+}
+
+// next counts a failure and returns how long to wait before trying
+// again: MinBackoff doubled for each failure before, capped at
+// MaxBackoff, with up to half of it taken off at random.
+func (b *backoff) next(cs *ConnectionSettings) time.Duration {
+	d := cs.MinBackoff
+	for i := 0; i < b.failures && d < cs.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > cs.MaxBackoff {
+		d = cs.MaxBackoff
+	}
+	b.failures++
+	return d - time.Duration(backoffJitter*b.random()*float64(d))
+}
+
+// reset starts over from MinBackoff, after a connection worked.
+func (b *backoff) reset() {
+	b.failures = 0
+}
+
+// setConnState updates the status with the message from the
+// connection and returns true if it changed.
+func (st *Status) setConnState(msg *ServerStatusMsg) bool {
+	changed := false
+	if len(msg.Status) > 0 && st.Status != msg.Status {
+		st.Status = msg.Status
+		changed = true
+	}
+	if len(msg.State) > 0 && st.State != msg.State {
+		st.State = msg.State
+		changed = true
+	}
+	if msg.NextRetry.IsZero() {
+		if st.NextRetry != nil {
+			st.NextRetry = nil
+			changed = true
+		}
+	} else if st.NextRetry == nil || !st.NextRetry.Equal(msg.NextRetry) {
+		next := msg.NextRetry
+		st.NextRetry = &next
+		changed = true
+	}
+	return changed
+}
+
+// connectionConfig holds the current settings for all the
+// connections.
+type connectionConfig struct {
+	sync.RWMutex
+	settings *ConnectionSettings
+}
+
+func (cc *connectionConfig) Settings() *ConnectionSettings {
+	if cc == nil {
+		return defaultConnectionSettings
+	}
+	cc.RLock()
+	defer cc.RUnlock()
+	if cc.settings == nil {
+		return defaultConnectionSettings
+	}
+	return cc.settings
+}
+
+func (cc *connectionConfig) Set(cs *ConnectionSettings) {
+	cc.Lock()
+	defer cc.Unlock()
+	cc.settings = cs
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConnStateSuite struct{}
+
+var _ = Suite(&ConnStateSuite{})
+
+func (s *ConnStateSuite) TestConfig(c *C) {
+	cfg := new(AppConfig)
+	cs, err := connectionSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Check(*cs, Equals, *defaultConnectionSettings)
+
+	cfg.Connection.DialTimeout = "2s"
+	cfg.Connection.ReadTimeout = "10s"
+	cfg.Connection.Backoff = "500ms"
+	cfg.Connection.MaxBackoff = "2m"
+	cs, err = connectionSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Check(cs.DialTimeout, Equals, 2*time.Second)
+	c.Check(cs.HandshakeTimeout, Equals, defaultConnectionSettings.HandshakeTimeout)
+	c.Check(cs.ReadTimeout, Equals, 10*time.Second)
+	c.Check(cs.MinBackoff, Equals, 500*time.Millisecond)
+	c.Check(cs.MaxBackoff, Equals, 2*time.Minute)
+
+	cfg.Connection.HandshakeTimeout = "soon"
+	c.Check(cfg.validate(), ErrorMatches, "invalid connection handshaketimeout 'soon'")
+	cfg.Connection.HandshakeTimeout = ""
+	cfg.Connection.MaxBackoff = "100ms"
+	c.Check(cfg.validate(), ErrorMatches, "connection maxbackoff must be at least the backoff")
+}
+
+func (s *ConnStateSuite) TestBackoff(c *C) {
+	cs := &ConnectionSettings{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	random := 0.0
+	b := newBackoff()
+	b.random = func() float64 { return random }
+
+	delays := []time.Duration{}
+	for i := 0; i < 6; i++ {
+		delays = append(delays, b.next(cs))
+	}
+	c.Check(delays, DeepEquals, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		10 * time.Second, 10 * time.Second,
+	})
+
+	// up to half is taken off at random
+	random = 1
+	c.Check(b.next(cs), Equals, 5*time.Second)
+
+	b.reset()
+	random = 0.5
+	c.Check(b.next(cs), Equals, 750*time.Millisecond)
+}
+
+// waitState waits for the hub to have one server in the state.
+func waitState(c *C, hub *StatusHub, state ConnState) *Status {
+	for i := 0; i < 50; i++ {
+		if sts := hub.Status(); len(sts) == 1 && sts[0].State == state {
+			return sts[0]
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Fatalf("server isn't %s: %#v", state, hub.Status())
+	return nil
+}
+
+func (s *ConnStateSuite) TestStates(c *C) {
+	// a server that accepts connections but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+	go func() {
+		conns := []net.Conn{}
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				break
+			}
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetConnectionSettings(&ConnectionSettings{
+		DialTimeout:      time.Second,
+		HandshakeTimeout: 200 * time.Millisecond,
+		ReadTimeout:      time.Second,
+		MinBackoff:       time.Minute,
+		MaxBackoff:       time.Minute,
+	})
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	c.Assert(hub.AddNameEndpoint("127.0.0.1", Endpoint{Port: p, Path: "/monitor"}), IsNil)
+
+	st := waitState(c, hub, StateBackoff)
+	c.Check(st.Status, Matches, "Could not upgrade WS on '127.0.0.1': .*timeout.*")
+	c.Assert(st.NextRetry, NotNil)
+	c.Check(st.NextRetry.After(time.Now().Add(29*time.Second)), Equals, true)
+	c.Check(st.NextRetry.Before(time.Now().Add(time.Minute)), Equals, true)
+
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-3"})
+	defer fm.Close()
+	hub2 := NewHub()
+	defer hub2.Stop()
+	ip, ep := fm.Endpoint()
+	c.Assert(hub2.AddNameEndpoint(ip.String(), ep), IsNil)
+	st = waitState(c, hub2, StateStreaming)
+	c.Check(st.Status, Equals, "Ok")
+	c.Check(st.NextRetry, IsNil)
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const defaultConsistencyInterval = 30 * time.Second
+
+// ConsistencySettings is the [consistency] configuration. The SOA
+// of each zone is checked as well as the queries.
+type ConsistencySettings struct {
+	Queries  []*ProbeQuery
+	Interval time.Duration
+	Timeout  time.Duration
+	Port     int
+}
+
+func consistencySettingsFromConfig(cfg *AppConfig) (*ConsistencySettings, error) {
+	cs := &ConsistencySettings{
+		Interval: defaultConsistencyInterval,
+		Timeout:  defaultProbeTimeout,
+		Port:     cfg.Probe.Port,
+	}
+	// the metrics are by name, type and subnet, so each may only be
+	// checked once
+	seen := make(map[string]bool)
+	add := func(q *ProbeQuery) {
+		key := strings.ToLower(q.String())
+		if !seen[key] {
+			seen[key] = true
+			cs.Queries = append(cs.Queries, q)
+		}
+	}
+	for _, zone := range cfg.Consistency.Zone {
+		add(&ProbeQuery{Name: dns.Fqdn(zone), Type: dns.TypeSOA})
+	}
+	for _, s := range cfg.Consistency.Query {
+		q, err := parseProbeQuery(s)
+		if err != nil {
+			return nil, fmt.Errorf("consistency: %s", err)
+		}
+		add(q)
+	}
+	if len(cfg.Consistency.Interval) > 0 {
+		d, err := time.ParseDuration(cfg.Consistency.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid consistency interval: %s", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("consistency interval must be at least 1s")
+		}
+		cs.Interval = d
+	}
+	if len(cfg.Probe.Timeout) > 0 {
+		d, err := time.ParseDuration(cfg.Probe.Timeout)
+		if err == nil {
+			cs.Timeout = d
+		}
+	}
+	if cs.Port == 0 {
+		cs.Port = defaultProbePort
+	}
+	return cs, nil
+}
+
+// answer is what one server said to one query.
+type answer struct {
+	Rcode   string
+	Answers []string
+	Serial  uint32
+	Error   string
+}
+
+// key is equal for answers that agree. For SOA queries only the
+// serial matters.
+func (a *answer) key(qtype uint16) string {
+	if len(a.Error) > 0 {
+		return "error " + a.Error
+	}
+	if qtype == dns.TypeSOA {
+		return a.Rcode + " " + strconv.FormatUint(uint64(a.Serial), 10)
+	}
+	return a.Rcode + " " + strings.Join(a.Answers, " ")
+}
+
+// ConsistencyServer identifies a server in a consistency report.
+type ConsistencyServer struct {
+	IP     string   `json:"ip"`
+	Name   string   `json:"name"`
+	Groups []string `json:"groups"`
+}
+
+// AnswerVariant is an answer and the servers that gave it.
+type AnswerVariant struct {
+	Rcode   string               `json:"rcode"`
+	Answers []string             `json:"answers"`
+	Serial  uint32               `json:"serial,omitempty"`
+	Error   string               `json:"error,omitempty"`
+	Servers []*ConsistencyServer `json:"servers"`
+}
+
+// ConsistencyCheck is the comparison of the answers to one query.
+// The variants are sorted with the most common answer first;
+// servers that didn't answer at all don't make it inconsistent.
+type ConsistencyCheck struct {
+	Name       string           `json:"name"`
+	Type       string           `json:"type"`
+	Subnet     string           `json:"subnet,omitempty"`
+	Consistent bool             `json:"consistent"`
+	Variants   []*AnswerVariant `json:"variants"`
+	// Groups says for each group if its servers agree.
+	Groups map[string]bool `json:"groups"`
+}
+
+// ConsistencyReport is the result of a round of consistency checks.
+type ConsistencyReport struct {
+	Time      time.Time           `json:"time"`
+	Servers   int                 `json:"servers"`
+	Divergent int                 `json:"divergent"`
+	Checks    []*ConsistencyCheck `json:"checks"`
+}
+
+// ConsistencyChecker periodically sends the same queries to every
+// server and compares the answers.
+type ConsistencyChecker struct {
+	sync.RWMutex
+	settings *ConsistencySettings
+	report   *ConsistencyReport
+	handlers []func(*ConsistencyReport)
+
+	running  bool
+	quit     chan bool
+	quitOnce sync.Once
+	done     chan bool
+}
+
+func NewConsistencyChecker(cs *ConsistencySettings) *ConsistencyChecker {
+	return &ConsistencyChecker{
+		settings: cs,
+		report:   &ConsistencyReport{Checks: []*ConsistencyCheck{}},
+		quit:     make(chan bool),
+		done:     make(chan bool),
+	}
+}
+
+// SetSettings replaces the settings from the next round on.
+func (cc *ConsistencyChecker) SetSettings(cs *ConsistencySettings) {
+	cc.Lock()
+	defer cc.Unlock()
+	cc.settings = cs
+}
+
+func (cc *ConsistencyChecker) Settings() *ConsistencySettings {
+	cc.RLock()
+	defer cc.RUnlock()
+	return cc.settings
+}
+
+// Report returns the result of the last round.
+func (cc *ConsistencyChecker) Report() *ConsistencyReport {
+	cc.RLock()
+	defer cc.RUnlock()
+	return cc.report
+}
+
+// OnReport registers a function to be called with each new report.
+func (cc *ConsistencyChecker) OnReport(fn func(*ConsistencyReport)) {
+	cc.Lock()
+	defer cc.Unlock()
+	cc.handlers = append(cc.handlers, fn)
+}
+
+// Run checks the servers every interval until it's stopped.
+func (cc *ConsistencyChecker) Run(hub *StatusHub) {
+	cc.Lock()
+	cc.running = true
+	cc.Unlock()
+	defer close(cc.done)
+	for {
+		cs := cc.Settings()
+		if len(cs.Queries) > 0 {
+			cc.Check(hub.Status())
+		}
+		select {
+		case <-time.After(cs.Interval):
+		case <-cc.quit:
+			return
+		}
+	}
+}
+
+// Stop stops the checks, waiting for a running round to finish.
+func (cc *ConsistencyChecker) Stop() {
+	cc.RLock()
+	running := cc.running
+	cc.RUnlock()
+	cc.quitOnce.Do(func() { close(cc.quit) })
+	if running {
+		<-cc.done
+	}
+}
+
+// Check queries all the servers and compares their answers.
+func (cc *ConsistencyChecker) Check(statuses []*Status) *ConsistencyReport {
+	cs := cc.Settings()
+
+	servers := []*ConsistencyServer{}
+	for _, st := range statuses {
+		if net.ParseIP(st.IP) == nil {
+			continue
+		}
+		servers = append(servers, &ConsistencyServer{IP: st.IP, Name: st.Name, Groups: st.Groups})
+	}
+	sort.Sort(consistencyServersByName(servers))
+
+	// answers[i][j] is what server j said to query i
+	answers := make([][]*answer, len(cs.Queries))
+	for i := range answers {
+		answers[i] = make([]*answer, len(servers))
+	}
+	wg := sync.WaitGroup{}
+	for j, srv := range servers {
+		wg.Add(1)
+		go func(j int, ip string) {
+			defer wg.Done()
+			addr := net.JoinHostPort(ip, strconv.Itoa(cs.Port))
+			for i, q := range cs.Queries {
+				answers[i][j] = queryAnswer(addr, q, cs.Timeout)
+			}
+		}(j, srv.IP)
+	}
+	wg.Wait()
+
+	report := &ConsistencyReport{
+		Time:    time.Now(),
+		Servers: len(servers),
+		Checks:  []*ConsistencyCheck{},
+	}
+	for i, q := range cs.Queries {
+		check := compareAnswers(q, servers, answers[i])
+		if !check.Consistent {
+			report.Divergent++
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	cc.Lock()
+	cc.report = report
+	handlers := cc.handlers
+	cc.Unlock()
+
+	if report.Divergent > 0 {
+		log.Printf("Consistency: %d of %d queries got different answers", report.Divergent, len(report.Checks))
+	}
+	for _, fn := range handlers {
+		fn(report)
+	}
+	return report
+}
+
+type consistencyServersByName []*ConsistencyServer
+
+func (s consistencyServersByName) Len() int      { return len(s) }
+func (s consistencyServersByName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s consistencyServersByName) Less(i, j int) bool {
+	if s[i].Name != s[j].Name {
+		return s[i].Name < s[j].Name
+	}
+	return s[i].IP < s[j].IP
+}
+
+// queryAnswer sends the query over UDP, retrying over TCP if the
+// answer is truncated.
+func queryAnswer(addr string, q *ProbeQuery, timeout time.Duration) *answer {
+	m := q.msg()
+	c := &dns.Client{Net: "udp", Timeout: timeout}
+	r, _, err := c.Exchange(m, addr)
+	if err == nil && r.Truncated {
+		c.Net = "tcp"
+		r, _, err = c.Exchange(m, addr)
+	}
+	if err != nil {
+		return &answer{Error: err.Error()}
+	}
+
+	a := &answer{Rcode: dns.RcodeToString[r.Rcode], Answers: []string{}}
+	for _, rr := range r.Answer {
+		if rr.Header().Rrtype != q.Type {
+			continue
+		}
+		if soa, ok := rr.(*dns.SOA); ok {
+			a.Serial = soa.Serial
+		}
+		a.Answers = append(a.Answers, rdata(rr))
+	}
+	sort.Strings(a.Answers)
+	return a
+}
+
+// compareAnswers groups the servers by the answer they gave.
+func compareAnswers(q *ProbeQuery, servers []*ConsistencyServer, answers []*answer) *ConsistencyCheck {
+	check := &ConsistencyCheck{
+		Name:     q.Name,
+		Type:     dns.TypeToString[q.Type],
+		Subnet:   q.subnet(),
+		Variants: []*AnswerVariant{},
+		Groups:   make(map[string]bool),
+	}
+
+	byKey := make(map[string]*AnswerVariant)
+	groupKeys := make(map[string]map[string]bool)
+	for j, srv := range servers {
+		a := answers[j]
+		key := a.key(q.Type)
+		v, ok := byKey[key]
+		if !ok {
+			v = &AnswerVariant{Rcode: a.Rcode, Answers: a.Answers, Serial: a.Serial, Error: a.Error}
+			byKey[key] = v
+			check.Variants = append(check.Variants, v)
+		}
+		v.Servers = append(v.Servers, srv)
+
+		if len(a.Error) > 0 {
+			continue
+		}
+		for _, group := range srv.Groups {
+			if groupKeys[group] == nil {
+				groupKeys[group] = make(map[string]bool)
+			}
+			groupKeys[group][key] = true
+		}
+	}
+
+	sort.Stable(variantsByServers(check.Variants))
+
+	answered := 0
+	for _, v := range check.Variants {
+		if len(v.Error) == 0 {
+			answered++
+		}
+	}
+	check.Consistent = answered <= 1
+	for group, keys := range groupKeys {
+		check.Groups[group] = len(keys) <= 1
+	}
+	return check
+}
+
+// variantsByServers sorts the most common answers first and errors
+// last.
+type variantsByServers []*AnswerVariant
+
+func (s variantsByServers) Len() int      { return len(s) }
+func (s variantsByServers) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s variantsByServers) Less(i, j int) bool {
+	ei, ej := len(s[i].Error) > 0, len(s[j].Error) > 0
+	if ei != ej {
+		return ej
+	}
+	return len(s[i].Servers) > len(s[j].Servers)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+	. "gopkg.in/check.v1"
+)
+
+type ConsistencySuite struct{}
+
+var _ = Suite(&ConsistencySuite{})
+
+func (s *ConsistencySuite) TestCompare(c *C) {
+	servers := []*ConsistencyServer{
+		{IP: "192.0.2.1", Name: "ns1", Groups: []string{"edge"}},
+		{IP: "192.0.2.2", Name: "ns2", Groups: []string{"edge"}},
+		{IP: "192.0.2.3", Name: "ns3", Groups: []string{"core"}},
+		{IP: "192.0.2.4", Name: "ns4", Groups: []string{"core"}},
+	}
+	soa := &ProbeQuery{Name: "example.com.", Type: dns.TypeSOA}
+
+	answers := []*answer{
+		{Rcode: "NOERROR", Answers: []string{"ns1.example.com. hostmaster.example.com. 2 3600 600 86400 300"}, Serial: 2},
+		{Rcode: "NOERROR", Answers: []string{"ns2.example.com. hostmaster.example.com. 2 3600 600 86400 300"}, Serial: 2},
+		{Rcode: "NOERROR", Answers: []string{"ns1.example.com. hostmaster.example.com. 1 3600 600 86400 300"}, Serial: 1},
+		{Error: "i/o timeout"},
+	}
+	check := compareAnswers(soa, servers, answers)
+	c.Check(check.Consistent, Equals, false)
+	c.Check(check.Type, Equals, "SOA")
+	c.Assert(check.Variants, HasLen, 3)
+	c.Check(check.Variants[0].Serial, Equals, uint32(2))
+	c.Check(check.Variants[0].Servers, HasLen, 2)
+	c.Check(check.Variants[1].Serial, Equals, uint32(1))
+	c.Check(check.Variants[2].Error, Equals, "i/o timeout")
+	c.Check(check.Groups, DeepEquals, map[string]bool{"edge": true, "core": true})
+
+	// a server that doesn't answer doesn't make it inconsistent
+	answers[2].Serial = 2
+	check = compareAnswers(soa, servers, answers)
+	c.Check(check.Consistent, Equals, true)
+	c.Check(check.Variants, HasLen, 2)
+
+	a := &ProbeQuery{Name: "www.example.com.", Type: dns.TypeA}
+	answers = []*answer{
+		{Rcode: "NOERROR", Answers: []string{"192.0.2.10"}},
+		{Rcode: "NOERROR", Answers: []string{"192.0.2.11"}},
+		{Rcode: "NOERROR", Answers: []string{"192.0.2.10"}},
+		{Rcode: "NXDOMAIN", Answers: []string{}},
+	}
+	check = compareAnswers(a, servers, answers)
+	c.Check(check.Consistent, Equals, false)
+	c.Check(check.Variants, HasLen, 3)
+	c.Check(check.Variants[0].Answers, DeepEquals, []string{"192.0.2.10"})
+	c.Check(check.Groups, DeepEquals, map[string]bool{"edge": false, "core": false})
+}
+
+func (s *ConsistencySuite) TestCheck(c *C) {
+	stub := newStubDNS(c,
+		"www.example.com. 300 IN A 192.0.2.2",
+		"www.example.com. 300 IN A 192.0.2.1",
+		"example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 3600 600 86400 300",
+	)
+	defer stub.Close()
+
+	cfg := new(AppConfig)
+	cfg.Consistency.Zone = []string{"example.com"}
+	cfg.Consistency.Query = []string{"www.example.com A"}
+	cfg.Probe.Port = stub.Port
+	cfg.Probe.Timeout = "500ms"
+	cs, err := consistencySettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cs.Queries, HasLen, 2)
+	c.Check(cs.Timeout, Equals, 500*time.Millisecond)
+
+	cc := NewConsistencyChecker(cs)
+	reports := 0
+	cc.OnReport(func(*ConsistencyReport) { reports++ })
+
+	// nothing listens on 127.0.0.2
+	report := cc.Check([]*Status{
+		{IP: "127.0.0.1", Name: "ns1"},
+		{IP: "127.0.0.2", Name: "ns2"},
+		{IP: "", Name: "not resolved"},
+	})
+	c.Check(reports, Equals, 1)
+	c.Check(cc.Report(), Equals, report)
+	c.Check(report.Servers, Equals, 2)
+	c.Check(report.Divergent, Equals, 0)
+	c.Assert(report.Checks, HasLen, 2)
+
+	soa := report.Checks[0]
+	c.Check(soa.Name, Equals, "example.com.")
+	c.Check(soa.Consistent, Equals, true)
+	c.Assert(soa.Variants, HasLen, 2)
+	c.Check(soa.Variants[0].Serial, Equals, uint32(2024010101))
+	c.Check(soa.Variants[0].Servers[0].Name, Equals, "ns1")
+	c.Check(soa.Variants[1].Error, Not(Equals), "")
+
+	c.Check(report.Checks[1].Variants[0].Answers, DeepEquals, []string{"192.0.2.1", "192.0.2.2"})
+
+	// the same query twice is only checked once
+	zones, queries := cfg.Consistency.Zone, cfg.Consistency.Query
+	cfg.Consistency.Zone = append(zones, "Example.com.")
+	cfg.Consistency.Query = append(queries, "example.com soa", "www.example.com A ecs=192.0.2.0/24")
+	cs, err = consistencySettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Check(cs.Queries, HasLen, 3)
+	cfg.Consistency.Zone, cfg.Consistency.Query = zones, queries
+
+	cfg.Consistency.Interval = "10ms"
+	_, err = consistencySettingsFromConfig(cfg)
+	c.Check(err, ErrorMatches, "consistency interval must be at least 1s")
+	cfg.Consistency.Interval = ""
+	cfg.Consistency.Query = []string{"www.example.com"}
+	_, err = consistencySettingsFromConfig(cfg)
+	c.Check(err, ErrorMatches, "consistency: invalid probe query.*")
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v2"
+)
+
+// discoveryTimeout limits zone transfers and HTTP requests.
+const discoveryTimeout = 10 * time.Second
+
+// Target is a server found by a Discoverer: a name or IP and the
+// monitor endpoint to connect to.
+type Target struct {
+	Host     string
+	Endpoint Endpoint
+	Source   Provenance
+}
+
+// Discoverer finds servers to monitor, doing any lookups with the
+// resolver. Names in the targets are resolved by the hub.
+type Discoverer interface {
+	Discover(r Resolver) ([]Target, error)
+	String() string
+}
+
+// discoverersFromConfig returns a discoverer for each entry in the
+// [servers] section.
+func discoverersFromConfig(cfg *AppConfig) ([]Discoverer, error) {
+	endpoint := cfg.Endpoint()
+	discoverers := []Discoverer{}
+
+	for _, entry := range cfg.Servers.A {
+		host, ep, err := parseServerEntry(entry, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, &staticDiscoverer{entry: entry, host: host, endpoint: ep})
+	}
+	for _, entry := range cfg.Servers.Domain {
+		domain, ep, err := parseServerEntry(entry, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, &nsDiscoverer{entry: entry, domain: domain, endpoint: ep})
+	}
+	for _, entry := range cfg.Servers.Txt {
+		x := strings.SplitN(entry, ",", 2)
+		if len(x) != 2 {
+			return nil, fmt.Errorf("invalid txt '%s', expected name,base", entry)
+		}
+		discoverers = append(discoverers, &txtDiscoverer{
+			entry:    entry,
+			name:     strings.TrimSpace(x[0]),
+			base:     strings.TrimSpace(x[1]),
+			endpoint: endpoint,
+		})
+	}
+	for _, entry := range cfg.Servers.Srv {
+		name, ep, err := parseServerEntry(entry, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, &srvDiscoverer{entry: entry, name: name, endpoint: ep})
+	}
+	for _, entry := range cfg.Servers.Axfr {
+		d, err := newAXFRDiscoverer(entry, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, d)
+	}
+	for _, path := range cfg.Servers.File {
+		discoverers = append(discoverers, &fileDiscoverer{path: path, endpoint: endpoint})
+	}
+	for _, url := range cfg.Servers.URL {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return nil, fmt.Errorf("invalid url '%s', expected http:// or https://", url)
+		}
+		discoverers = append(discoverers, &httpDiscoverer{url: url, endpoint: endpoint})
+	}
+	return discoverers, nil
+}
+
+// staticDiscoverer is an a= entry.
+type staticDiscoverer struct {
+	entry    string
+	host     string
+	endpoint Endpoint
+}
+
+func (d *staticDiscoverer) String() string { return "a=" + d.entry }
+
+func (d *staticDiscoverer) Discover(r Resolver) ([]Target, error) {
+	return []Target{{
+		Host:     d.host,
+		Endpoint: d.endpoint,
+		Source:   Provenance{Source: "a", Config: d.String()},
+	}}, nil
+}
+
+// nsDiscoverer is a domain= entry; it finds the nameservers of the
+// domain.
+type nsDiscoverer struct {
+	entry    string
+	domain   string
+	endpoint Endpoint
+}
+
+func (d *nsDiscoverer) String() string { return "domain=" + d.entry }
+
+func (d *nsDiscoverer) Discover(r Resolver) ([]Target, error) {
+	nses, err := r.LookupNS(d.domain)
+	if err != nil {
+		return nil, err
+	}
+	targets := []Target{}
+	for _, ns := range nses {
+		targets = append(targets, Target{
+			Host:     ns,
+			Endpoint: d.endpoint,
+			Source:   Provenance{Source: "domain", Config: d.String()},
+		})
+	}
+	return targets, nil
+}
+
+// txtDiscoverer is a txt= entry; the TXT record of name has a space
+// separated list of names under base.
+type txtDiscoverer struct {
+	entry    string
+	name     string
+	base     string
+	endpoint Endpoint
+}
+
+func (d *txtDiscoverer) String() string { return "txt=" + d.entry }
+
+func (d *txtDiscoverer) Discover(r Resolver) ([]Target, error) {
+	txts, err := r.LookupTXT(d.name)
+	if err != nil {
+		return nil, err
+	}
+	targets := []Target{}
+	for _, txt := range txts {
+		for _, name := range strings.Fields(txt) {
+			targets = append(targets, Target{
+				Host:     name + "." + d.base,
+				Endpoint: d.endpoint,
+				Source:   Provenance{Source: "txt", Config: d.String()},
+			})
+		}
+	}
+	return targets, nil
+}
+
+// srvDiscoverer is a srv= entry; the SRV records give the servers and
+// their monitor ports.
+type srvDiscoverer struct {
+	entry    string
+	name     string
+	endpoint Endpoint
+}
+
+func (d *srvDiscoverer) String() string { return "srv=" + d.entry }
+
+func (d *srvDiscoverer) Discover(r Resolver) ([]Target, error) {
+	srvs, err := r.LookupSRV(d.name)
+	if err != nil {
+		return nil, err
+	}
+	targets := []Target{}
+	for _, srv := range srvs {
+		ep := d.endpoint
+		if srv.Port > 0 {
+			ep.Port = int(srv.Port)
+		}
+		targets = append(targets, Target{
+			Host:     srv.Target,
+			Endpoint: ep,
+			Source:   Provenance{Source: "srv", Config: d.String()},
+		})
+	}
+	return targets, nil
+}
+
+// axfrDiscoverer is an axfr=zone@server[:port] entry; every A and
+// AAAA record in the inventory zone is a server.
+type axfrDiscoverer struct {
+	entry    string
+	zone     string
+	server   string
+	endpoint Endpoint
+}
+
+func newAXFRDiscoverer(entry string, endpoint Endpoint) (*axfrDiscoverer, error) {
+	x := strings.SplitN(entry, "@", 2)
+	if len(x) != 2 || len(x[0]) == 0 || len(x[1]) == 0 {
+		return nil, fmt.Errorf("invalid axfr '%s', expected zone@server", entry)
+	}
+	server := strings.TrimSpace(x[1])
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	return &axfrDiscoverer{
+		entry:    entry,
+		zone:     dns.Fqdn(strings.TrimSpace(x[0])),
+		server:   server,
+		endpoint: endpoint,
+	}, nil
+}
+
+func (d *axfrDiscoverer) String() string { return "axfr=" + d.entry }
+
+func (d *axfrDiscoverer) Discover(r Resolver) ([]Target, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(d.zone)
+	t := &dns.Transfer{
+		DialTimeout:  discoveryTimeout,
+		ReadTimeout:  discoveryTimeout,
+		WriteTimeout: discoveryTimeout,
+	}
+	server, err := resolveAddr(r, d.server)
+	if err != nil {
+		return nil, err
+	}
+	envelopes, err := t.In(m, server)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []Target{}
+	for env := range envelopes {
+		if env.Error != nil {
+			return nil, env.Error
+		}
+		for _, rr := range env.RR {
+			var ip net.IP
+			switch rr := rr.(type) {
+			case *dns.A:
+				ip = rr.A
+			case *dns.AAAA:
+				ip = rr.AAAA
+			default:
+				continue
+			}
+			targets = append(targets, Target{
+				Host:     ip.String(),
+				Endpoint: d.endpoint,
+				Source: Provenance{
+					Source: "axfr",
+					Config: d.String(),
+					Name:   strings.TrimSuffix(rr.Header().Name, "."),
+				},
+			})
+		}
+	}
+	return targets, nil
+}
+
+// resolveAddr looks up the host of a host:port address with the
+// resolver, so discovery doesn't bypass the configured nameservers.
+func resolveAddr(r Resolver, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	ips, err := r.LookupIP(host)
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no addresses for '%s'", host)
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+// targetGroup is the Prometheus file and HTTP service discovery
+// format: targets as host[:port][/path] and labels that are kept as
+// the metadata of the servers.
+type targetGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// parseTargetGroups reads a list of target groups in JSON or YAML.
+func parseTargetGroups(data []byte, isYAML bool, endpoint Endpoint, src Provenance) ([]Target, error) {
+	groups := []targetGroup{}
+	var err error
+	if isYAML {
+		err = yaml.Unmarshal(data, &groups)
+	} else {
+		err = json.Unmarshal(data, &groups)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []Target{}
+	for _, group := range groups {
+		for _, entry := range group.Targets {
+			host, ep, err := parseServerEntry(entry, endpoint)
+			if err != nil {
+				return nil, err
+			}
+			s := src
+			s.Metadata = group.Labels
+			targets = append(targets, Target{Host: host, Endpoint: ep, Source: s})
+		}
+	}
+	return targets, nil
+}
+
+// fileDiscoverer is a file= entry, a JSON or (with a .yaml or .yml
+// extension) YAML file of target groups.
+type fileDiscoverer struct {
+	path     string
+	endpoint Endpoint
+}
+
+func (d *fileDiscoverer) String() string { return "file=" + d.path }
+
+func (d *fileDiscoverer) Discover(r Resolver) ([]Target, error) {
+	data, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(d.path))
+	isYAML := ext == ".yaml" || ext == ".yml"
+	targets, err := parseTargetGroups(data, isYAML, d.endpoint, Provenance{Source: "file", Config: d.String()})
+	if err != nil {
+		return nil, fmt.Errorf("could not read targets from %s: %s", d.path, err)
+	}
+	return targets, nil
+}
+
+// httpDiscoverer is a url= entry, an HTTP endpoint returning target
+// groups as JSON (or YAML, going by the content type).
+type httpDiscoverer struct {
+	url      string
+	endpoint Endpoint
+}
+
+func (d *httpDiscoverer) String() string { return "url=" + d.url }
+
+func (d *httpDiscoverer) Discover(r Resolver) ([]Target, error) {
+	dialer := &net.Dialer{Timeout: discoveryTimeout}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			addr, err := resolveAddr(r, addr)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Timeout: discoveryTimeout, Transport: transport}
+	res, err := client.Get(d.url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", d.url, res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	isYAML := strings.Contains(res.Header.Get("Content-Type"), "yaml")
+	targets, err := parseTargetGroups(data, isYAML, d.endpoint, Provenance{Source: "url", Config: d.String()})
+	if err != nil {
+		return nil, fmt.Errorf("could not read targets from %s: %s", d.url, err)
+	}
+	return targets, nil
+}
+
+// discoveryResult is what one discoverer found.
+type discoveryResult struct {
+	Discoverer Discoverer
+	Targets    []Target
+	Err        error
+	Duration   time.Duration
+}
+
+// discover runs the discoverers concurrently and returns their
+// results, in the order of the discoverers. Failures are logged; the
+// servers a failed discoverer found before aren't added again, but
+// aren't counted as missing either.
+func discover(discoverers []Discoverer, r Resolver) []*discoveryResult {
+	results := make([]*discoveryResult, len(discoverers))
+	done := make(chan bool)
+	for i, d := range discoverers {
+		go func(i int, d Discoverer) {
+			start := time.Now()
+			targets, err := d.Discover(r)
+			if err != nil {
+				log.Printf("Discovery with %s failed: %s", d, err)
+			} else {
+				log.Printf("Discovery with %s found %d servers", d, len(targets))
+			}
+			results[i] = &discoveryResult{
+				Discoverer: d,
+				Targets:    targets,
+				Err:        err,
+				Duration:   time.Since(start),
+			}
+			done <- true
+		}(i, d)
+	}
+	for range discoverers {
+		<-done
+	}
+	return results
+}
+
+// failedDiscoverers returns the configuration lines of the
+// discoverers that failed.
+func failedDiscoverers(results []*discoveryResult) []string {
+	failed := []string{}
+	for _, res := range results {
+		if res.Err != nil {
+			failed = append(failed, res.Discoverer.String())
+		}
+	}
+	return failed
+}
+
+// discoveredTargets returns the targets of all the results.
+func discoveredTargets(results []*discoveryResult) []Target {
+	targets := []Target{}
+	for _, res := range results {
+		targets = append(targets, res.Targets...)
+	}
+	return targets
+}
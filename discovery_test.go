@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	. "gopkg.in/check.v1"
+)
+
+type DiscoverySuite struct {
+	dir string
+}
+
+var _ = Suite(&DiscoverySuite{})
+
+func (s *DiscoverySuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "dnsmonitor-discovery")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *DiscoverySuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+func targetHosts(targets []Target) []string {
+	hosts := []string{}
+	for _, t := range targets {
+		hosts = append(hosts, t.Host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (s *DiscoverySuite) TestConfig(c *C) {
+	cfg := new(AppConfig)
+	cfg.Servers.A = []string{"192.0.2.1:9053"}
+	cfg.Servers.Axfr = []string{"inventory.example.com@192.0.2.53"}
+	cfg.Servers.URL = []string{"http://inventory.example.com/targets"}
+	discoverers, err := discoverersFromConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(discoverers, HasLen, 3)
+	c.Check(discoverers[1].(*axfrDiscoverer).server, Equals, "192.0.2.53:53")
+	c.Check(discoverers[2].String(), Equals, "url=http://inventory.example.com/targets")
+
+	targets := discoveredTargets(discover(discoverers[:1], systemResolver{}))
+	c.Assert(targets, HasLen, 1)
+	c.Check(targets[0].Endpoint.Port, Equals, 9053)
+	c.Check(targets[0].Source.Config, Equals, "a=192.0.2.1:9053")
+
+	cfg.Servers.Axfr = []string{"inventory.example.com"}
+	_, err = discoverersFromConfig(cfg)
+	c.Check(err, ErrorMatches, "invalid axfr 'inventory.example.com'.*")
+
+	cfg.Servers.Axfr = nil
+	cfg.Servers.URL = []string{"ftp://inventory.example.com/"}
+	_, err = discoverersFromConfig(cfg)
+	c.Check(err, ErrorMatches, "invalid url 'ftp://.*")
+}
+
+func (s *DiscoverySuite) TestFile(c *C) {
+	js := filepath.Join(s.dir, "targets.json")
+	c.Assert(ioutil.WriteFile(js, []byte(`[
+		{"targets": ["192.0.2.1", "ns2.example.com:9053/mon"], "labels": {"site": "ams"}}
+	]`), 0644), IsNil)
+	yml := filepath.Join(s.dir, "targets.yml")
+	c.Assert(ioutil.WriteFile(yml, []byte("- targets:\n  - 192.0.2.3\n  labels:\n    site: lax\n"), 0644), IsNil)
+
+	d := &fileDiscoverer{path: js, endpoint: defaultEndpoint}
+	targets, err := d.Discover(systemResolver{})
+	c.Assert(err, IsNil)
+	c.Assert(targets, HasLen, 2)
+	c.Check(targets[1].Host, Equals, "ns2.example.com")
+	c.Check(targets[1].Endpoint, Equals, Endpoint{Port: 9053, Path: "/mon"})
+	c.Check(targets[1].Source.Source, Equals, "file")
+	c.Check(targets[1].Source.Metadata, DeepEquals, map[string]string{"site": "ams"})
+
+	d = &fileDiscoverer{path: yml, endpoint: defaultEndpoint}
+	targets, err = d.Discover(systemResolver{})
+	c.Assert(err, IsNil)
+	c.Assert(targets, HasLen, 1)
+	c.Check(targets[0].Endpoint, Equals, defaultEndpoint)
+	c.Check(targets[0].Source.Metadata["site"], Equals, "lax")
+
+	c.Assert(ioutil.WriteFile(js, []byte(`{"targets": []}`), 0644), IsNil)
+	_, err = (&fileDiscoverer{path: js}).Discover(systemResolver{})
+	c.Check(err, ErrorMatches, "could not read targets from .*")
+}
+
+func (s *DiscoverySuite) TestHTTP(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/targets" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"targets": ["192.0.2.1", "192.0.2.2"]}]`))
+	}))
+	defer srv.Close()
+
+	d := &httpDiscoverer{url: srv.URL + "/targets", endpoint: defaultEndpoint}
+	targets, err := d.Discover(systemResolver{})
+	c.Assert(err, IsNil)
+	c.Check(targetHosts(targets), DeepEquals, []string{"192.0.2.1", "192.0.2.2"})
+	c.Check(targets[0].Source.Config, Equals, "url="+srv.URL+"/targets")
+
+	d = &httpDiscoverer{url: srv.URL + "/nope"}
+	_, err = d.Discover(systemResolver{})
+	c.Check(err, ErrorMatches, ".* returned 404 Not Found")
+}
+
+func (s *DiscoverySuite) TestAXFR(c *C) {
+	stub := newStubDNS(c,
+		"inventory.example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 86400 300",
+		"ams1.inventory.example.com. 300 IN A 192.0.2.1",
+		"ams1.inventory.example.com. 300 IN AAAA 2001:db8::1",
+		"lax1.inventory.example.com. 300 IN A 192.0.2.2",
+		"lax1.inventory.example.com. 300 IN TXT \"not a server\"",
+		"www.example.com. 300 IN A 192.0.2.80",
+	)
+	defer stub.Close()
+
+	server := net.JoinHostPort("127.0.0.1", strconv.Itoa(stub.Port))
+	d, err := newAXFRDiscoverer("inventory.example.com@"+server, defaultEndpoint)
+	c.Assert(err, IsNil)
+	targets, err := d.Discover(systemResolver{})
+	c.Assert(err, IsNil)
+	c.Check(targetHosts(targets), DeepEquals, []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"})
+	for _, t := range targets {
+		c.Check(t.Source.Source, Equals, "axfr")
+		if t.Host == "192.0.2.2" {
+			c.Check(t.Source.Name, Equals, "lax1.inventory.example.com")
+		}
+	}
+
+	d, _ = newAXFRDiscoverer("other.example.com@"+server, defaultEndpoint)
+	_, err = d.Discover(systemResolver{})
+	c.Check(err, NotNil)
+}
+
+func (s *DiscoverySuite) TestConfigure(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-6", "up": 10})
+	defer fm.Close()
+	ip, ep := fm.Endpoint()
+
+	js := filepath.Join(s.dir, "targets.json")
+	target := net.JoinHostPort(ip.String(), strconv.Itoa(ep.Port))
+	c.Assert(ioutil.WriteFile(js, []byte(`[{"targets": ["`+target+`"], "labels": {"site": "test"}}]`), 0644), IsNil)
+
+	cfg := new(AppConfig)
+	cfg.Servers.File = []string{js}
+	hub := NewHub()
+	defer hub.Stop()
+	configure(hub, cfg)
+
+	st := waitStatus(c, hub, func(st *Status) bool { return st.Uptime > 0 })
+	c.Assert(st.Sources, HasLen, 1)
+	c.Check(st.Sources[0].Config, Equals, "file="+js)
+	c.Check(st.Sources[0].Metadata["site"], Equals, "test")
+
+	// the file can't be read, which doesn't mean the server is gone
+	os.Remove(js)
+	configure(hub, cfg)
+	c.Assert(hub.Status(), HasLen, 1)
+	c.Check(hub.Status()[0].PendingRemoval, Equals, false)
+
+	// the server is gone from the file
+	c.Assert(ioutil.WriteFile(js, []byte(`[]`), 0644), IsNil)
+	configure(hub, cfg)
+	c.Check(hub.Status(), HasLen, 0)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceStatus is how the last discovery run went for one entry in
+// the [servers] section.
+type SourceStatus struct {
+	// Source and Config are as in Provenance.
+	Source      string    `json:"source"`
+	Config      string    `json:"config"`
+	OK          bool      `json:"ok"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSuccess time.Time `json:"last_success"`
+	// Duration is how long the discoverer took, in seconds.
+	Duration float64 `json:"duration"`
+	// Error is why the discoverer failed, if it did.
+	Error string `json:"error"`
+	// Failures are the targets that couldn't be added, as
+	// "host: error".
+	Failures []string `json:"failures"`
+	// Targets is the number of targets found.
+	Targets int `json:"targets"`
+	// ConsecutiveFailures is the number of runs in a row that
+	// weren't OK.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+}
+
+func (ss *SourceStatus) failed(host string, err error) {
+	ss.Failures = append(ss.Failures, fmt.Sprintf("%s: %s", host, err))
+}
+
+// AddError is a target that couldn't be added to the hub.
+type AddError struct {
+	Host   string
+	Source Provenance
+	Err    error
+}
+
+func (e *AddError) Error() string {
+	return fmt.Sprintf("error adding server '%s': %s", e.Host, e.Err)
+}
+
+// discoveryRun collects the results of one configuration run.
+type discoveryRun struct {
+	started  time.Time
+	sources  []*SourceStatus
+	byConfig map[string]*SourceStatus
+}
+
+func newDiscoveryRun(results []*discoveryResult, started time.Time) *discoveryRun {
+	run := &discoveryRun{
+		started:  started,
+		sources:  []*SourceStatus{},
+		byConfig: make(map[string]*SourceStatus),
+	}
+	for _, res := range results {
+		config := res.Discoverer.String()
+		ss := &SourceStatus{
+			Source:      strings.SplitN(config, "=", 2)[0],
+			Config:      config,
+			LastAttempt: started,
+			Duration:    res.Duration.Seconds(),
+			Targets:     len(res.Targets),
+			Failures:    []string{},
+		}
+		if res.Err != nil {
+			ss.Error = res.Err.Error()
+		}
+		run.sources = append(run.sources, ss)
+		run.byConfig[config] = ss
+	}
+	return run
+}
+
+// addFailed records a target that couldn't be added.
+func (run *discoveryRun) addFailed(ae *AddError) {
+	if ss, ok := run.byConfig[ae.Source.Config]; ok {
+		ss.failed(ae.Host, ae.Err)
+	}
+}
+
+// DiscoveryStatus is the state of server discovery.
+type DiscoveryStatus struct {
+	LastRun time.Time `json:"last_run"`
+	// Duration is how long the last run took, in seconds.
+	Duration float64         `json:"duration"`
+	Failing  int             `json:"failing"`
+	Sources  []*SourceStatus `json:"sources"`
+}
+
+// DiscoveryTracker keeps the results of the last discovery run,
+// and when each entry last worked.
+type DiscoveryTracker struct {
+	sync.RWMutex
+	status DiscoveryStatus
+}
+
+func NewDiscoveryTracker() *DiscoveryTracker {
+	return &DiscoveryTracker{status: DiscoveryStatus{Sources: []*SourceStatus{}}}
+}
+
+// Record replaces the status with the results of a finished run.
+// Entries that are no longer configured are dropped.
+func (dt *DiscoveryTracker) Record(run *discoveryRun, finished time.Time) {
+	dt.Lock()
+	defer dt.Unlock()
+
+	prev := make(map[string]*SourceStatus)
+	for _, ss := range dt.status.Sources {
+		prev[ss.Config] = ss
+	}
+
+	failing := 0
+	for _, ss := range run.sources {
+		ss.OK = len(ss.Error) == 0 && len(ss.Failures) == 0
+		if p, ok := prev[ss.Config]; ok {
+			ss.LastSuccess = p.LastSuccess
+			ss.ConsecutiveFailures = p.ConsecutiveFailures
+		}
+		if ss.OK {
+			ss.LastSuccess = ss.LastAttempt
+			ss.ConsecutiveFailures = 0
+		} else {
+			ss.ConsecutiveFailures++
+			failing++
+		}
+	}
+
+	dt.status = DiscoveryStatus{
+		LastRun:  run.started,
+		Duration: finished.Sub(run.started).Seconds(),
+		Failing:  failing,
+		Sources:  run.sources,
+	}
+}
+
+// Status returns a copy of the discovery status.
+func (dt *DiscoveryTracker) Status() DiscoveryStatus {
+	dt.RLock()
+	defer dt.RUnlock()
+	status := dt.status
+	status.Sources = make([]*SourceStatus, 0, len(dt.status.Sources))
+	for _, ss := range dt.status.Sources {
+		copied := *ss
+		copied.Failures = append([]string{}, ss.Failures...)
+		status.Sources = append(status.Sources, &copied)
+	}
+	return status
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type DiscoveryStatusSuite struct{}
+
+var _ = Suite(&DiscoveryStatusSuite{})
+
+func (s *DiscoveryStatusSuite) TestRecord(c *C) {
+	ns := &nsDiscoverer{entry: "example.com", domain: "example.com"}
+	static := &staticDiscoverer{entry: "ns1.example.com", host: "ns1.example.com"}
+	start := time.Now()
+
+	dt := NewDiscoveryTracker()
+	run := newDiscoveryRun([]*discoveryResult{
+		{Discoverer: ns, Targets: []Target{{Host: "a"}, {Host: "b"}}},
+		{Discoverer: static, Targets: []Target{{Host: "ns1.example.com"}}},
+	}, start)
+	run.addFailed(&AddError{Host: "ns1.example.com", Source: Provenance{Config: static.String()}, Err: errors.New("no such host")})
+	dt.Record(run, start.Add(time.Second))
+
+	status := dt.Status()
+	c.Check(status.Duration, Equals, 1.0)
+	c.Check(status.Failing, Equals, 1)
+	c.Assert(status.Sources, HasLen, 2)
+	c.Check(status.Sources[0].Source, Equals, "domain")
+	c.Check(status.Sources[0].OK, Equals, true)
+	c.Check(status.Sources[0].Targets, Equals, 2)
+	c.Check(status.Sources[0].LastSuccess.Equal(start), Equals, true)
+	c.Check(status.Sources[1].OK, Equals, false)
+	c.Check(status.Sources[1].Failures, DeepEquals, []string{"ns1.example.com: no such host"})
+	c.Check(status.Sources[1].LastSuccess.IsZero(), Equals, true)
+
+	// the domain lookup fails, the a= entry is gone
+	later := start.Add(time.Minute)
+	run = newDiscoveryRun([]*discoveryResult{{Discoverer: ns, Err: errors.New("SERVFAIL")}}, later)
+	dt.Record(run, later)
+	run = newDiscoveryRun([]*discoveryResult{{Discoverer: ns, Err: errors.New("SERVFAIL")}}, later)
+	dt.Record(run, later)
+
+	status = dt.Status()
+	c.Assert(status.Sources, HasLen, 1)
+	c.Check(status.Sources[0].OK, Equals, false)
+	c.Check(status.Sources[0].Error, Equals, "SERVFAIL")
+	c.Check(status.Sources[0].ConsecutiveFailures, Equals, 2)
+	c.Check(status.Sources[0].LastSuccess.Equal(start), Equals, true)
+	c.Check(status.Sources[0].LastAttempt.Equal(later), Equals, true)
+
+	rules, _ := alertRulesFromConfig(map[string]*AlertConfig{
+		"discovery": {Type: "discovery", Threshold: 2},
+	})
+	e := NewAlertEngine(rules)
+	e.SetDiscovery(dt)
+	transitions := e.Evaluate(nil, later)
+	c.Assert(transitions, HasLen, 1)
+	c.Check(transitions[0].Subject, Equals, "domain=example.com")
+	c.Check(transitions[0].Message, Equals, "failed 2 times: SERVFAIL")
+}
+
+func (s *DiscoveryStatusSuite) TestConfigure(c *C) {
+	stub := newStubDNS(c)
+	defer stub.Close()
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-11", "up": 10})
+	defer fm.Close()
+	ip, ep := fm.Endpoint()
+
+	rcfg := new(AppConfig)
+	rcfg.Resolver.Nameserver = []string{net.JoinHostPort("127.0.0.1", strconv.Itoa(stub.Port))}
+	rs, err := resolverSettingsFromConfig(rcfg)
+	c.Assert(err, IsNil)
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetResolver(NewResolver(rs))
+
+	cfg := new(AppConfig)
+	cfg.Servers.Port = ep.Port
+	cfg.Servers.A = []string{ip.String(), "missing.example.test"}
+	cfg.Servers.Domain = []string{"missing.example.test"}
+	configure(hub, cfg)
+
+	srv := httptest.NewServer(setupMux(hub))
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/api/discovery")
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	status := new(DiscoveryStatus)
+	c.Assert(json.NewDecoder(res.Body).Decode(status), IsNil)
+
+	c.Check(status.Failing, Equals, 2)
+	c.Assert(status.Sources, HasLen, 3)
+	c.Check(status.Sources[0].Config, Equals, "a="+ip.String())
+	c.Check(status.Sources[0].OK, Equals, true)
+	c.Check(status.Sources[1].Config, Equals, "a=missing.example.test")
+	c.Assert(status.Sources[1].Failures, HasLen, 1)
+	c.Check(status.Sources[1].Failures[0], Matches, "missing.example.test: .*NXDOMAIN.*")
+	c.Check(status.Sources[2].Source, Equals, "domain")
+	c.Check(status.Sources[2].Targets, Equals, 0)
+	c.Check(status.Sources[2].Error, Matches, "lookup missing.example.test. NS: .*NXDOMAIN.*")
+}
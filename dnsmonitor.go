@@ -3,10 +3,14 @@ package main
 //go:generate esc -o static.go -ignore .DS_Store -prefix static templates static
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -42,18 +46,174 @@ func main() {
 
 	loadBundle()
 
+	cm, err := NewConfigManager(*configFile)
+	if err != nil {
+		os.Exit(2)
+	}
+	cfg := cm.Config()
+
 	hub := NewHub()
+	hub.SetConfigManager(cm)
+
+	setupResolver(hub, cm)
+	setupState(hub, cfg)
+	setupConnections(hub, cm)
+	setupProbes(hub, cm)
+	setupConsistency(hub, cm)
+	setupHistory(hub, cfg)
+	dispatcher := setupAlerts(hub, cm)
+
+	srv, err := startHTTP(cfg, hub)
+	if err != nil {
+		log.Printf("Could not start HTTP server: %s", err)
+		os.Exit(2)
+	}
+
+	go cm.Run(hub)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	log.Printf("Got %s, shutting down", <-sig)
+
+	go func() {
+		log.Printf("Got %s again, exiting", <-sig)
+		os.Exit(1)
+	}()
 
-	go startHTTP(2090, hub)
+	shutdown(cm, hub, srv, dispatcher)
+}
+
+// shutdownTimeout is how long a clean shutdown may take.
+const shutdownTimeout = 10 * time.Second
+
+// shutdown stops discovery, alerting and the consistency checks,
+// delivers queued notifications, closes the server connections and
+// sinks (saving the history) and finally the HTTP server. Whatever
+// hasn't finished after shutdownTimeout is abandoned.
+func shutdown(cm *ConfigManager, hub *StatusHub, srv *http.Server, dispatcher *Dispatcher) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
+	done := make(chan bool)
 	go func() {
-		for {
-			log.Println("running configuration...")
-			configure(hub)
-			time.Sleep(20 * time.Second)
+		defer close(done)
+
+		cm.Stop()
+		if alerts := hub.Alerts(); alerts != nil {
+			alerts.Stop()
+		}
+		if cc := hub.Consistency(); cc != nil {
+			cc.Stop()
+		}
+		dispatcher.Close()
+
+		// this also saves the state and ends the /api/stream requests
+		hub.Stop()
+
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			log.Printf("Could not shut down the HTTP server: %s", err)
 		}
 	}()
 
-	quit := make(chan bool)
-	<-quit
+	select {
+	case <-done:
+		log.Println("Shutdown complete")
+	case <-ctx.Done():
+		log.Println("Shutdown timed out")
+	}
+}
+
+func setupState(hub *StatusHub, cfg *AppConfig) {
+	if len(cfg.State.Path) == 0 {
+		return
+	}
+	ss := NewStateStore(cfg.State.Path)
+	servers, err := ss.Load()
+	if err != nil {
+		// start without it rather than not at all
+		log.Println(err)
+	}
+	hub.SetStateStore(ss)
+	hub.Restore(servers)
+	go ss.Run(hub, cfg.StateInterval())
+}
+
+func setupResolver(hub *StatusHub, cm *ConfigManager) {
+	// the configuration has already been validated
+	rs, _ := resolverSettingsFromConfig(cm.Config())
+	hub.SetResolver(NewResolver(rs))
+	cm.OnReload(func(cfg *AppConfig) {
+		rs, _ := resolverSettingsFromConfig(cfg)
+		hub.SetResolver(NewResolver(rs))
+	})
+}
+
+func setupConnections(hub *StatusHub, cm *ConfigManager) {
+	// the configuration has already been validated
+	cs, _ := connectionSettingsFromConfig(cm.Config())
+	hub.SetConnectionSettings(cs)
+	cm.OnReload(func(cfg *AppConfig) {
+		cs, _ := connectionSettingsFromConfig(cfg)
+		hub.SetConnectionSettings(cs)
+	})
+}
+
+func setupProbes(hub *StatusHub, cm *ConfigManager) {
+	// the configuration has already been validated
+	ps, _ := probeSettingsFromConfig(cm.Config())
+	hub.SetProbeSettings(ps)
+	cm.OnReload(func(cfg *AppConfig) {
+		ps, _ := probeSettingsFromConfig(cfg)
+		hub.SetProbeSettings(ps)
+	})
+}
+
+func setupConsistency(hub *StatusHub, cm *ConfigManager) {
+	// the configuration has already been validated
+	cs, _ := consistencySettingsFromConfig(cm.Config())
+	cc := NewConsistencyChecker(cs)
+	serials := NewSerialTracker()
+	cc.OnReport(serials.Update)
+	cm.OnReload(func(cfg *AppConfig) {
+		cs, _ := consistencySettingsFromConfig(cfg)
+		cc.SetSettings(cs)
+	})
+	go cc.Run(hub)
+	hub.SetConsistency(cc)
+	hub.SetSerials(serials)
+}
+
+func setupHistory(hub *StatusHub, cfg *AppConfig) {
+	if len(cfg.History.Path) == 0 {
+		return
+	}
+	store, err := NewSeriesStore(cfg.History.Path, cfg.History.Tier)
+	if err != nil {
+		log.Printf("Could not open history store: %s", err)
+		os.Exit(2)
+	}
+	go store.Run(time.Minute)
+	hub.SetHistory(store)
+}
+
+func setupAlerts(hub *StatusHub, cm *ConfigManager) *Dispatcher {
+	// the configuration has already been validated
+	cfg := cm.Config()
+	rules, _ := alertRulesFromConfig(cfg.Alert)
+	dispatcher, _ := NewDispatcher(cfg.Notify)
+
+	alerts := NewAlertEngine(rules)
+	alerts.OnTransition(dispatcher.Dispatch)
+	alerts.SetDiscovery(hub.Discovery())
+
+	cm.OnReload(func(cfg *AppConfig) {
+		rules, _ := alertRulesFromConfig(cfg.Alert)
+		alerts.SetRules(rules)
+		dispatcher.Reconfigure(cfg.Notify)
+	})
+
+	go alerts.Run(hub, alertInterval)
+	hub.SetAlerts(alerts)
+	return dispatcher
 }
@@ -11,6 +11,10 @@ func Test(t *testing.T) { TestingT(t) }
 
 func TestConfig(t *testing.T) {
 	hub := NewHub()
-	configure(hub)
+	cfg, err := configRead("dnsmonitor.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configure(hub, cfg)
 
 }
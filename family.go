@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Family selects the address families servers are monitored on.
+type Family int
+
+const (
+	FamilyBoth Family = iota
+	FamilyIPv4
+	FamilyIPv6
+)
+
+func (f Family) String() string {
+	switch f {
+	case FamilyIPv4:
+		return "ipv4"
+	case FamilyIPv6:
+		return "ipv6"
+	}
+	return "both"
+}
+
+// parseFamily parses the [servers] family setting.
+func parseFamily(s string) (Family, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "both", "dual":
+		return FamilyBoth, nil
+	case "ipv4", "v4", "4":
+		return FamilyIPv4, nil
+	case "ipv6", "v6", "6":
+		return FamilyIPv6, nil
+	}
+	return FamilyBoth, fmt.Errorf("invalid family '%s', expected both, ipv4 or ipv6", s)
+}
+
+// Allows returns true if servers at ip should be monitored.
+func (f Family) Allows(ip net.IP) bool {
+	switch f {
+	case FamilyIPv4:
+		return ip.To4() != nil
+	case FamilyIPv6:
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// ipFamily returns "ipv4" or "ipv6" for the address, or "" if it
+// isn't one.
+func ipFamily(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	if addr.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// familyConfig holds the family setting for the hub's lookups.
+type familyConfig struct {
+	sync.RWMutex
+	family Family
+}
+
+func (fc *familyConfig) Family() Family {
+	fc.RLock()
+	defer fc.RUnlock()
+	return fc.family
+}
+
+func (fc *familyConfig) Set(f Family) {
+	fc.Lock()
+	defer fc.Unlock()
+	fc.family = f
+}
+
+// FamilyHealth is how a server is doing over one address family.
+type FamilyHealth struct {
+	IP           string    `json:"ip"`
+	Status       string    `json:"status"`
+	DNSStatus    string    `json:"dns_status"`
+	ResponseTime float64   `json:"response_time"`
+	LastSeen     time.Time `json:"last_seen"`
+	Healthy      bool      `json:"healthy"`
+}
+
+// LogicalServer is a server with its connections over IPv4 and IPv6
+// grouped by the UUID it reports.
+type LogicalServer struct {
+	UUID      string                     `json:"uuid"`
+	Name      string                     `json:"name"`
+	Groups    []string                   `json:"groups"`
+	DualStack bool                       `json:"dual_stack"`
+	Healthy   bool                       `json:"healthy"`
+	Families  map[string][]*FamilyHealth `json:"families"`
+}
+
+// healthy returns true if the connection works and the DNS probes,
+// if there are any, are fine.
+func (st *Status) healthy() bool {
+	return st.Status == "Ok" && (len(st.DNSStatus) == 0 || st.DNSStatus == "ok")
+}
+
+// logicalServers groups the statuses by UUID. Servers that haven't
+// reported a UUID yet are on their own.
+func logicalServers(statuses []*Status) []*LogicalServer {
+	byUUID := make(map[string]*LogicalServer)
+	servers := []*LogicalServer{}
+	for _, st := range statuses {
+		key := st.UUID
+		if len(key) == 0 {
+			key = "ip:" + st.IP
+		}
+		ls, ok := byUUID[key]
+		if !ok {
+			ls = &LogicalServer{
+				UUID:     st.UUID,
+				Healthy:  true,
+				Families: make(map[string][]*FamilyHealth),
+			}
+			byUUID[key] = ls
+			servers = append(servers, ls)
+		}
+		if len(st.Name) > 0 {
+			ls.Name = st.Name
+		}
+		if len(st.Groups) > 0 {
+			ls.Groups = st.Groups
+		}
+		fh := &FamilyHealth{
+			IP:           st.IP,
+			Status:       st.Status,
+			DNSStatus:    st.DNSStatus,
+			ResponseTime: st.ResponseTime,
+			LastSeen:     st.LastSeen,
+			Healthy:      st.healthy(),
+		}
+		family := ipFamily(st.IP)
+		ls.Families[family] = append(ls.Families[family], fh)
+		ls.Healthy = ls.Healthy && fh.Healthy
+		ls.DualStack = len(ls.Families["ipv4"]) > 0 && len(ls.Families["ipv6"]) > 0
+	}
+	for _, ls := range servers {
+		for _, fhs := range ls.Families {
+			sort.Sort(familyHealthByIP(fhs))
+		}
+	}
+	sort.Sort(logicalServersByName(servers))
+	return servers
+}
+
+type familyHealthByIP []*FamilyHealth
+
+func (s familyHealthByIP) Len() int           { return len(s) }
+func (s familyHealthByIP) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s familyHealthByIP) Less(i, j int) bool { return s[i].IP < s[j].IP }
+
+type logicalServersByName []*LogicalServer
+
+func (s logicalServersByName) Len() int      { return len(s) }
+func (s logicalServersByName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s logicalServersByName) Less(i, j int) bool {
+	if s[i].Name != s[j].Name {
+		return s[i].Name < s[j].Name
+	}
+	return s[i].UUID < s[j].UUID
+}
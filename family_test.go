@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+
+	. "gopkg.in/check.v1"
+)
+
+type FamilySuite struct{}
+
+var _ = Suite(&FamilySuite{})
+
+func (s *FamilySuite) TestParse(c *C) {
+	for str, family := range map[string]Family{"": FamilyBoth, "both": FamilyBoth, "IPv4": FamilyIPv4, "v6": FamilyIPv6} {
+		f, err := parseFamily(str)
+		c.Check(err, IsNil)
+		c.Check(f, Equals, family)
+	}
+	_, err := parseFamily("ipx")
+	c.Check(err, ErrorMatches, "invalid family 'ipx'.*")
+
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+	c.Check(FamilyIPv4.Allows(v4), Equals, true)
+	c.Check(FamilyIPv4.Allows(v6), Equals, false)
+	c.Check(FamilyIPv6.Allows(v4), Equals, false)
+	c.Check(FamilyIPv6.Allows(v6), Equals, true)
+	c.Check(FamilyBoth.Allows(v6), Equals, true)
+
+	c.Check(ipFamily("::ffff:192.0.2.1"), Equals, "ipv4")
+	c.Check(ipFamily("2001:db8::1"), Equals, "ipv6")
+}
+
+func (s *FamilySuite) TestLogical(c *C) {
+	servers := logicalServers([]*Status{
+		{Name: "ns1", UUID: "uuid-a", IP: "192.0.2.1", Status: "Ok", DNSStatus: "ok"},
+		{Name: "ns1", UUID: "uuid-a", IP: "2001:db8::1", Status: "Ok", DNSStatus: "www.example.com. A/udp: i/o timeout"},
+		{Name: "ns2", UUID: "uuid-b", IP: "192.0.2.2", Status: "Ok"},
+		{IP: "192.0.2.3", Status: "connecting"},
+	})
+	c.Assert(servers, HasLen, 3)
+
+	c.Check(servers[0].UUID, Equals, "")
+	c.Check(servers[0].Healthy, Equals, false)
+
+	ns1 := servers[1]
+	c.Check(ns1.Name, Equals, "ns1")
+	c.Check(ns1.DualStack, Equals, true)
+	c.Check(ns1.Healthy, Equals, false)
+	c.Check(ns1.Families["ipv4"][0].Healthy, Equals, true)
+	c.Check(ns1.Families["ipv6"][0].Healthy, Equals, false)
+	c.Check(ns1.Families["ipv6"][0].IP, Equals, "2001:db8::1")
+
+	c.Check(servers[2].DualStack, Equals, false)
+	c.Check(servers[2].Healthy, Equals, true)
+}
+
+func (s *FamilySuite) TestDualStack(c *C) {
+	update := map[string]interface{}{"id": "ns1", "uuid": "uuid-ds", "up": 10}
+	fm4 := newFakeMonitor(update)
+	defer fm4.Close()
+	fm6, err := newFakeMonitorAt("[::1]:0", update)
+	if err != nil {
+		c.Skip("no IPv6 loopback: " + err.Error())
+	}
+	defer fm6.Close()
+
+	hub := NewHub()
+	defer hub.Stop()
+	ip4, ep4 := fm4.Endpoint()
+	ip6, ep6 := fm6.Endpoint()
+	c.Assert(hub.AddNameEndpoint(ip4.String(), ep4), IsNil)
+	c.Assert(hub.AddNameEndpoint(ip6.String(), ep6), IsNil)
+
+	waitStatus(c, hub, func(st *Status) bool { return st.Family == "ipv6" && st.UUID == "uuid-ds" })
+	waitStatus(c, hub, func(st *Status) bool { return st.Family == "ipv4" && st.UUID == "uuid-ds" })
+
+	// both connections are kept and make up one server
+	statuses := hub.Status()
+	c.Check(statuses, HasLen, 2)
+	servers := logicalServers(statuses)
+	c.Assert(servers, HasLen, 1)
+	c.Check(servers[0].DualStack, Equals, true)
+}
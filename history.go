@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// maxHistoryPoints limits how many points the history API returns.
+// Without a step it picks one that gives at most this many.
+const maxHistoryPoints = 300
+
+// parseHistoryTime accepts unix timestamps, RFC3339 times and
+// durations relative to now ("-6h").
+func parseHistoryTime(str string, now time.Time, def time.Time) (time.Time, error) {
+	str = strings.TrimSpace(str)
+	if len(str) == 0 {
+		return def, nil
+	}
+	if ts, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, str); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(str); err == nil {
+		return now.Add(d), nil
+	}
+	return def, fmt.Errorf("could not parse time '%s'", str)
+}
+
+func parseHistoryStep(str string) (time.Duration, error) {
+	str = strings.TrimSpace(str)
+	if len(str) == 0 {
+		return 0, nil
+	}
+	if secs, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("could not parse step '%s'", str)
+	}
+	return d, nil
+}
+
+type historyQuery struct {
+	from, to time.Time
+	step     time.Duration
+}
+
+func parseHistoryQuery(r *rest.Request) (*historyQuery, error) {
+	now := time.Now()
+	params := r.URL.Query()
+
+	q := new(historyQuery)
+	var err error
+
+	q.to, err = parseHistoryTime(params.Get("to"), now, now)
+	if err != nil {
+		return nil, err
+	}
+	if q.to.After(now) {
+		q.to = now
+	}
+	q.from, err = parseHistoryTime(params.Get("from"), now, q.to.Add(-1*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	if !q.from.Before(q.to) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	q.step, err = parseHistoryStep(params.Get("step"))
+	if err != nil {
+		return nil, err
+	}
+	if q.step == 0 {
+		// whole seconds, rounded up so there are no more than
+		// maxHistoryPoints
+		secs := math.Ceil(q.to.Sub(q.from).Seconds() / maxHistoryPoints)
+		q.step = time.Duration(secs) * time.Second
+	}
+	return q, nil
+}
+
+func writeHistory(w rest.ResponseWriter, r *rest.Request, store *SeriesStore, ips []string, extra map[string]interface{}) {
+	q, err := parseHistoryQuery(r)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if step := store.Step(q.from, q.step); q.to.Sub(q.from)/step > maxHistoryPoints {
+		rest.Error(w, fmt.Sprintf("Too many points, the step must be at least %s", q.to.Sub(q.from)/maxHistoryPoints), http.StatusBadRequest)
+		return
+	}
+
+	points, step := store.Query(ips, q.from, q.to, q.step)
+
+	rv := map[string]interface{}{
+		"from":   q.from.Unix(),
+		"to":     q.to.Unix(),
+		"step":   int64(step.Seconds()),
+		"points": points,
+	}
+	for k, v := range extra {
+		rv[k] = v
+	}
+	w.WriteJson(rv)
+}
+
+func historyHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		store := hub.History()
+		if store == nil {
+			rest.Error(w, "History is not enabled", http.StatusNotFound)
+			return
+		}
+
+		ip := r.PathParam("ip")
+		if !store.Known(ip) {
+			rest.Error(w, "No history for "+ip, http.StatusNotFound)
+			return
+		}
+
+		writeHistory(w, r, store, []string{ip}, map[string]interface{}{"ip": ip})
+	}
+}
+
+func groupHistoryHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		store := hub.History()
+		if store == nil {
+			rest.Error(w, "History is not enabled", http.StatusNotFound)
+			return
+		}
+
+		group := r.PathParam("group")
+
+		// a dual-stack server is counted once
+		ips := []string{}
+		uuids := make(map[string]bool)
+		for _, st := range hub.Status() {
+			if len(st.UUID) > 0 && uuids[st.UUID] {
+				continue
+			}
+			for _, g := range st.Groups {
+				if g == group {
+					ips = append(ips, st.IP)
+					uuids[st.UUID] = true
+					break
+				}
+			}
+		}
+		if len(ips) == 0 {
+			rest.Error(w, "No servers in group "+group, http.StatusNotFound)
+			return
+		}
+
+		writeHistory(w, r, store, ips, map[string]interface{}{"group": group, "servers": ips})
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"crypto/tls"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -20,50 +23,182 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(templateFile)
 }
 
-func statusHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
-	return func(w rest.ResponseWriter, _ *rest.Request) {
+// apiStatus is a Status with the human readable durations the
+// dashboard shows.
+type apiStatus struct {
+	Status
+	LastUpdatedAgo string `json:"last_update"`
+	Restarted      string `json:"uptime_p"`
+}
 
-		currentStatus := hub.Status()
+func newAPIStatus(st *Status) *apiStatus {
+	var lastUpdatedAgoStr, uptimeStr string
 
-		type apiStatus struct {
-			Status
-			LastUpdatedAgo string `json:"last_update"`
-			Restarted      string `json:"uptime_p"`
-		}
+	lastUpdatedAgo := DayDuration{time.Since(st.LastStatusUpdate)}
+	uptime := DayDuration{time.Since(time.Unix(time.Now().Unix()-st.Uptime, 0))}
 
-		byIP := make(map[string]*apiStatus)
+	if uptime.Seconds() <= lastUpdatedAgo.Seconds() {
+		uptimeStr = ""
+	} else {
+		uptimeStr = uptime.DayString()
+	}
 
-		for _, st := range currentStatus {
+	if lastUpdatedAgo.Seconds() > 1 {
+		lastUpdatedAgoStr = lastUpdatedAgo.DayString()
+	} else {
+		lastUpdatedAgoStr = "now"
+	}
 
-			var lastUpdatedAgoStr, uptimeStr string
+	return &apiStatus{
+		*st,
+		lastUpdatedAgoStr,
+		uptimeStr,
+	}
+}
 
-			lastUpdatedAgo := DayDuration{time.Since(st.LastStatusUpdate)}
-			uptime := DayDuration{time.Since(time.Unix(time.Now().Unix()-st.Uptime, 0))}
+// statusHandler returns the servers in the latest snapshot. With
+// ?since=N only the servers that changed after generation N and the
+// IPs of the ones removed are returned.
+func statusHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		snap := hub.Snapshot()
 
-			if uptime.Seconds() <= lastUpdatedAgo.Seconds() {
-				uptimeStr = ""
-			} else {
-				uptimeStr = uptime.DayString()
+		byIP := func(statuses []*Status) map[string]*apiStatus {
+			rv := make(map[string]*apiStatus)
+			for _, st := range statuses {
+				rv[st.IP] = newAPIStatus(st)
 			}
+			return rv
+		}
 
-			if lastUpdatedAgo.Seconds() > 1 {
-				lastUpdatedAgoStr = lastUpdatedAgo.DayString()
-			} else {
-				lastUpdatedAgoStr = "now"
+		if since := r.URL.Query().Get("since"); len(since) > 0 {
+			generation, err := strconv.ParseUint(since, 10, 64)
+			if err != nil {
+				rest.Error(w, "Invalid generation "+since, http.StatusBadRequest)
+				return
 			}
+			changes := snap.ChangesSince(generation)
+			w.WriteJson(map[string]interface{}{
+				"generation": changes.Generation,
+				"since":      changes.Since,
+				"full":       changes.Full,
+				"servers":    byIP(changes.Servers),
+				"removed":    changes.Removed,
+			})
+			return
+		}
 
-			rv := &apiStatus{
-				*st,
-				lastUpdatedAgoStr,
-				uptimeStr,
-			}
+		currentStatus := snap.Statuses()
+		w.WriteJson(map[string]interface{}{
+			"generation": snap.Generation,
+			"servers":    byIP(currentStatus),
+			"logical":    logicalServers(currentStatus),
+		})
+	}
+}
+
+// serverHandler returns the status of one server, including where
+// the configuration found it.
+func serverHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		ip := r.PathParam("ip")
+		st := hub.Snapshot().Server(ip)
+		if st == nil {
+			rest.Error(w, "Unknown server "+ip, http.StatusNotFound)
+			return
+		}
+		w.WriteJson(newAPIStatus(st))
+	}
+}
+
+// pinHandler pins (PUT) or unpins (DELETE) a server, so it's kept
+// even when discovery doesn't find it.
+func pinHandler(hub *StatusHub, pinned bool) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		ip := r.PathParam("ip")
+		st := hub.Pin(ip, pinned)
+		if st == nil {
+			rest.Error(w, "Unknown server "+ip, http.StatusNotFound)
+			return
+		}
+		w.WriteJson(newAPIStatus(st))
+	}
+}
+
+// restartsHandler returns the restarts of all servers, newest first.
+func restartsHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, _ *rest.Request) {
+		w.WriteJson(map[string]interface{}{"restarts": hub.Restarts().All()})
+	}
+}
+
+// serverRestartsHandler returns the restarts of one server.
+func serverRestartsHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		ip := r.PathParam("ip")
+		st := hub.Snapshot().Server(ip)
+		if st == nil {
+			rest.Error(w, "Unknown server "+ip, http.StatusNotFound)
+			return
+		}
+		w.WriteJson(map[string]interface{}{
+			"ip":            st.IP,
+			"restarts":      st.Restarts,
+			"total_queries": st.TotalQueries,
+			"events":        hub.Restarts().Events(ip),
+		})
+	}
+}
+
+func alertsHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, _ *rest.Request) {
+		active, resolved := []Alert{}, []Alert{}
+		if alerts := hub.Alerts(); alerts != nil {
+			active = alerts.Active()
+			resolved = alerts.Resolved()
+		}
+		w.WriteJson(map[string]interface{}{
+			"active":   active,
+			"resolved": resolved,
+		})
+	}
+}
 
-			byIP[st.IP] = rv
+func configHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, _ *rest.Request) {
+		cm := hub.ConfigManager()
+		if cm == nil {
+			rest.Error(w, "Configuration not loaded", http.StatusNotFound)
+			return
 		}
+		w.WriteJson(cm.Status())
+	}
+}
 
-		// remoteIP := req.RemoteAddr
+func consistencyHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, _ *rest.Request) {
+		cc := hub.Consistency()
+		if cc == nil {
+			rest.Error(w, "Consistency checks not enabled", http.StatusNotFound)
+			return
+		}
+		w.WriteJson(cc.Report())
+	}
+}
 
-		w.WriteJson(map[string]interface{}{"servers": byIP})
+func serialsHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, _ *rest.Request) {
+		zones := []*ZoneSerials{}
+		if t := hub.Serials(); t != nil {
+			zones = t.Zones()
+		}
+		w.WriteJson(map[string]interface{}{"zones": zones})
+	}
+}
+
+func discoveryHandler(hub *StatusHub) func(rest.ResponseWriter, *rest.Request) {
+	return func(w rest.ResponseWriter, _ *rest.Request) {
+		w.WriteJson(hub.Discovery().Status())
 	}
 }
 
@@ -72,6 +207,18 @@ func setupMux(hub *StatusHub) http.Handler {
 	api.Use(rest.DefaultDevStack...)
 	apirouter, err := rest.MakeRouter(
 		rest.Get("/status", statusHandler(hub)),
+		rest.Get("/servers/#ip", serverHandler(hub)),
+		rest.Put("/servers/#ip/pin", pinHandler(hub, true)),
+		rest.Delete("/servers/#ip/pin", pinHandler(hub, false)),
+		rest.Get("/servers/#ip/restarts", serverRestartsHandler(hub)),
+		rest.Get("/restarts", restartsHandler(hub)),
+		rest.Get("/history/group/#group", groupHistoryHandler(hub)),
+		rest.Get("/history/#ip", historyHandler(hub)),
+		rest.Get("/alerts", alertsHandler(hub)),
+		rest.Get("/config", configHandler(hub)),
+		rest.Get("/consistency", consistencyHandler(hub)),
+		rest.Get("/serials", serialsHandler(hub)),
+		rest.Get("/discovery", discoveryHandler(hub)),
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -80,6 +227,8 @@ func setupMux(hub *StatusHub) http.Handler {
 
 	router := mux.NewRouter()
 	router.HandleFunc("/", homeHandler)
+	router.Handle("/metrics", metricsHandler(hub))
+	router.HandleFunc("/api/stream", streamHandler(hub))
 	router.PathPrefix("/api/").Handler(http.StripPrefix("/api", api.MakeHandler()))
 	router.PathPrefix("/static/").HandlerFunc(serveStatic)
 
@@ -89,12 +238,76 @@ func setupMux(hub *StatusHub) http.Handler {
 	return smux
 }
 
-func startHTTP(port int, hub *StatusHub) {
-	h := setupMux(hub)
+// httpListeners opens the configured TCP addresses and unix socket.
+func httpListeners(cfg *AppConfig) ([]net.Listener, error) {
+	addrs := cfg.HTTP.Listen
+	if len(addrs) == 0 && len(cfg.HTTP.Socket) == 0 {
+		addrs = []string{defaultHTTPListen}
+	}
+
+	listeners := []net.Listener{}
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+
+	for _, addr := range addrs {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		if len(cfg.HTTP.Cert) > 0 {
+			cert, err := tls.LoadX509KeyPair(cfg.HTTP.Cert, cfg.HTTP.Key)
+			if err != nil {
+				l.Close()
+				closeAll()
+				return nil, err
+			}
+			l = tls.NewListener(l, &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				NextProtos:   []string{"http/1.1"},
+			})
+		}
+		log.Println("Going to listen on", addr)
+		listeners = append(listeners, l)
+	}
 
-	listen := ":" + strconv.Itoa(port)
-	log.Println("Going to listen on port", listen)
+	if socket := cfg.HTTP.Socket; len(socket) > 0 {
+		// remove a socket left behind by a previous run
+		if fi, err := os.Stat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(socket)
+		}
+		l, err := net.Listen("unix", socket)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		log.Println("Going to listen on", socket)
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// startHTTP serves the dashboard and API on the configured addresses.
+func startHTTP(cfg *AppConfig, hub *StatusHub) (*http.Server, error) {
+	listeners, err := httpListeners(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// handlers.CombinedLoggingHandler(os.Stdout,
-	http.ListenAndServe(listen, h)
+	srv := &http.Server{Handler: setupMux(hub)}
+
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			err := srv.Serve(l)
+			if err != nil && err != http.ErrServerClosed {
+				log.Printf("HTTP server on %s stopped: %s", l.Addr(), err)
+			}
+		}(l)
+	}
+	return srv, nil
 }
@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 
 	. "gopkg.in/check.v1"
 )
@@ -43,3 +46,43 @@ func (s *HTTPSuite) TestSetup(c *C) {
 		s.hub.Stop()
 	}
 }
+
+func (s *HTTPSuite) TestMetrics(c *C) {
+	res, err := http.Get(s.srv.URL + "/metrics")
+	c.Assert(err, IsNil)
+	c.Check(res.StatusCode, Equals, 200)
+	page, _ := ioutil.ReadAll(res.Body)
+	c.Check(string(page), Matches, "(?s).*geodns_monitor_servers 0.*")
+}
+
+func (s *HTTPSuite) TestHistory(c *C) {
+	res, err := http.Get(s.srv.URL + "/api/history/192.0.2.1")
+	c.Assert(err, IsNil)
+	c.Check(res.StatusCode, Equals, 404)
+}
+
+func (s *HTTPSuite) TestListen(c *C) {
+	dir, err := ioutil.TempDir("", "dnsmonitor-http")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	cfg := new(AppConfig)
+	cfg.HTTP.Listen = []string{"127.0.0.1:0"}
+	cfg.HTTP.Socket = filepath.Join(dir, "dnsmonitor.sock")
+
+	hub := NewHub()
+	defer hub.Stop()
+	srv, err := startHTTP(cfg, hub)
+	c.Assert(err, IsNil)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(_, _ string) (net.Conn, error) {
+			return net.Dial("unix", cfg.HTTP.Socket)
+		},
+	}}
+	res, err := client.Get("http://dnsmonitor/api/status")
+	c.Assert(err, IsNil)
+	c.Check(res.StatusCode, Equals, 200)
+	res.Body.Close()
+}
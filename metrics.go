@@ -0,0 +1,229 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	reconnectAttempts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "geodns_monitor_reconnect_attempts_total",
+		Help: "Number of times the monitor tried reconnecting to a server",
+	})
+	configReloads = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "geodns_monitor_config_reloads_total",
+		Help: "Number of times the configuration was loaded",
+	})
+)
+
+var serverLabels = []string{"ip", "name", "uuid", "version", "groups"}
+
+// hubCollector exports the state of every server the hub is tracking.
+type hubCollector struct {
+	hub *StatusHub
+
+	qps        *prometheus.Desc
+	qps1       *prometheus.Desc
+	uptime     *prometheus.Desc
+	lastUpdate *prometheus.Desc
+	queries    *prometheus.Desc
+	total      *prometheus.Desc
+	restarts   *prometheus.Desc
+	connected  *prometheus.Desc
+	connState  *prometheus.Desc
+	dnsTime    *prometheus.Desc
+	dnsOk      *prometheus.Desc
+	servers    *prometheus.Desc
+	queueDepth *prometheus.Desc
+	consistent *prometheus.Desc
+	zoneSerial *prometheus.Desc
+	zoneDelay  *prometheus.Desc
+	sourceOk   *prometheus.Desc
+	sourceSize *prometheus.Desc
+
+	sessions       *prometheus.Desc
+	connectedTime  *prometheus.Desc
+	messages       *prometheus.Desc
+	bytes          *prometheus.Desc
+	decodeErrors   *prometheus.Desc
+	interval       *prometheus.Desc
+	lastDisconnect *prometheus.Desc
+}
+
+func newHubCollector(hub *StatusHub) *hubCollector {
+	desc := func(name, help string, labels []string) *prometheus.Desc {
+		return prometheus.NewDesc("geodns_monitor_"+name, help, labels, nil)
+	}
+	return &hubCollector{
+		hub:        hub,
+		qps:        desc("server_qps", "Current queries per second", serverLabels),
+		qps1:       desc("server_qps1m", "Queries per second over the last minute", serverLabels),
+		uptime:     desc("server_uptime_seconds", "Uptime reported by the server", serverLabels),
+		lastUpdate: desc("server_last_update_age_seconds", "Seconds since the last status update with data", serverLabels),
+		queries:    desc("server_queries_total", "Queries served since the server started", serverLabels),
+		total:      desc("server_queries_cumulative_total", "Queries served, across restarts of the server", serverLabels),
+		restarts:   desc("server_restarts_total", "Restarts and query counter resets seen", serverLabels),
+		connected:  desc("server_connected", "1 if the monitor has a working connection to the server", serverLabels),
+		connState:  desc("server_connection_state", "1 for the state the connection to the server is in", append(serverLabels, "state")),
+		dnsTime:    desc("server_dns_response_seconds", "Average response time of the DNS probes", serverLabels),
+		dnsOk:      desc("server_dns_ok", "1 if all DNS probes got a correct answer", serverLabels),
+		servers:    desc("servers", "Number of servers being monitored", nil),
+		queueDepth: desc("arbiter_queue_depth", "Number of messages waiting for the status hub", nil),
+		consistent: desc("query_consistent", "1 if all servers gave the same answer to the query", []string{"name", "type", "subnet"}),
+		zoneSerial: desc("zone_serial", "SOA serial of the zone on the server", []string{"zone", "ip", "name"}),
+		zoneDelay:  desc("zone_propagation_delay_seconds", "How long after the first server the server got its current serial", []string{"zone", "ip", "name"}),
+		sourceOk:   desc("discovery_ok", "1 if the last discovery with the configuration entry worked", []string{"source", "config"}),
+		sourceSize: desc("discovery_targets", "Number of targets the configuration entry found in the last discovery", []string{"source", "config"}),
+
+		sessions:       desc("server_sessions_total", "Number of connections to the server that worked", serverLabels),
+		connectedTime:  desc("server_connected_seconds_total", "Time the monitor has been connected to the server", serverLabels),
+		messages:       desc("server_messages_received_total", "Status messages received from the server", serverLabels),
+		bytes:          desc("server_received_bytes_total", "Bytes of status messages received from the server", serverLabels),
+		decodeErrors:   desc("server_decode_errors_total", "Status messages from the server that couldn't be decoded", serverLabels),
+		interval:       desc("server_message_interval_seconds", "Average time between status messages from the server", serverLabels),
+		lastDisconnect: desc("server_last_disconnect_timestamp_seconds", "When the last connection to the server ended", serverLabels),
+	}
+}
+
+func (c *hubCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.qps
+	ch <- c.qps1
+	ch <- c.uptime
+	ch <- c.lastUpdate
+	ch <- c.queries
+	ch <- c.total
+	ch <- c.restarts
+	ch <- c.connected
+	ch <- c.connState
+	ch <- c.dnsTime
+	ch <- c.dnsOk
+	ch <- c.servers
+	ch <- c.queueDepth
+	ch <- c.consistent
+	ch <- c.zoneSerial
+	ch <- c.zoneDelay
+	ch <- c.sourceOk
+	ch <- c.sourceSize
+	ch <- c.sessions
+	ch <- c.connectedTime
+	ch <- c.messages
+	ch <- c.bytes
+	ch <- c.decodeErrors
+	ch <- c.interval
+	ch <- c.lastDisconnect
+}
+
+func (c *hubCollector) Collect(ch chan<- prometheus.Metric) {
+	statuses := c.hub.Status()
+
+	gauge := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labels...)
+	}
+	counter := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, labels...)
+	}
+
+	gauge(c.servers, float64(len(statuses)))
+	gauge(c.queueDepth, float64(c.hub.QueueDepth()))
+
+	if cc := c.hub.Consistency(); cc != nil {
+		for _, check := range cc.Report().Checks {
+			consistent := 0.0
+			if check.Consistent {
+				consistent = 1
+			}
+			gauge(c.consistent, consistent, check.Name, check.Type, check.Subnet)
+		}
+	}
+
+	if serials := c.hub.Serials(); serials != nil {
+		for _, zone := range serials.Zones() {
+			for _, srv := range zone.Servers {
+				if srv.Updated.IsZero() {
+					continue
+				}
+				gauge(c.zoneSerial, float64(srv.Serial), zone.Zone, srv.IP, srv.Name)
+				gauge(c.zoneDelay, srv.Delay, zone.Zone, srv.IP, srv.Name)
+			}
+		}
+	}
+
+	for _, src := range c.hub.Discovery().Status().Sources {
+		ok := 0.0
+		if src.OK {
+			ok = 1
+		}
+		gauge(c.sourceOk, ok, src.Source, src.Config)
+		gauge(c.sourceSize, float64(src.Targets), src.Source, src.Config)
+	}
+
+	for _, st := range statuses {
+		labels := []string{st.IP, st.Name, st.UUID, st.Version, strings.Join(st.Groups, ",")}
+
+		connected := 0.0
+		if st.Status == "Ok" {
+			connected = 1
+		}
+		gauge(c.connected, connected, labels...)
+		if len(st.State) > 0 {
+			for _, state := range connStates {
+				value := 0.0
+				if st.State == state {
+					value = 1
+				}
+				gauge(c.connState, value, append(labels, string(state))...)
+			}
+		}
+		counter(c.restarts, float64(st.Restarts), labels...)
+
+		session := st.Session
+		counter(c.sessions, float64(session.Sessions), labels...)
+		counter(c.connectedTime, session.ConnectedTime, labels...)
+		counter(c.messages, float64(session.Messages), labels...)
+		counter(c.bytes, float64(session.Bytes), labels...)
+		counter(c.decodeErrors, float64(session.DecodeErrors), labels...)
+		if session.AverageInterval > 0 {
+			gauge(c.interval, session.AverageInterval, labels...)
+		}
+		if !session.LastDisconnect.IsZero() {
+			gauge(c.lastDisconnect, float64(session.LastDisconnect.Unix()), labels...)
+		}
+
+		if len(st.DNSStatus) > 0 {
+			dnsOk := 0.0
+			if st.DNSStatus == "ok" {
+				dnsOk = 1
+			}
+			gauge(c.dnsOk, dnsOk, labels...)
+			gauge(c.dnsTime, st.ResponseTime/1000, labels...)
+		}
+
+		if st.LastStatusUpdate.IsZero() {
+			continue
+		}
+
+		gauge(c.qps, st.Qps, labels...)
+		gauge(c.qps1, st.Qps1, labels...)
+		gauge(c.uptime, float64(st.Uptime), labels...)
+		if !st.LastSeen.IsZero() {
+			gauge(c.lastUpdate, time.Since(st.LastSeen).Seconds(), labels...)
+		}
+		counter(c.queries, float64(st.Queries), labels...)
+		counter(c.total, float64(st.TotalQueries), labels...)
+	}
+}
+
+func metricsHandler(hub *StatusHub) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		newHubCollector(hub),
+		reconnectAttempts,
+		configReloads,
+		prometheus.NewGoCollector(),
+	)
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
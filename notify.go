@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// NotifyConfig is the configuration of a notification channel, from a
+// [notify "name"] section in the configuration file.
+type NotifyConfig struct {
+	Type     string
+	URL      string
+	SMTP     string
+	From     string
+	To       []string
+	Subject  string
+	Command  string
+	Template string
+	// Retries is a pointer so retries=0 can turn them off.
+	Retries   *int
+	RateLimit int
+	Severity  []string
+}
+
+// Notifier delivers a notification about an alert transition.
+type Notifier interface {
+	Notify(n *Notification) error
+}
+
+// Notification is what gets passed to the notifiers and the message
+// templates.
+type Notification struct {
+	Alert
+	Text  string `json:"text"`
+	Title string `json:"title"`
+}
+
+const (
+	defaultNotifyTemplate = `[{{.State}}] {{.Rule}} {{.Subject}}{{if .Name}} ({{.Name}}){{end}}: {{.Message}}`
+	defaultNotifySubject  = `[dnsmonitor] {{.Rule}} {{.State}} for {{.Subject}}`
+
+	defaultNotifyRetries   = 3
+	defaultNotifyRateLimit = 20
+
+	notifyQueueLength = 100
+)
+
+var (
+	// notifyTimeout limits each attempt to send a notification.
+	notifyTimeout = 10 * time.Second
+	// notifyRetryDelay is the delay before the first retry; it
+	// doubles for each retry.
+	notifyRetryDelay = 2 * time.Second
+)
+
+// notifyChannel queues, rate limits and retries notifications for
+// one notifier.
+type notifyChannel struct {
+	name     string
+	notifier Notifier
+	text     *texttemplate.Template
+	subject  *texttemplate.Template
+	retries  int
+	severity map[string]bool
+	limiter  *rateLimiter
+	queue    chan Alert
+	wg       sync.WaitGroup
+}
+
+func newNotifyChannel(name string, nc *NotifyConfig) (*notifyChannel, error) {
+	ch := &notifyChannel{
+		name:    name,
+		retries: defaultNotifyRetries,
+		queue:   make(chan Alert, notifyQueueLength),
+	}
+
+	var err error
+
+	switch nc.Type {
+	case "webhook":
+		if len(nc.URL) == 0 {
+			return nil, fmt.Errorf("notify '%s': webhook needs an url", name)
+		}
+		ch.notifier = &webhookNotifier{url: nc.URL, client: &http.Client{Timeout: notifyTimeout}}
+	case "email":
+		if len(nc.To) == 0 || len(nc.From) == 0 {
+			return nil, fmt.Errorf("notify '%s': email needs from and to addresses", name)
+		}
+		server := nc.SMTP
+		if len(server) == 0 {
+			server = "localhost:25"
+		}
+		ch.notifier = &emailNotifier{server: server, from: nc.From, to: nc.To}
+	case "exec":
+		if len(nc.Command) == 0 {
+			return nil, fmt.Errorf("notify '%s': exec needs a command", name)
+		}
+		ch.notifier = &execNotifier{command: nc.Command}
+	default:
+		return nil, fmt.Errorf("notify '%s': unknown type '%s'", name, nc.Type)
+	}
+
+	text := nc.Template
+	if len(text) == 0 {
+		text = defaultNotifyTemplate
+	}
+	ch.text, err = texttemplate.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("notify '%s': template: %s", name, err)
+	}
+	subject := nc.Subject
+	if len(subject) == 0 {
+		subject = defaultNotifySubject
+	}
+	ch.subject, err = texttemplate.New(name + "-subject").Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("notify '%s': subject: %s", name, err)
+	}
+
+	if nc.Retries != nil {
+		if *nc.Retries < 0 {
+			return nil, fmt.Errorf("notify '%s': invalid retries %d", name, *nc.Retries)
+		}
+		ch.retries = *nc.Retries
+	}
+	limit := nc.RateLimit
+	if limit == 0 {
+		limit = defaultNotifyRateLimit
+	}
+	ch.limiter = newRateLimiter(limit, time.Minute)
+
+	if len(nc.Severity) > 0 {
+		ch.severity = make(map[string]bool)
+		for _, s := range nc.Severity {
+			ch.severity[s] = true
+		}
+	}
+
+	return ch, nil
+}
+
+func (ch *notifyChannel) render(alert Alert) (*Notification, error) {
+	n := &Notification{Alert: alert}
+	buf := new(bytes.Buffer)
+	err := ch.text.Execute(buf, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Text = buf.String()
+	buf.Reset()
+	err = ch.subject.Execute(buf, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Title = buf.String()
+	return n, nil
+}
+
+func (ch *notifyChannel) run() {
+	defer ch.wg.Done()
+	for alert := range ch.queue {
+		if !ch.limiter.Allow(time.Now()) {
+			log.Printf("notify %s: rate limited, dropping %s for %s", ch.name, alert.Rule, alert.Subject)
+			continue
+		}
+		n, err := ch.render(alert)
+		if err != nil {
+			log.Printf("notify %s: %s", ch.name, err)
+			continue
+		}
+		delay := notifyRetryDelay
+		for try := 0; try <= ch.retries; try++ {
+			if try > 0 {
+				time.Sleep(delay)
+				delay *= 2
+			}
+			err = ch.notifier.Notify(n)
+			if err == nil {
+				break
+			}
+			log.Printf("notify %s: attempt %d failed: %s", ch.name, try+1, err)
+		}
+	}
+}
+
+// Dispatcher sends alert transitions to the configured channels.
+type Dispatcher struct {
+	sync.RWMutex
+	channels []*notifyChannel
+}
+
+func makeNotifyChannels(cfg map[string]*NotifyConfig) ([]*notifyChannel, error) {
+	channels := []*notifyChannel{}
+	for name, nc := range cfg {
+		ch, err := newNotifyChannel(name, nc)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	for _, ch := range channels {
+		ch.wg.Add(1)
+		go ch.run()
+	}
+	return channels, nil
+}
+
+func closeNotifyChannels(channels []*notifyChannel) {
+	for _, ch := range channels {
+		close(ch.queue)
+	}
+	for _, ch := range channels {
+		ch.wg.Wait()
+	}
+}
+
+// NewDispatcher creates the notification channels from the
+// configuration and starts their workers.
+func NewDispatcher(cfg map[string]*NotifyConfig) (*Dispatcher, error) {
+	channels, err := makeNotifyChannels(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Dispatcher{channels: channels}, nil
+}
+
+// Reconfigure replaces the channels. Alerts already queued on the
+// old channels are still delivered.
+func (d *Dispatcher) Reconfigure(cfg map[string]*NotifyConfig) error {
+	channels, err := makeNotifyChannels(cfg)
+	if err != nil {
+		return err
+	}
+	d.Lock()
+	old := d.channels
+	d.channels = channels
+	d.Unlock()
+	go closeNotifyChannels(old)
+	return nil
+}
+
+// Dispatch queues the alert for each channel that wants it. It
+// never blocks; if a channel is backed up the alert is dropped.
+func (d *Dispatcher) Dispatch(alert Alert) {
+	d.RLock()
+	defer d.RUnlock()
+	for _, ch := range d.channels {
+		if ch.severity != nil && !ch.severity[alert.Severity] {
+			continue
+		}
+		select {
+		case ch.queue <- alert:
+		default:
+			log.Printf("notify %s: queue full, dropping %s for %s", ch.name, alert.Rule, alert.Subject)
+		}
+	}
+}
+
+// Close stops accepting alerts and waits for the queued ones to be
+// delivered.
+func (d *Dispatcher) Close() {
+	d.Lock()
+	channels := d.channels
+	d.channels = nil
+	d.Unlock()
+	closeNotifyChannels(channels)
+}
+
+// rateLimiter allows up to limit events per period.
+type rateLimiter struct {
+	sync.Mutex
+	limit  int
+	period time.Duration
+	events []time.Time
+}
+
+func newRateLimiter(limit int, period time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, period: period}
+}
+
+func (rl *rateLimiter) Allow(now time.Time) bool {
+	rl.Lock()
+	defer rl.Unlock()
+	i := 0
+	for i < len(rl.events) && now.Sub(rl.events[i]) >= rl.period {
+		i++
+	}
+	rl.events = rl.events[i:]
+	if len(rl.events) >= rl.limit {
+		return false
+	}
+	rl.events = append(rl.events, now)
+	return true
+}
+
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (wh *webhookNotifier) Notify(n *Notification) error {
+	js, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	resp, err := wh.client.Post(wh.url, "application/json", bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+type emailNotifier struct {
+	server string
+	from   string
+	to     []string
+}
+
+func (em *emailNotifier) Notify(n *Notification) error {
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", em.from)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(em.to, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", n.Title)
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.Replace(n.Text, "\n", "\r\n", -1))
+	msg.WriteString("\r\n")
+
+	return em.send(msg.Bytes())
+}
+
+// send is smtp.SendMail, but with notifyTimeout for the whole
+// conversation, so a hung server doesn't block the channel.
+func (em *emailNotifier) send(msg []byte) error {
+	conn, err := net.DialTimeout("tcp", em.server, notifyTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(notifyTimeout))
+
+	host, _, err := net.SplitHostPort(em.server)
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(em.from); err != nil {
+		return err
+	}
+	for _, to := range em.to {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+type execNotifier struct {
+	command string
+}
+
+func (ex *execNotifier) Notify(n *Notification) error {
+	js, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", ex.command)
+	// don't wait for children of the shell that keep the output open
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(js)
+	cmd.Env = append(os.Environ(),
+		"ALERT_STATE="+string(n.State),
+		"ALERT_RULE="+n.Rule,
+		"ALERT_SUBJECT="+n.Subject,
+		"ALERT_TEXT="+n.Text,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("'%s': %s: %s", ex.command, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type NotifySuite struct {
+	alert Alert
+}
+
+var _ = Suite(&NotifySuite{})
+
+func (s *NotifySuite) SetUpSuite(c *C) {
+	notifyRetryDelay = 10 * time.Millisecond
+	s.alert = Alert{
+		Rule:     "stale",
+		Type:     "stale",
+		Severity: "warning",
+		Subject:  "192.0.2.1",
+		Name:     "ns1",
+		State:    AlertFiring,
+		Message:  "last update 60 seconds ago",
+	}
+}
+
+func (s *NotifySuite) TestConfig(c *C) {
+	_, err := NewDispatcher(map[string]*NotifyConfig{"x": {Type: "pigeon"}})
+	c.Check(err, ErrorMatches, "notify 'x': unknown type 'pigeon'")
+
+	_, err = NewDispatcher(map[string]*NotifyConfig{"x": {Type: "email", To: []string{"a@example.com"}}})
+	c.Check(err, ErrorMatches, ".*needs from and to.*")
+
+	_, err = NewDispatcher(map[string]*NotifyConfig{"x": {Type: "exec", Command: "true", Template: "{{.Foo"}})
+	c.Check(err, ErrorMatches, "notify 'x': template:.*")
+
+	retries := -1
+	_, err = NewDispatcher(map[string]*NotifyConfig{"x": {Type: "exec", Command: "true", Retries: &retries}})
+	c.Check(err, ErrorMatches, "notify 'x': invalid retries -1")
+
+	ch, err := newNotifyChannel("x", &NotifyConfig{Type: "exec", Command: "true"})
+	c.Assert(err, IsNil)
+	c.Check(ch.retries, Equals, defaultNotifyRetries)
+	retries = 0
+	ch, err = newNotifyChannel("x", &NotifyConfig{Type: "exec", Command: "true", Retries: &retries})
+	c.Assert(err, IsNil)
+	c.Check(ch.retries, Equals, 0)
+}
+
+func (s *NotifySuite) TestRateLimit(c *C) {
+	rl := newRateLimiter(2, time.Minute)
+	now := time.Now()
+	c.Check(rl.Allow(now), Equals, true)
+	c.Check(rl.Allow(now.Add(time.Second)), Equals, true)
+	c.Check(rl.Allow(now.Add(2*time.Second)), Equals, false)
+	c.Check(rl.Allow(now.Add(61*time.Second)), Equals, true)
+}
+
+func (s *NotifySuite) TestWebhook(c *C) {
+	received := make(chan *Notification, 10)
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		n := new(Notification)
+		json.NewDecoder(r.Body).Decode(n)
+		received <- n
+	}))
+	defer srv.Close()
+
+	d, err := NewDispatcher(map[string]*NotifyConfig{
+		"hook": {Type: "webhook", URL: srv.URL, Template: "{{.Subject}} is {{.State}}"},
+	})
+	c.Assert(err, IsNil)
+	d.Dispatch(s.alert)
+	d.Close()
+
+	c.Check(attempts, Equals, 2)
+	c.Assert(received, HasLen, 1)
+	n := <-received
+	c.Check(n.Text, Equals, "192.0.2.1 is firing")
+	c.Check(n.Title, Equals, "[dnsmonitor] stale firing for 192.0.2.1")
+	c.Check(n.Rule, Equals, "stale")
+}
+
+func (s *NotifySuite) TestExec(c *C) {
+	dir, err := ioutil.TempDir("", "dnsmonitor-notify")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "alert.json")
+
+	d, err := NewDispatcher(map[string]*NotifyConfig{
+		"cmd":      {Type: "exec", Command: "cat > " + out},
+		"critical": {Type: "exec", Command: "touch " + out + ".critical", Severity: []string{"critical"}},
+	})
+	c.Assert(err, IsNil)
+	d.Dispatch(s.alert)
+	d.Close()
+
+	js, err := ioutil.ReadFile(out)
+	c.Assert(err, IsNil)
+	n := new(Notification)
+	c.Assert(json.Unmarshal(js, n), IsNil)
+	c.Check(n.Subject, Equals, "192.0.2.1")
+	c.Check(n.Text, Equals, "[firing] stale 192.0.2.1 (ns1): last update 60 seconds ago")
+
+	_, err = os.Stat(out + ".critical")
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *NotifySuite) TestTimeout(c *C) {
+	defer func(t time.Duration) { notifyTimeout = t }(notifyTimeout)
+	notifyTimeout = 200 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "dnsmonitor-notify")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "attempts")
+
+	// an SMTP server that never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+	go func() {
+		conns := []net.Conn{}
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				break
+			}
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	retries := 0
+	d, err := NewDispatcher(map[string]*NotifyConfig{
+		"cmd": {Type: "exec", Command: "echo attempt >> " + out + "; sleep 10", Retries: &retries},
+		"mail": {
+			Type:    "email",
+			SMTP:    l.Addr().String(),
+			From:    "dnsmonitor@example.com",
+			To:      []string{"ops@example.com"},
+			Retries: &retries,
+		},
+	})
+	c.Assert(err, IsNil)
+	start := time.Now()
+	d.Dispatch(s.alert)
+	d.Close()
+	c.Check(time.Since(start) < 5*time.Second, Equals, true)
+
+	attempts, err := ioutil.ReadFile(out)
+	c.Assert(err, IsNil)
+	c.Check(string(attempts), Equals, "attempt\n")
+}
+
+// fakeSMTP accepts one message and sends the data on the channel.
+func fakeSMTP(c *C, l net.Listener, msgs chan string) {
+	conn, err := l.Accept()
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			data := ""
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				data += line
+			}
+			msgs <- data
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *NotifySuite) TestEmail(c *C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+
+	msgs := make(chan string, 1)
+	go fakeSMTP(c, l, msgs)
+
+	d, err := NewDispatcher(map[string]*NotifyConfig{
+		"mail": {
+			Type: "email",
+			SMTP: l.Addr().String(),
+			From: "dnsmonitor@example.com",
+			To:   []string{"ops@example.com"},
+		},
+	})
+	c.Assert(err, IsNil)
+	d.Dispatch(s.alert)
+	d.Close()
+
+	c.Assert(msgs, HasLen, 1)
+	msg := <-msgs
+	c.Check(msg, Matches, "(?s).*Subject: \\[dnsmonitor\\] stale firing for 192.0.2.1\r\n.*")
+	c.Check(msg, Matches, "(?s).*\r\n\r\n\\[firing\\] stale 192.0.2.1 \\(ns1\\).*")
+}
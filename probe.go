@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultProbeInterval = 30 * time.Second
+	defaultProbeTimeout  = 2 * time.Second
+	defaultProbePort     = 53
+)
+
+var defaultProbeProtocols = []string{"udp", "tcp"}
+
+// ProbeQuery is a query sent to every server and what a correct
+// answer looks like.
+type ProbeQuery struct {
+	Name  string
+	Type  uint16
+	Rcode int
+	// Subnet, if set, is sent as the EDNS Client Subnet so the
+	// server answers as it would for clients there.
+	Subnet *net.IPNet
+	// Expect, if set, is the record data every answer of the
+	// queried type must be in.
+	Expect []string
+}
+
+// parseProbeQuery parses "name type [ecs=subnet] [rcode] [answer...]",
+// for example "www.example.com A 192.0.2.1 192.0.2.2",
+// "www.example.com A ecs=203.0.113.0/24 192.0.2.3" or
+// "nope.example.com A NXDOMAIN".
+func parseProbeQuery(s string) (*ProbeQuery, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid probe query '%s', expected name type [answers]", s)
+	}
+	qtype, ok := dns.StringToType[strings.ToUpper(fields[1])]
+	if !ok {
+		return nil, fmt.Errorf("invalid probe query '%s': unknown type '%s'", s, fields[1])
+	}
+	q := &ProbeQuery{Name: dns.Fqdn(fields[0]), Type: qtype, Rcode: dns.RcodeSuccess}
+	for _, f := range fields[2:] {
+		if strings.HasPrefix(strings.ToLower(f), "ecs=") {
+			_, subnet, err := net.ParseCIDR(f[len("ecs="):])
+			if err != nil {
+				return nil, fmt.Errorf("invalid probe query '%s': %s", s, err)
+			}
+			q.Subnet = subnet
+			continue
+		}
+		if rcode, ok := dns.StringToRcode[strings.ToUpper(f)]; ok {
+			q.Rcode = rcode
+			continue
+		}
+		q.Expect = append(q.Expect, f)
+	}
+	return q, nil
+}
+
+func (q *ProbeQuery) String() string {
+	s := q.Name + " " + dns.TypeToString[q.Type]
+	if q.Subnet != nil {
+		s += " ecs=" + q.Subnet.String()
+	}
+	return s
+}
+
+// subnet returns the client subnet as a string, or "" if there is
+// none.
+func (q *ProbeQuery) subnet() string {
+	if q.Subnet == nil {
+		return ""
+	}
+	return q.Subnet.String()
+}
+
+// msg returns the query to send, with the client subnet option if
+// there is one.
+func (q *ProbeQuery) msg() *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(q.Name, q.Type)
+	m.RecursionDesired = false
+	if q.Subnet == nil {
+		return m
+	}
+
+	ecs := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET}
+	bits, _ := q.Subnet.Mask.Size()
+	ecs.SourceNetmask = uint8(bits)
+	if ip4 := q.Subnet.IP.To4(); ip4 != nil {
+		ecs.Family = 1
+		ecs.Address = ip4
+	} else {
+		ecs.Family = 2
+		ecs.Address = q.Subnet.IP
+	}
+	m.SetEdns0(dns.DefaultMsgSize, false)
+	opt := m.IsEdns0()
+	opt.Option = append(opt.Option, ecs)
+	return m
+}
+
+// check returns what's wrong with the response, if anything.
+func (q *ProbeQuery) check(rcode int, answers []string) string {
+	if rcode != q.Rcode {
+		return fmt.Sprintf("rcode %s, expected %s", dns.RcodeToString[rcode], dns.RcodeToString[q.Rcode])
+	}
+	if rcode != dns.RcodeSuccess {
+		return ""
+	}
+	if len(answers) == 0 {
+		return "no answer"
+	}
+	if len(q.Expect) == 0 {
+		return ""
+	}
+	for _, answer := range answers {
+		found := false
+		for _, expect := range q.Expect {
+			if sameRdata(answer, expect) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("unexpected answer %s", answer)
+		}
+	}
+	return ""
+}
+
+func sameRdata(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// rdata returns the record data of rr in presentation format.
+func rdata(rr dns.RR) string {
+	return strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
+
+// ProbeSettings is the [probe] configuration.
+type ProbeSettings struct {
+	Queries   []*ProbeQuery
+	Protocols []string
+	Interval  time.Duration
+	Timeout   time.Duration
+	Port      int
+}
+
+func probeSettingsFromConfig(cfg *AppConfig) (*ProbeSettings, error) {
+	ps := &ProbeSettings{
+		Protocols: cfg.Probe.Protocol,
+		Interval:  defaultProbeInterval,
+		Timeout:   defaultProbeTimeout,
+		Port:      cfg.Probe.Port,
+	}
+	for _, s := range cfg.Probe.Query {
+		q, err := parseProbeQuery(s)
+		if err != nil {
+			return nil, err
+		}
+		ps.Queries = append(ps.Queries, q)
+	}
+	for _, proto := range ps.Protocols {
+		if proto != "udp" && proto != "tcp" {
+			return nil, fmt.Errorf("invalid probe protocol '%s'", proto)
+		}
+	}
+	if len(ps.Protocols) == 0 {
+		ps.Protocols = defaultProbeProtocols
+	}
+	if len(cfg.Probe.Interval) > 0 {
+		d, err := time.ParseDuration(cfg.Probe.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid probe interval: %s", err)
+		}
+		ps.Interval = d
+	}
+	if len(cfg.Probe.Timeout) > 0 {
+		d, err := time.ParseDuration(cfg.Probe.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid probe timeout: %s", err)
+		}
+		ps.Timeout = d
+	}
+	if ps.Interval < time.Second {
+		return nil, fmt.Errorf("probe interval must be at least 1s")
+	}
+	if ps.Port == 0 {
+		ps.Port = defaultProbePort
+	}
+	return ps, nil
+}
+
+// probeConfig holds the current settings for all the probers.
+type probeConfig struct {
+	sync.RWMutex
+	settings *ProbeSettings
+}
+
+func (pc *probeConfig) Settings() *ProbeSettings {
+	pc.RLock()
+	defer pc.RUnlock()
+	return pc.settings
+}
+
+func (pc *probeConfig) Set(ps *ProbeSettings) {
+	pc.Lock()
+	defer pc.Unlock()
+	pc.settings = ps
+}
+
+// ProbeResult is the outcome of one query to one server.
+type ProbeResult struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Subnet   string    `json:"subnet,omitempty"`
+	Protocol string    `json:"protocol"`
+	Time     time.Time `json:"time"`
+	RTT      float64   `json:"rtt"`
+	Rcode    string    `json:"rcode"`
+	Answers  []string  `json:"answers"`
+	Correct  bool      `json:"correct"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// ProbeReport is the results of a probe round for a connection.
+type ProbeReport struct {
+	ConnID  int
+	Results []ProbeResult
+}
+
+func probeServer(ip net.IP, ps *ProbeSettings) []ProbeResult {
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(ps.Port))
+	results := []ProbeResult{}
+	for _, q := range ps.Queries {
+		for _, proto := range ps.Protocols {
+			results = append(results, probeQuery(addr, proto, q, ps.Timeout))
+		}
+	}
+	return results
+}
+
+func probeQuery(addr, proto string, q *ProbeQuery, timeout time.Duration) ProbeResult {
+	res := ProbeResult{
+		Name:     q.Name,
+		Type:     dns.TypeToString[q.Type],
+		Subnet:   q.subnet(),
+		Protocol: proto,
+		Time:     time.Now(),
+	}
+
+	c := &dns.Client{Net: proto, Timeout: timeout}
+	r, rtt, err := c.Exchange(q.msg(), addr)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.RTT = milliseconds(rtt)
+	res.Rcode = dns.RcodeToString[r.Rcode]
+	for _, rr := range r.Answer {
+		if rr.Header().Rrtype == q.Type {
+			res.Answers = append(res.Answers, rdata(rr))
+		}
+	}
+	res.Error = q.check(r.Rcode, res.Answers)
+	res.Correct = len(res.Error) == 0
+	return res
+}
+
+func milliseconds(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
+
+// setProbes updates the status with the results of a probe round.
+func (srv *Status) setProbes(results []ProbeResult) {
+	srv.Probes = results
+	srv.DNSStatus = "ok"
+	srv.ResponseTime = 0
+
+	sum, n := 0.0, 0
+	for _, res := range results {
+		if len(res.Rcode) > 0 {
+			sum += res.RTT
+			n++
+		}
+		if !res.Correct && srv.DNSStatus == "ok" {
+			query := fmt.Sprintf("%s %s/%s", res.Name, res.Type, res.Protocol)
+			if len(res.Subnet) > 0 {
+				query += " ecs=" + res.Subnet
+			}
+			srv.DNSStatus = query + ": " + res.Error
+		}
+	}
+	if n > 0 {
+		// rounded to 0.1ms, but not to 0
+		srv.ResponseTime = math.Max(0.1, math.Round(sum/float64(n)*10)/10)
+	}
+}
+
+// probe sends the configured queries to the server every interval
+// until the connection is stopped.
+func (sc *ServerConnection) probe() {
+	if sc.probes == nil {
+		return
+	}
+	for {
+		ps := sc.probes.Settings()
+		if ps != nil && len(ps.Queries) > 0 {
+			report := &ProbeReport{ConnID: sc.ConnID, Results: probeServer(sc.IP, ps)}
+			select {
+			case sc.probeChan <- report:
+			case <-sc.quit:
+				return
+			}
+		}
+
+		interval := defaultProbeInterval
+		if ps != nil {
+			interval = ps.Interval
+		}
+		select {
+		case <-time.After(interval):
+		case <-sc.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	. "gopkg.in/check.v1"
+)
+
+type ProbeSuite struct {
+	stub *stubDNS
+}
+
+var _ = Suite(&ProbeSuite{})
+
+// stubDNS is a DNS server on 127.0.0.1 answering from a list of
+// records over both UDP and TCP on the same port. Queries with an EDNS
+// Client Subnet in one of the subnets get the records added for it.
+type stubDNS struct {
+	sync.Mutex
+	Port    int
+	records map[string][]dns.RR
+	subnets map[string]map[string][]dns.RR
+	udp     *dns.Server
+	tcp     *dns.Server
+	tls     *dns.Server
+}
+
+func newStubDNS(c *C, records ...string) *stubDNS {
+	stub := &stubDNS{
+		records: make(map[string][]dns.RR),
+		subnets: make(map[string]map[string][]dns.RR),
+	}
+	for _, s := range records {
+		stub.Add(c, s)
+	}
+
+	var pc net.PacketConn
+	var l net.Listener
+	for i := 0; i < 10 && l == nil; i++ {
+		var err error
+		pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+		c.Assert(err, IsNil)
+		l, err = net.Listen("tcp", pc.LocalAddr().String())
+		if err != nil {
+			pc.Close()
+		}
+	}
+	c.Assert(l, NotNil)
+	stub.Port = pc.LocalAddr().(*net.UDPAddr).Port
+
+	stub.udp = &dns.Server{PacketConn: pc, Handler: stub}
+	stub.tcp = &dns.Server{Listener: l, Handler: stub}
+	go stub.udp.ActivateAndServe()
+	go stub.tcp.ActivateAndServe()
+	return stub
+}
+
+// Add adds a record in zone file format.
+func (stub *stubDNS) Add(c *C, s string) {
+	rr, err := dns.NewRR(s)
+	c.Assert(err, IsNil)
+	key := stubKey(rr.Header().Name, rr.Header().Rrtype)
+	stub.Lock()
+	defer stub.Unlock()
+	stub.records[key] = append(stub.records[key], rr)
+}
+
+// AddSubnet adds a record given to clients in the subnet.
+func (stub *stubDNS) AddSubnet(c *C, subnet, s string) {
+	rr, err := dns.NewRR(s)
+	c.Assert(err, IsNil)
+	stub.Lock()
+	defer stub.Unlock()
+	if stub.subnets[subnet] == nil {
+		stub.subnets[subnet] = make(map[string][]dns.RR)
+	}
+	key := stubKey(rr.Header().Name, rr.Header().Rrtype)
+	stub.subnets[subnet][key] = append(stub.subnets[subnet][key], rr)
+}
+
+func stubKey(name string, qtype uint16) string {
+	return dns.CanonicalName(name) + "/" + strconv.Itoa(int(qtype))
+}
+
+func (stub *stubDNS) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	stub.Lock()
+	defer stub.Unlock()
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	q := r.Question[0]
+	if q.Qtype == dns.TypeAXFR {
+		stub.transfer(w, m, q.Name)
+		return
+	}
+	key := stubKey(q.Name, q.Qtype)
+	m.Answer = stub.records[key]
+	if len(m.Answer) == 0 {
+		// the alias, without following it
+		m.Answer = stub.records[stubKey(q.Name, dns.TypeCNAME)]
+	}
+	if ecs := clientSubnet(r); ecs != nil {
+		for subnet, records := range stub.subnets {
+			_, n, _ := net.ParseCIDR(subnet)
+			if n.Contains(ecs.Address) && len(records[key]) > 0 {
+				m.Answer = records[key]
+				ecs.SourceScope = ecs.SourceNetmask
+			}
+		}
+		m.SetEdns0(dns.DefaultMsgSize, false)
+		m.IsEdns0().Option = []dns.EDNS0{ecs}
+	}
+	if len(m.Answer) == 0 {
+		m.Rcode = dns.RcodeNameError
+	}
+	w.WriteMsg(m)
+}
+
+// transfer answers a zone transfer with all the records in the zone,
+// between its SOA records.
+func (stub *stubDNS) transfer(w dns.ResponseWriter, m *dns.Msg, zone string) {
+	soa := stub.records[stubKey(zone, dns.TypeSOA)]
+	if len(soa) == 0 {
+		m.Rcode = dns.RcodeRefused
+		w.WriteMsg(m)
+		return
+	}
+	m.Answer = []dns.RR{soa[0]}
+	for key, records := range stub.records {
+		if key == stubKey(zone, dns.TypeSOA) {
+			continue
+		}
+		for _, rr := range records {
+			if dns.IsSubDomain(zone, rr.Header().Name) {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+	}
+	m.Answer = append(m.Answer, soa[0])
+	w.WriteMsg(m)
+}
+
+func clientSubnet(r *dns.Msg) *dns.EDNS0_SUBNET {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, o := range opt.Option {
+		if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return ecs
+		}
+	}
+	return nil
+}
+
+// ServeTLS also serves DNS over TLS with the certificate and returns
+// the port.
+func (stub *stubDNS) ServeTLS(c *C, cert tls.Certificate) int {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	c.Assert(err, IsNil)
+	stub.tls = &dns.Server{Listener: l, Net: "tcp-tls", Handler: stub}
+	go stub.tls.ActivateAndServe()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func (stub *stubDNS) Close() {
+	stub.udp.Shutdown()
+	stub.tcp.Shutdown()
+	if stub.tls != nil {
+		stub.tls.Shutdown()
+	}
+}
+
+func (s *ProbeSuite) SetUpSuite(c *C) {
+	s.stub = newStubDNS(c,
+		"www.example.com. 300 IN A 192.0.2.1",
+		"www.example.com. 300 IN A 192.0.2.2",
+		"example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 3600 600 86400 300",
+	)
+}
+
+func (s *ProbeSuite) TearDownSuite(c *C) {
+	s.stub.Close()
+}
+
+func (s *ProbeSuite) TestParse(c *C) {
+	q, err := parseProbeQuery("www.example.com a 192.0.2.1")
+	c.Assert(err, IsNil)
+	c.Check(q.Name, Equals, "www.example.com.")
+	c.Check(q.Type, Equals, dns.TypeA)
+	c.Check(q.Rcode, Equals, dns.RcodeSuccess)
+	c.Check(q.Expect, DeepEquals, []string{"192.0.2.1"})
+
+	q, err = parseProbeQuery("nope.example.com A NXDOMAIN")
+	c.Assert(err, IsNil)
+	c.Check(q.Rcode, Equals, dns.RcodeNameError)
+
+	_, err = parseProbeQuery("www.example.com")
+	c.Check(err, ErrorMatches, "invalid probe query.*")
+	_, err = parseProbeQuery("www.example.com BOGUS")
+	c.Check(err, ErrorMatches, ".*unknown type 'BOGUS'")
+
+	q, err = parseProbeQuery("www.example.com A ecs=203.0.113.7/24 192.0.2.3")
+	c.Assert(err, IsNil)
+	c.Check(q.Subnet.String(), Equals, "203.0.113.0/24")
+	c.Check(q.Expect, DeepEquals, []string{"192.0.2.3"})
+	c.Check(q.String(), Equals, "www.example.com. A ecs=203.0.113.0/24")
+	_, err = parseProbeQuery("www.example.com A ecs=203.0.113.0")
+	c.Check(err, ErrorMatches, ".*invalid CIDR address.*")
+
+	cfg := new(AppConfig)
+	cfg.Probe.Protocol = []string{"sctp"}
+	_, err = probeSettingsFromConfig(cfg)
+	c.Check(err, ErrorMatches, "invalid probe protocol 'sctp'")
+}
+
+func (s *ProbeSuite) TestProbe(c *C) {
+	cfg := new(AppConfig)
+	cfg.Probe.Query = []string{
+		"www.example.com A 192.0.2.1 192.0.2.2",
+		"www.example.com A 192.0.2.1",
+		"nope.example.com A NXDOMAIN",
+		"example.com SOA",
+	}
+	cfg.Probe.Port = s.stub.Port
+	ps, err := probeSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+
+	results := probeServer(net.ParseIP("127.0.0.1"), ps)
+	c.Assert(results, HasLen, 8)
+
+	c.Check(results[0].Protocol, Equals, "udp")
+	c.Check(results[1].Protocol, Equals, "tcp")
+	for _, i := range []int{0, 1, 4, 5, 6, 7} {
+		c.Check(results[i].Correct, Equals, true, Commentf("%d: %s", i, results[i].Error))
+		c.Check(results[i].RTT > 0, Equals, true)
+	}
+	c.Check(results[0].Answers, DeepEquals, []string{"192.0.2.1", "192.0.2.2"})
+	c.Check(results[2].Correct, Equals, false)
+	c.Check(results[2].Error, Equals, "unexpected answer 192.0.2.2")
+	c.Check(results[4].Rcode, Equals, "NXDOMAIN")
+	c.Check(results[6].Answers[0], Matches, "ns1.example.com. hostmaster.example.com. 2024010101 .*")
+
+	st := new(Status)
+	st.setProbes(results)
+	c.Check(st.DNSStatus, Equals, "www.example.com. A/udp: unexpected answer 192.0.2.2")
+	c.Check(st.ResponseTime > 0, Equals, true)
+
+	st.setProbes(results[:2])
+	c.Check(st.DNSStatus, Equals, "ok")
+}
+
+func (s *ProbeSuite) TestClientSubnet(c *C) {
+	stub := newStubDNS(c, "www.example.com. 300 IN A 192.0.2.1")
+	defer stub.Close()
+	stub.AddSubnet(c, "203.0.113.0/24", "www.example.com. 300 IN A 192.0.2.3")
+	stub.AddSubnet(c, "2001:db8::/32", "www.example.com. 300 IN A 192.0.2.6")
+
+	cfg := new(AppConfig)
+	cfg.Probe.Query = []string{
+		"www.example.com A ecs=203.0.113.0/24 192.0.2.3",
+		"www.example.com A ecs=2001:db8:1::/48 192.0.2.6",
+		"www.example.com A ecs=198.51.100.0/24 192.0.2.3",
+		"www.example.com A 192.0.2.1",
+	}
+	cfg.Probe.Protocol = []string{"udp"}
+	cfg.Probe.Port = stub.Port
+	ps, err := probeSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+
+	results := probeServer(net.ParseIP("127.0.0.1"), ps)
+	c.Assert(results, HasLen, 4)
+	c.Check(results[0].Correct, Equals, true, Commentf(results[0].Error))
+	c.Check(results[0].Subnet, Equals, "203.0.113.0/24")
+	c.Check(results[1].Correct, Equals, true, Commentf(results[1].Error))
+	c.Check(results[2].Correct, Equals, false)
+	c.Check(results[2].Answers, DeepEquals, []string{"192.0.2.1"})
+	c.Check(results[3].Correct, Equals, true, Commentf(results[3].Error))
+	c.Check(results[3].Subnet, Equals, "")
+
+	st := new(Status)
+	st.setProbes(results)
+	c.Check(st.DNSStatus, Equals, "www.example.com. A/udp ecs=198.51.100.0/24: unexpected answer 192.0.2.1")
+}
+
+func (s *ProbeSuite) TestTimeout(c *C) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+
+	ps := &ProbeSettings{
+		Queries:   []*ProbeQuery{{Name: "www.example.com.", Type: dns.TypeA}},
+		Protocols: []string{"udp"},
+		Timeout:   100 * time.Millisecond,
+		Port:      l.LocalAddr().(*net.UDPAddr).Port,
+	}
+	results := probeServer(net.ParseIP("127.0.0.1"), ps)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Correct, Equals, false)
+	c.Check(results[0].Error, Matches, ".*timeout.*")
+
+	st := new(Status)
+	st.setProbes(results)
+	c.Check(st.ResponseTime, Equals, 0.0)
+	c.Check(st.DNSStatus, Matches, "www.example.com. A/udp: .*timeout.*")
+}
+
+func (s *ProbeSuite) TestHub(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-4", "up": 10})
+	defer fm.Close()
+	ip, ep := fm.Endpoint()
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetProbeSettings(&ProbeSettings{
+		Queries:   []*ProbeQuery{{Name: "www.example.com.", Type: dns.TypeA}},
+		Protocols: []string{"udp"},
+		Interval:  time.Second,
+		Timeout:   time.Second,
+		Port:      s.stub.Port,
+	})
+	c.Assert(hub.AddNameEndpoint(ip.String(), ep), IsNil)
+
+	st := waitStatus(c, hub, func(st *Status) bool { return len(st.DNSStatus) > 0 })
+	c.Check(st.DNSStatus, Equals, "ok")
+	c.Check(st.Probes, HasLen, 1)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// Provenance records why a server is monitored: the configuration
+// entry it came from and the name that resolved to its address.
+type Provenance struct {
+	// Source is the kind of entry: "a", "domain", "txt", "srv",
+	// "axfr", "file", "url" or "manual" for servers added outside
+	// the configuration.
+	Source string `json:"source"`
+	// Config is the configuration line, for example
+	// "domain=example.com".
+	Config string `json:"config"`
+	// Name is the name that was looked up; empty if the entry was
+	// an IP address.
+	Name     string    `json:"name"`
+	Resolved time.Time `json:"resolved"`
+	// Metadata is the labels given with the target by file and
+	// HTTP discovery.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	revision int
+}
+
+// manualSource is the provenance of servers added with AddName.
+var manualSource = Provenance{Source: "manual"}
+
+func (p *Provenance) same(o *Provenance) bool {
+	return p.Source == o.Source && p.Config == o.Config && p.Name == o.Name
+}
+
+// addSource records the provenance, replacing an older record of
+// the same entry and name.
+func (st *Status) addSource(src Provenance) {
+	for i := range st.Sources {
+		if st.Sources[i].same(&src) {
+			st.Sources[i] = src
+			return
+		}
+	}
+	st.Sources = append(st.Sources, src)
+	st.addName(src.Name)
+}
+
+// expireSources forgets the entries not seen since the given
+// configuration revision, except those of discoverers that failed.
+func (st *Status) expireSources(revision int, failed map[string]bool) {
+	sources := []Provenance{}
+	for _, src := range st.Sources {
+		if src.revision >= revision || failed[src.Config] {
+			sources = append(sources, src)
+		}
+	}
+	st.Sources = sources
+}
+
+// onlyFailedSources returns true if all the entries the server was
+// found with are of discoverers that failed, so it isn't known
+// whether it's still there.
+func (st *Status) onlyFailedSources(failed map[string]bool) bool {
+	if len(st.Sources) == 0 || len(failed) == 0 {
+		return false
+	}
+	for _, src := range st.Sources {
+		if !failed[src.Config] {
+			return false
+		}
+	}
+	return true
+}
+
+// addName adds a name the server is known by, if it's new.
+func (st *Status) addName(name string) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) == 0 {
+		return
+	}
+	for _, n := range st.Names {
+		if n == name {
+			return
+		}
+	}
+	st.Names = append(st.Names, name)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type ProvenanceSuite struct{}
+
+var _ = Suite(&ProvenanceSuite{})
+
+func (s *ProvenanceSuite) TestSources(c *C) {
+	st := new(Status)
+	st.addSource(Provenance{Source: "a", Config: "a=ns1.example.com", Name: "ns1.example.com", revision: 1})
+	st.addSource(Provenance{Source: "domain", Config: "domain=example.com", Name: "ns1.example.com.", revision: 1})
+	st.addSource(Provenance{Source: "a", Config: "a=ns1.example.com", Name: "ns1.example.com", revision: 2})
+	c.Assert(st.Sources, HasLen, 2)
+	c.Check(st.Sources[0].revision, Equals, 2)
+	c.Check(st.Names, DeepEquals, []string{"ns1.example.com"})
+
+	st.addName("geo1.example.com")
+	c.Check(st.Names, DeepEquals, []string{"ns1.example.com", "geo1.example.com"})
+
+	c.Check(st.onlyFailedSources(map[string]bool{"a=ns1.example.com": true}), Equals, false)
+	c.Check(st.onlyFailedSources(map[string]bool{"a=ns1.example.com": true, "domain=example.com": true}), Equals, true)
+
+	st.expireSources(2, map[string]bool{"domain=example.com": true})
+	c.Check(st.Sources, HasLen, 2)
+	st.expireSources(2, nil)
+	c.Assert(st.Sources, HasLen, 1)
+	c.Check(st.Sources[0].Source, Equals, "a")
+}
+
+func (s *ProvenanceSuite) TestHub(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-5", "h": "geo1.example.com", "up": 10})
+	defer fm.Close()
+	ip, ep := fm.Endpoint()
+
+	hub := NewHub()
+	defer hub.Stop()
+
+	hub.MarkConfigurationStart()
+	c.Assert(hub.AddNameSource(ip.String(), ep, Provenance{Source: "a", Config: "a=" + ip.String()}), IsNil)
+	c.Assert(hub.AddNameSource("localhost", ep, Provenance{Source: "txt", Config: "txt=servers,example.com"}), IsNil)
+	hub.MarkConfigurationEnd()
+
+	st := waitStatus(c, hub, func(st *Status) bool { return st.Uptime > 0 })
+	c.Check(st.Names, DeepEquals, []string{"localhost", "geo1.example.com"})
+	c.Assert(st.Sources, HasLen, 2)
+	c.Check(st.Sources[0].Config, Equals, "a="+ip.String())
+	c.Check(st.Sources[0].Name, Equals, "")
+	c.Check(st.Sources[1].Name, Equals, "localhost")
+	c.Check(st.Sources[1].Resolved.IsZero(), Equals, false)
+
+	// the txt entry is gone from the configuration
+	hub.MarkConfigurationStart()
+	c.Assert(hub.AddNameSource(ip.String(), ep, Provenance{Source: "a", Config: "a=" + ip.String()}), IsNil)
+	hub.MarkConfigurationEnd()
+	st = waitStatus(c, hub, func(st *Status) bool { return len(st.Sources) == 1 })
+	c.Check(st.Sources[0].Source, Equals, "a")
+
+	srv := httptest.NewServer(setupMux(hub))
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/api/servers/" + ip.String())
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 200)
+	details := new(apiStatus)
+	c.Assert(json.NewDecoder(res.Body).Decode(details), IsNil)
+	c.Check(details.Sources, HasLen, 1)
+	c.Check(details.UUID, Equals, "uuid-5")
+
+	res, err = http.Get(srv.URL + "/api/servers/192.0.2.1")
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Check(res.StatusCode, Equals, 404)
+}
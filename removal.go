@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RemovalSettings say when a server that discovery doesn't find
+// anymore is removed.
+type RemovalSettings struct {
+	// Rounds is the number of configuration runs a server can be
+	// missing from before it's removed; 1 removes it right away.
+	Rounds int
+	// Grace, if set instead of Rounds, is how long it can be missing.
+	Grace time.Duration
+	// Pins are IPs and names of servers that are never removed.
+	Pins []string
+}
+
+var defaultRemovalSettings = &RemovalSettings{Rounds: 1}
+
+// removalSettingsFromConfig reads removeafter (a number of rounds or
+// a duration) and pin from the [servers] section.
+func removalSettingsFromConfig(cfg *AppConfig) (*RemovalSettings, error) {
+	rs := &RemovalSettings{Rounds: 1}
+	if after := strings.TrimSpace(cfg.Servers.RemoveAfter); len(after) > 0 {
+		if n, err := strconv.Atoi(after); err == nil {
+			if n < 1 {
+				return nil, fmt.Errorf("invalid removeafter '%s', expected at least 1 round", after)
+			}
+			rs.Rounds = n
+		} else {
+			d, err := time.ParseDuration(after)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid removeafter '%s', expected a number of rounds or a duration", after)
+			}
+			rs.Rounds, rs.Grace = 0, d
+		}
+	}
+	for _, pin := range cfg.Servers.Pin {
+		pin = normalizePin(pin)
+		if len(pin) == 0 {
+			return nil, fmt.Errorf("empty servers pin")
+		}
+		rs.Pins = append(rs.Pins, pin)
+	}
+	return rs, nil
+}
+
+func normalizePin(s string) string {
+	s = strings.TrimSpace(s)
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return strings.ToLower(strings.TrimSuffix(s, "."))
+}
+
+// pinned returns true if the configuration pins the server by its IP
+// or one of its names.
+func (rs *RemovalSettings) pinned(st *Status) bool {
+	for _, pin := range rs.Pins {
+		if pin == st.IP {
+			return true
+		}
+		for _, name := range st.Names {
+			if pin == strings.ToLower(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expired returns true if a server missing since the given time and
+// for the number of rounds should be removed now.
+func (rs *RemovalSettings) expired(missed int, since, now time.Time) bool {
+	if rs.Rounds > 0 {
+		return missed >= rs.Rounds
+	}
+	return now.Sub(since) >= rs.Grace
+}
+
+// removalConfig holds the hub's removal settings.
+type removalConfig struct {
+	sync.RWMutex
+	settings *RemovalSettings
+}
+
+func (rc *removalConfig) Settings() *RemovalSettings {
+	rc.RLock()
+	defer rc.RUnlock()
+	if rc.settings == nil {
+		return defaultRemovalSettings
+	}
+	return rc.settings
+}
+
+func (rc *removalConfig) Set(rs *RemovalSettings) {
+	rc.Lock()
+	defer rc.Unlock()
+	rc.settings = rs
+}
+
+// found marks the server as found by the configuration run with the
+// revision, so it's no longer pending removal.
+func (st *Status) found(revision int) {
+	st.revision = revision
+	st.PendingRemoval = false
+	st.MissedRounds = 0
+	st.RemoveAt = nil
+	st.missingSince = time.Time{}
+}
+
+// removalState is the part of a status a configuration run can
+// change, to tell if it did.
+type removalState struct {
+	pinned   bool
+	pending  bool
+	missed   int
+	sources  int
+	removeAt time.Time
+}
+
+func (st *Status) removalState() removalState {
+	rs := removalState{
+		pinned:  st.Pinned,
+		pending: st.PendingRemoval,
+		missed:  st.MissedRounds,
+		sources: len(st.Sources),
+	}
+	if st.RemoveAt != nil {
+		rs.removeAt = *st.RemoveAt
+	}
+	return rs
+}
+
+// pinRequest asks the arbiter to pin or unpin the server at IP.
+type pinRequest struct {
+	IP     string
+	Pinned bool
+	result chan *Status
+}
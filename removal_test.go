@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type RemovalSuite struct{}
+
+var _ = Suite(&RemovalSuite{})
+
+func (s *RemovalSuite) TestConfig(c *C) {
+	cfg := new(AppConfig)
+	rs, err := removalSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Check(rs.Rounds, Equals, 1)
+
+	cfg.Servers.RemoveAfter = "3"
+	cfg.Servers.Pin = []string{"NS1.example.com.", "2001:db8:0::53"}
+	rs, err = removalSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Check(rs.Rounds, Equals, 3)
+	c.Check(rs.Pins, DeepEquals, []string{"ns1.example.com", "2001:db8::53"})
+	c.Check(rs.pinned(&Status{IP: "192.0.2.1", Names: []string{"ns1.example.com"}}), Equals, true)
+	c.Check(rs.pinned(&Status{IP: "2001:db8::53"}), Equals, true)
+	c.Check(rs.pinned(&Status{IP: "192.0.2.1"}), Equals, false)
+
+	cfg.Servers.RemoveAfter = "10m"
+	rs, err = removalSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Check(rs.Rounds, Equals, 0)
+	c.Check(rs.Grace, Equals, 10*time.Minute)
+	now := time.Now()
+	c.Check(rs.expired(5, now.Add(-9*time.Minute), now), Equals, false)
+	c.Check(rs.expired(1, now.Add(-10*time.Minute), now), Equals, true)
+
+	for _, bad := range []string{"0", "soon", "-1m"} {
+		cfg.Servers.RemoveAfter = bad
+		_, err = removalSettingsFromConfig(cfg)
+		c.Check(err, ErrorMatches, "invalid removeafter '"+bad+"'.*")
+	}
+}
+
+// configRound runs a configuration that finds the given servers.
+func configRound(c *C, hub *StatusHub, ep Endpoint, ips ...string) {
+	hub.MarkConfigurationStart()
+	for _, ip := range ips {
+		c.Assert(hub.AddNameSource(ip, ep, Provenance{Source: "a", Config: "a=" + ip}), IsNil)
+	}
+	hub.MarkConfigurationEnd()
+}
+
+func (s *RemovalSuite) TestRounds(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-8", "up": 10})
+	defer fm.Close()
+	ip, ep := fm.Endpoint()
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetRemoval(&RemovalSettings{Rounds: 3})
+
+	configRound(c, hub, ep, ip.String())
+	waitStatus(c, hub, func(st *Status) bool { return st.Uptime > 0 })
+
+	configRound(c, hub, ep)
+	configRound(c, hub, ep)
+	st := waitStatus(c, hub, func(st *Status) bool { return st.MissedRounds == 2 })
+	c.Check(st.PendingRemoval, Equals, true)
+	c.Check(st.RemoveAt, IsNil)
+
+	// found again
+	configRound(c, hub, ep, ip.String())
+	st = waitStatus(c, hub, func(st *Status) bool { return !st.PendingRemoval })
+	c.Check(st.MissedRounds, Equals, 0)
+
+	for i := 0; i < 3; i++ {
+		configRound(c, hub, ep)
+	}
+	c.Check(hub.Status(), HasLen, 0)
+}
+
+func (s *RemovalSuite) TestFailedDiscovery(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-19", "up": 10})
+	defer fm.Close()
+	ip, ep := fm.Endpoint()
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetRemoval(&RemovalSettings{Rounds: 2})
+
+	configRound(c, hub, ep, ip.String())
+	waitStatus(c, hub, func(st *Status) bool { return st.Uptime > 0 })
+	configRound(c, hub, ep)
+	st := waitStatus(c, hub, func(st *Status) bool { return st.MissedRounds == 1 })
+	c.Check(st.PendingRemoval, Equals, true)
+
+	// the discoverer that found it fails, so it's not known to be gone
+	for i := 0; i < 3; i++ {
+		hub.MarkConfigurationStart()
+		hub.MarkDiscoveryFailed([]string{"a=" + ip.String()})
+		hub.MarkConfigurationEnd()
+	}
+	sts := hub.Status()
+	c.Assert(sts, HasLen, 1)
+	c.Check(sts[0].MissedRounds, Equals, 1)
+	c.Check(sts[0].Sources, HasLen, 1)
+
+	// another discoverer failing doesn't keep it
+	hub.MarkConfigurationStart()
+	hub.MarkDiscoveryFailed([]string{"domain=example.com"})
+	hub.MarkConfigurationEnd()
+	c.Check(hub.Status(), HasLen, 0)
+}
+
+func (s *RemovalSuite) TestGrace(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-9", "up": 10})
+	defer fm.Close()
+	ip, ep := fm.Endpoint()
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetRemoval(&RemovalSettings{Grace: 200 * time.Millisecond})
+
+	configRound(c, hub, ep, ip.String())
+	waitStatus(c, hub, func(st *Status) bool { return st.Uptime > 0 })
+
+	configRound(c, hub, ep)
+	configRound(c, hub, ep)
+	st := waitStatus(c, hub, func(st *Status) bool { return st.MissedRounds == 2 })
+	c.Check(st.PendingRemoval, Equals, true)
+	c.Assert(st.RemoveAt, NotNil)
+	c.Check(st.RemoveAt.After(time.Now()), Equals, true)
+
+	time.Sleep(250 * time.Millisecond)
+	configRound(c, hub, ep)
+	c.Check(hub.Status(), HasLen, 0)
+}
+
+func (s *RemovalSuite) TestPin(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-10", "up": 10})
+	defer fm.Close()
+	ip, ep := fm.Endpoint()
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetFamily(FamilyIPv4)
+	hub.SetRemoval(&RemovalSettings{Rounds: 1, Pins: []string{"localhost"}})
+
+	// pinned by the name it was found with
+	hub.MarkConfigurationStart()
+	c.Assert(hub.AddNameSource("localhost", ep, Provenance{Source: "a", Config: "a=localhost"}), IsNil)
+	hub.MarkConfigurationEnd()
+	waitStatus(c, hub, func(st *Status) bool { return st.Uptime > 0 })
+	configRound(c, hub, ep)
+	st := waitStatus(c, hub, func(st *Status) bool { return st.Pinned })
+	c.Check(st.PendingRemoval, Equals, false)
+
+	// pinned with the API
+	hub.SetRemoval(&RemovalSettings{Rounds: 1})
+	srv := httptest.NewServer(setupMux(hub))
+	defer srv.Close()
+	req, _ := http.NewRequest("PUT", srv.URL+"/api/servers/"+ip.String()+"/pin", nil)
+	res, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, 200)
+	details := new(apiStatus)
+	c.Assert(json.NewDecoder(res.Body).Decode(details), IsNil)
+	res.Body.Close()
+	c.Check(details.Pinned, Equals, true)
+
+	// the status returned is a copy
+	st = hub.Pin(ip.String(), true)
+	c.Assert(st, NotNil)
+	st.Pinned = false
+	st.Names[0] = "changed"
+	c.Check(hub.Pin(ip.String(), true).Names[0], Equals, "localhost")
+
+	configRound(c, hub, ep)
+	c.Check(hub.Status(), HasLen, 1)
+	c.Check(hub.SavedServers()[0].Pinned, Equals, true)
+
+	req, _ = http.NewRequest("DELETE", srv.URL+"/api/servers/"+ip.String()+"/pin", nil)
+	res, err = http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Check(res.StatusCode, Equals, 200)
+	configRound(c, hub, ep)
+	c.Check(hub.Status(), HasLen, 0)
+
+	req, _ = http.NewRequest("PUT", srv.URL+"/api/servers/192.0.2.1/pin", nil)
+	res, err = http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Check(res.StatusCode, Equals, 404)
+}
+
+func (s *RemovalSuite) TestUnchanged(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-11", "up": 10})
+	ip, ep := fm.Endpoint()
+	fm.Close()
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetConnectionSettings(&ConnectionSettings{
+		DialTimeout:      time.Second,
+		HandshakeTimeout: time.Second,
+		ReadTimeout:      time.Second,
+		MinBackoff:       time.Minute,
+		MaxBackoff:       time.Minute,
+	})
+	hub.SetRemoval(&RemovalSettings{Rounds: 1, Pins: []string{ip.String()}})
+
+	configRound(c, hub, ep, ip.String())
+	waitState(c, hub, StateBackoff)
+	configRound(c, hub, ep)
+	st := hub.Status()[0]
+	c.Check(st.Pinned, Equals, true)
+
+	// a configuration run that changes nothing isn't in the changes
+	generation := hub.Snapshot().Generation
+	configRound(c, hub, ep)
+	c.Check(hub.Snapshot().Generation, Equals, generation)
+	c.Check(hub.Snapshot().ChangesSince(generation).Servers, HasLen, 0)
+}
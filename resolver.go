@@ -0,0 +1,405 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const defaultResolverTimeout = 2 * time.Second
+
+// Resolver does the DNS lookups for discovery.
+type Resolver interface {
+	LookupIP(name string) ([]net.IP, error)
+	LookupNS(name string) ([]string, error)
+	LookupTXT(name string) ([]string, error)
+	LookupSRV(name string) ([]*net.SRV, error)
+}
+
+// systemResolver uses the resolver of the host.
+type systemResolver struct{}
+
+func (systemResolver) LookupIP(name string) ([]net.IP, error) {
+	return net.LookupIP(name)
+}
+
+func (systemResolver) LookupNS(name string) ([]string, error) {
+	nses, err := net.LookupNS(name)
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{}
+	for _, ns := range nses {
+		hosts = append(hosts, ns.Host)
+	}
+	return hosts, nil
+}
+
+func (systemResolver) LookupTXT(name string) ([]string, error) {
+	return net.LookupTXT(name)
+}
+
+func (systemResolver) LookupSRV(name string) ([]*net.SRV, error) {
+	_, srvs, err := net.LookupSRV("", "", name)
+	return srvs, err
+}
+
+// ResolverSettings is the [resolver] configuration. Without
+// nameservers the system resolver is used.
+type ResolverSettings struct {
+	Nameservers []string
+	// Protocol is udp (falling back to tcp for truncated answers),
+	// tcp or tls for DNS over TLS.
+	Protocol   string
+	Timeout    time.Duration
+	ServerName string
+	RootCAs    *x509.CertPool
+	// MaxTTL, if set, limits how long answers are cached.
+	MaxTTL time.Duration
+}
+
+func resolverSettingsFromConfig(cfg *AppConfig) (*ResolverSettings, error) {
+	rs := &ResolverSettings{
+		Protocol:   strings.ToLower(cfg.Resolver.Protocol),
+		Timeout:    defaultResolverTimeout,
+		ServerName: cfg.Resolver.ServerName,
+	}
+	port := "53"
+	switch rs.Protocol {
+	case "":
+		rs.Protocol = "udp"
+	case "udp", "tcp":
+	case "tls":
+		port = "853"
+	default:
+		return nil, fmt.Errorf("invalid resolver protocol '%s', expected udp, tcp or tls", cfg.Resolver.Protocol)
+	}
+	for _, ns := range cfg.Resolver.Nameserver {
+		if _, _, err := net.SplitHostPort(ns); err != nil {
+			ns = net.JoinHostPort(strings.Trim(ns, "[]"), port)
+		}
+		host, _, _ := net.SplitHostPort(ns)
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid resolver nameserver '%s', expected an IP address", ns)
+		}
+		rs.Nameservers = append(rs.Nameservers, ns)
+	}
+	if len(cfg.Resolver.Timeout) > 0 {
+		d, err := time.ParseDuration(cfg.Resolver.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid resolver timeout '%s'", cfg.Resolver.Timeout)
+		}
+		rs.Timeout = d
+	}
+	if len(cfg.Resolver.MaxTTL) > 0 {
+		d, err := time.ParseDuration(cfg.Resolver.MaxTTL)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid resolver maxttl '%s'", cfg.Resolver.MaxTTL)
+		}
+		rs.MaxTTL = d
+	}
+	if len(cfg.Resolver.CA) > 0 {
+		pem, err := ioutil.ReadFile(cfg.Resolver.CA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read resolver ca: %s", err)
+		}
+		rs.RootCAs = x509.NewCertPool()
+		if !rs.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in resolver ca %s", cfg.Resolver.CA)
+		}
+	}
+	return rs, nil
+}
+
+// NewResolver returns the resolver for the settings.
+func NewResolver(rs *ResolverSettings) Resolver {
+	if rs == nil || len(rs.Nameservers) == 0 {
+		return systemResolver{}
+	}
+	return newDNSResolver(rs)
+}
+
+// ResolveError is a failed lookup, with what went wrong with each
+// nameserver that was tried.
+type ResolveError struct {
+	Name     string
+	Type     string
+	Failures []string
+}
+
+func (e *ResolveError) fail(server, proto, reason string) {
+	e.Failures = append(e.Failures, server+"/"+proto+": "+reason)
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("lookup %s %s: %s", e.Name, e.Type, strings.Join(e.Failures, "; "))
+}
+
+// dnsResolver queries the configured nameservers in order and
+// caches the answers for their TTL.
+type dnsResolver struct {
+	sync.Mutex
+	settings *ResolverSettings
+	cache    map[string]*cachedAnswer
+	now      func() time.Time
+}
+
+type cachedAnswer struct {
+	rrs     []dns.RR
+	expires time.Time
+}
+
+func newDNSResolver(rs *ResolverSettings) *dnsResolver {
+	return &dnsResolver{
+		settings: rs,
+		cache:    make(map[string]*cachedAnswer),
+		now:      time.Now,
+	}
+}
+
+func (r *dnsResolver) client(proto string) *dns.Client {
+	c := &dns.Client{Net: proto, Timeout: r.settings.Timeout}
+	if proto == "tls" {
+		c.Net = "tcp-tls"
+		c.TLSConfig = &tls.Config{
+			ServerName: r.settings.ServerName,
+			RootCAs:    r.settings.RootCAs,
+		}
+	}
+	return c
+}
+
+// maxCNAMEs is how many CNAMEs a lookup follows.
+const maxCNAMEs = 8
+
+// lookup returns the records of the type for the name, following
+// CNAMEs. NXDOMAIN is an error; no records of the type isn't.
+func (r *dnsResolver) lookup(name string, qtype uint16) ([]dns.RR, error) {
+	rrs, _, err := r.lookupDepth(name, qtype, 0)
+	return rrs, err
+}
+
+// lookupDepth is lookup for a name that's the target of depth
+// CNAMEs. It also returns for how long the answer is good.
+func (r *dnsResolver) lookupDepth(name string, qtype uint16, depth int) ([]dns.RR, uint32, error) {
+	name = dns.Fqdn(name)
+	key := strings.ToLower(name) + "/" + dns.TypeToString[qtype]
+
+	r.Lock()
+	cached, ok := r.cache[key]
+	if now := r.now(); ok && now.Before(cached.expires) {
+		r.Unlock()
+		return cached.rrs, uint32(cached.expires.Sub(now).Seconds()), nil
+	}
+	delete(r.cache, key)
+	r.Unlock()
+
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = true
+
+	rerr := &ResolveError{Name: name, Type: dns.TypeToString[qtype]}
+	for _, ns := range r.settings.Nameservers {
+		proto := r.settings.Protocol
+		resp, _, err := r.client(proto).Exchange(m, ns)
+		if err == nil && resp.Truncated && proto == "udp" {
+			proto = "tcp"
+			resp, _, err = r.client(proto).Exchange(m, ns)
+		}
+		if err != nil {
+			rerr.fail(ns, proto, err.Error())
+			continue
+		}
+		switch resp.Rcode {
+		case dns.RcodeSuccess:
+		case dns.RcodeNameError:
+			rerr.fail(ns, proto, "no such name (NXDOMAIN)")
+			return nil, 0, rerr
+		default:
+			// try the next server
+			rerr.fail(ns, proto, "server answered "+dns.RcodeToString[resp.Rcode])
+			continue
+		}
+
+		rrs, target, ttl := answerRecords(resp.Answer, name, qtype)
+		if len(target) > 0 {
+			// the server didn't follow the CNAME to the end
+			if depth+countCNAMEs(resp.Answer) > maxCNAMEs {
+				rerr.Failures = []string{fmt.Sprintf("more than %d CNAMEs", maxCNAMEs)}
+				return nil, 0, rerr
+			}
+			var targetTTL uint32
+			var err error
+			rrs, targetTTL, err = r.lookupDepth(target, qtype, depth+countCNAMEs(resp.Answer))
+			if err != nil {
+				return nil, 0, err
+			}
+			if targetTTL < ttl {
+				ttl = targetTTL
+			}
+		}
+		r.store(key, rrs, time.Duration(ttl)*time.Second)
+		return rrs, ttl, nil
+	}
+	return nil, 0, rerr
+}
+
+// answerRecords returns the records of the type for the name in the
+// answer, following the CNAMEs in it, and the lowest TTL of those
+// records. If the CNAMEs lead to a name without records in the
+// answer, that name is returned as the target to look up.
+func answerRecords(answer []dns.RR, name string, qtype uint16) ([]dns.RR, string, uint32) {
+	rrs := []dns.RR{}
+	var ttl uint32
+	seen := false
+	owner := name
+	for i := 0; i <= maxCNAMEs; i++ {
+		next := ""
+		for _, rr := range answer {
+			h := rr.Header()
+			if !strings.EqualFold(h.Name, owner) {
+				continue
+			}
+			switch {
+			case h.Rrtype == qtype:
+				rrs = append(rrs, rr)
+			case h.Rrtype == dns.TypeCNAME:
+				next = rr.(*dns.CNAME).Target
+			default:
+				continue
+			}
+			if !seen || h.Ttl < ttl {
+				ttl = h.Ttl
+				seen = true
+			}
+		}
+		if len(rrs) > 0 || len(next) == 0 {
+			break
+		}
+		owner = next
+	}
+	if len(rrs) == 0 && owner != name {
+		return rrs, owner, ttl
+	}
+	return rrs, "", ttl
+}
+
+func countCNAMEs(answer []dns.RR) int {
+	n := 0
+	for _, rr := range answer {
+		if rr.Header().Rrtype == dns.TypeCNAME {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *dnsResolver) store(key string, rrs []dns.RR, ttl time.Duration) {
+	if r.settings.MaxTTL > 0 && ttl > r.settings.MaxTTL {
+		ttl = r.settings.MaxTTL
+	}
+	if ttl <= 0 || len(rrs) == 0 {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.cache[key] = &cachedAnswer{rrs: rrs, expires: r.now().Add(ttl)}
+}
+
+// LookupIP returns the IPv4 and IPv6 addresses of the name.
+func (r *dnsResolver) LookupIP(name string) ([]net.IP, error) {
+	ips := []net.IP{}
+	var lastErr error
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		rrs, err := r.lookup(name, qtype)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, rr := range rrs {
+			switch rr := rr.(type) {
+			case *dns.A:
+				ips = append(ips, rr.A)
+			case *dns.AAAA:
+				ips = append(ips, rr.AAAA)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, fmt.Errorf("lookup %s: no addresses", dns.Fqdn(name))
+	}
+	return ips, nil
+}
+
+func (r *dnsResolver) LookupNS(name string) ([]string, error) {
+	rrs, err := r.lookup(name, dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{}
+	for _, rr := range rrs {
+		hosts = append(hosts, rr.(*dns.NS).Ns)
+	}
+	return hosts, nil
+}
+
+func (r *dnsResolver) LookupTXT(name string) ([]string, error) {
+	rrs, err := r.lookup(name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	txts := []string{}
+	for _, rr := range rrs {
+		txts = append(txts, strings.Join(rr.(*dns.TXT).Txt, ""))
+	}
+	return txts, nil
+}
+
+func (r *dnsResolver) LookupSRV(name string) ([]*net.SRV, error) {
+	rrs, err := r.lookup(name, dns.TypeSRV)
+	if err != nil {
+		return nil, err
+	}
+	srvs := []*net.SRV{}
+	for _, rr := range rrs {
+		srv := rr.(*dns.SRV)
+		srvs = append(srvs, &net.SRV{
+			Target:   srv.Target,
+			Port:     srv.Port,
+			Priority: srv.Priority,
+			Weight:   srv.Weight,
+		})
+	}
+	return srvs, nil
+}
+
+// resolverHolder holds the hub's current resolver.
+type resolverHolder struct {
+	sync.RWMutex
+	resolver Resolver
+}
+
+func (rh *resolverHolder) Resolver() Resolver {
+	rh.RLock()
+	defer rh.RUnlock()
+	if rh.resolver == nil {
+		return systemResolver{}
+	}
+	return rh.resolver
+}
+
+func (rh *resolverHolder) Set(r Resolver) {
+	rh.Lock()
+	defer rh.Unlock()
+	rh.resolver = r
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+	. "gopkg.in/check.v1"
+)
+
+type ResolverSuite struct {
+	stub *stubDNS
+	dir  string
+}
+
+var _ = Suite(&ResolverSuite{})
+
+func (s *ResolverSuite) SetUpTest(c *C) {
+	s.stub = newStubDNS(c,
+		"ns1.example.test. 300 IN A 127.0.0.1",
+		"ns1.example.test. 300 IN AAAA ::1",
+		"example.test. 300 IN NS ns1.example.test.",
+		"servers.example.test. 300 IN TXT \"ns1 ns2\"",
+		"_geodns-monitor._tcp.example.test. 300 IN SRV 10 10 8053 ns1.example.test.",
+	)
+	dir, err := ioutil.TempDir("", "dnsmonitor-resolver")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *ResolverSuite) TearDownTest(c *C) {
+	s.stub.Close()
+	os.RemoveAll(s.dir)
+}
+
+func (s *ResolverSuite) settings(c *C, resolver ...string) *ResolverSettings {
+	cfg := new(AppConfig)
+	cfg.Resolver.Nameserver = []string{net.JoinHostPort("127.0.0.1", strconv.Itoa(s.stub.Port))}
+	cfg.Resolver.Timeout = "200ms"
+	for i := 0; i+1 < len(resolver); i += 2 {
+		switch resolver[i] {
+		case "protocol":
+			cfg.Resolver.Protocol = resolver[i+1]
+		case "nameserver":
+			cfg.Resolver.Nameserver = append([]string{resolver[i+1]}, cfg.Resolver.Nameserver...)
+		case "maxttl":
+			cfg.Resolver.MaxTTL = resolver[i+1]
+		}
+	}
+	rs, err := resolverSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+	return rs
+}
+
+func (s *ResolverSuite) TestConfig(c *C) {
+	cfg := new(AppConfig)
+	rs, err := resolverSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+	_, system := NewResolver(rs).(systemResolver)
+	c.Check(system, Equals, true)
+
+	cfg.Resolver.Nameserver = []string{"192.0.2.53", "[2001:db8::53]:5353"}
+	cfg.Resolver.Protocol = "TLS"
+	rs, err = resolverSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Check(rs.Nameservers, DeepEquals, []string{"192.0.2.53:853", "[2001:db8::53]:5353"})
+	c.Check(rs.Protocol, Equals, "tls")
+
+	cfg.Resolver.Protocol = "doh"
+	_, err = resolverSettingsFromConfig(cfg)
+	c.Check(err, ErrorMatches, "invalid resolver protocol 'doh'.*")
+
+	cfg.Resolver.Protocol = ""
+	cfg.Resolver.Nameserver = []string{"dns.example.com"}
+	_, err = resolverSettingsFromConfig(cfg)
+	c.Check(err, ErrorMatches, "invalid resolver nameserver 'dns.example.com:53'.*")
+}
+
+func (s *ResolverSuite) TestLookups(c *C) {
+	for _, proto := range []string{"udp", "tcp"} {
+		r := NewResolver(s.settings(c, "protocol", proto))
+
+		ips, err := r.LookupIP("ns1.example.test")
+		c.Assert(err, IsNil)
+		c.Check(ips, HasLen, 2)
+		c.Check(ips[0].String(), Equals, "127.0.0.1")
+		c.Check(ips[1].String(), Equals, "::1")
+
+		nses, err := r.LookupNS("example.test")
+		c.Assert(err, IsNil)
+		c.Check(nses, DeepEquals, []string{"ns1.example.test."})
+
+		txts, err := r.LookupTXT("servers.example.test")
+		c.Assert(err, IsNil)
+		c.Check(txts, DeepEquals, []string{"ns1 ns2"})
+
+		srvs, err := r.LookupSRV("_geodns-monitor._tcp.example.test")
+		c.Assert(err, IsNil)
+		c.Assert(srvs, HasLen, 1)
+		c.Check(srvs[0].Target, Equals, "ns1.example.test.")
+		c.Check(srvs[0].Port, Equals, uint16(8053))
+	}
+}
+
+func (s *ResolverSuite) TestCNAME(c *C) {
+	s.stub.Add(c, "alias.example.test. 300 IN CNAME alias2.example.test.")
+	s.stub.Add(c, "alias2.example.test. 60 IN CNAME ns1.example.test.")
+	s.stub.Add(c, "loop1.example.test. 300 IN CNAME loop2.example.test.")
+	s.stub.Add(c, "loop2.example.test. 300 IN CNAME loop1.example.test.")
+	r := newDNSResolver(s.settings(c))
+
+	ips, err := r.LookupIP("alias.example.test")
+	c.Assert(err, IsNil)
+	c.Check(ips, HasLen, 2)
+	c.Check(ips[0].String(), Equals, "127.0.0.1")
+	rrs, err := r.lookup("alias.example.test", dns.TypeA)
+	c.Assert(err, IsNil)
+	c.Check(rrs[0].Header().Name, Equals, "ns1.example.test.")
+	c.Check(r.cache["alias.example.test./A"].expires.Before(time.Now().Add(61*time.Second)), Equals, true)
+
+	_, err = r.LookupIP("loop1.example.test")
+	c.Check(err, ErrorMatches, "lookup loop1.example.test. (A|AAAA): more than 8 CNAMEs")
+
+	// a chain in one answer
+	answer := []dns.RR{}
+	for _, s := range []string{
+		"www.example.test. 300 IN CNAME geo.example.test.",
+		"geo.example.test. 30 IN CNAME edge.example.test.",
+		"edge.example.test. 300 IN A 192.0.2.1",
+		"other.example.test. 300 IN A 192.0.2.2",
+	} {
+		rr, err := dns.NewRR(s)
+		c.Assert(err, IsNil)
+		answer = append(answer, rr)
+	}
+	rrs, target, ttl := answerRecords(answer, "www.example.test.", dns.TypeA)
+	c.Check(rrs, HasLen, 1)
+	c.Check(target, Equals, "")
+	c.Check(ttl, Equals, uint32(30))
+	rrs, target, _ = answerRecords(answer[:2], "www.example.test.", dns.TypeA)
+	c.Check(rrs, HasLen, 0)
+	c.Check(target, Equals, "edge.example.test.")
+}
+
+func (s *ResolverSuite) TestErrors(c *C) {
+	r := NewResolver(s.settings(c))
+	_, err := r.LookupNS("nope.example.test")
+	c.Check(err, ErrorMatches, "lookup nope.example.test. NS: 127.0.0.1:[0-9]+/udp: no such name \\(NXDOMAIN\\)")
+
+	// the first nameserver doesn't answer
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer silent.Close()
+	r = NewResolver(s.settings(c, "nameserver", silent.LocalAddr().String()))
+	nses, err := r.LookupNS("example.test")
+	c.Assert(err, IsNil)
+	c.Check(nses, HasLen, 1)
+
+	// with both gone, each failure is reported
+	s.stub.Close()
+	_, err = r.LookupTXT("servers.example.test")
+	c.Check(err, ErrorMatches, "lookup servers.example.test. TXT: 127.0.0.1:[0-9]+/udp: .*timeout.*; 127.0.0.1:[0-9]+/udp: .*")
+}
+
+func (s *ResolverSuite) TestCache(c *C) {
+	r := newDNSResolver(s.settings(c))
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	ips, err := r.LookupIP("ns1.example.test")
+	c.Assert(err, IsNil)
+	c.Check(ips, HasLen, 2)
+
+	s.stub.Add(c, "ns1.example.test. 300 IN A 127.0.0.2")
+	ips, _ = r.LookupIP("ns1.example.test")
+	c.Check(ips, HasLen, 2)
+
+	now = now.Add(301 * time.Second)
+	ips, _ = r.LookupIP("ns1.example.test")
+	c.Check(ips, HasLen, 3)
+
+	// maxttl is shorter than the TTL
+	r = newDNSResolver(s.settings(c, "maxttl", "10s"))
+	r.now = func() time.Time { return now }
+	nses, _ := r.LookupNS("example.test")
+	c.Check(nses, HasLen, 1)
+	s.stub.Add(c, "example.test. 300 IN NS ns2.example.test.")
+	nses, _ = r.LookupNS("example.test")
+	c.Check(nses, HasLen, 1)
+	now = now.Add(11 * time.Second)
+	nses, _ = r.LookupNS("example.test")
+	c.Check(nses, HasLen, 2)
+}
+
+// selfSigned makes a certificate for name and writes it to a PEM
+// file in dir.
+func selfSigned(c *C, dir, name string) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+
+	path := filepath.Join(dir, name+".pem")
+	c.Assert(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644), IsNil)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, path
+}
+
+func (s *ResolverSuite) TestTLS(c *C) {
+	cert, ca := selfSigned(c, s.dir, "dns.example.test")
+	port := s.stub.ServeTLS(c, cert)
+
+	cfg := new(AppConfig)
+	cfg.Resolver.Nameserver = []string{net.JoinHostPort("127.0.0.1", strconv.Itoa(port))}
+	cfg.Resolver.Protocol = "tls"
+	cfg.Resolver.ServerName = "dns.example.test"
+	cfg.Resolver.CA = ca
+	cfg.Resolver.Timeout = "1s"
+	rs, err := resolverSettingsFromConfig(cfg)
+	c.Assert(err, IsNil)
+
+	nses, err := NewResolver(rs).LookupNS("example.test")
+	c.Assert(err, IsNil)
+	c.Check(nses, HasLen, 1)
+
+	// the certificate isn't for this name
+	rs.ServerName = "other.example.test"
+	_, err = NewResolver(rs).LookupNS("example.test")
+	c.Check(err, ErrorMatches, "lookup example.test. NS: .*/tls: .*certificate.*")
+}
+
+func (s *ResolverSuite) TestDiscovery(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-7", "up": 10})
+	defer fm.Close()
+	_, ep := fm.Endpoint()
+	s.stub.Add(c, "_mon._tcp.example.test. 300 IN SRV 10 10 "+strconv.Itoa(ep.Port)+" ns1.example.test.")
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetResolver(NewResolver(s.settings(c)))
+	hub.SetFamily(FamilyIPv4)
+
+	cfg := new(AppConfig)
+	cfg.Servers.Srv = []string{"_mon._tcp.example.test"}
+	cfg.Servers.Family = "ipv4"
+	configure(hub, cfg)
+
+	st := waitStatus(c, hub, func(st *Status) bool { return st.Uptime > 0 })
+	c.Check(st.IP, Equals, "127.0.0.1")
+	c.Check(st.Port, Equals, ep.Port)
+	c.Assert(st.Sources, HasLen, 1)
+	c.Check(st.Sources[0].Source, Equals, "srv")
+	c.Check(st.Sources[0].Name, Equals, "ns1.example.test.")
+	names := st.Names
+	sort.Strings(names)
+	c.Check(names, DeepEquals, []string{"ns1.example.test"})
+
+	// a name without addresses of the family is an error
+	s.stub.Add(c, "v4only.example.test. 300 IN A 127.0.0.2")
+	hub.SetFamily(FamilyIPv6)
+	err := hub.AddNameEndpoint("v4only.example.test", ep)
+	c.Check(err, ErrorMatches, "No addresses left for 'v4only.example.test' by the family filter, only monitoring ipv6")
+}
+
+func (s *ResolverSuite) TestDiscoveryHosts(c *C) {
+	// the system resolver doesn't know these names
+	s.stub.Add(c, "targets.example.test. 300 IN A 127.0.0.1")
+	s.stub.Add(c, "inventory.example.test. 300 IN SOA ns1.example.test. hostmaster.example.test. 1 3600 600 86400 300")
+	s.stub.Add(c, "ams1.inventory.example.test. 300 IN A 192.0.2.1")
+	r := NewResolver(s.settings(c))
+
+	server := net.JoinHostPort("targets.example.test", strconv.Itoa(s.stub.Port))
+	axfr, err := newAXFRDiscoverer("inventory.example.test@"+server, defaultEndpoint)
+	c.Assert(err, IsNil)
+	targets, err := axfr.Discover(r)
+	c.Assert(err, IsNil)
+	c.Check(targetHosts(targets), DeepEquals, []string{"192.0.2.1"})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"targets": ["192.0.2.2"]}]`))
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	d := &httpDiscoverer{url: "http://" + net.JoinHostPort("targets.example.test", port) + "/targets", endpoint: defaultEndpoint}
+	targets, err = d.Discover(r)
+	c.Assert(err, IsNil)
+	c.Check(targetHosts(targets), DeepEquals, []string{"192.0.2.2"})
+
+	d = &httpDiscoverer{url: "http://" + net.JoinHostPort("missing.example.test", port) + "/targets"}
+	_, err = d.Discover(r)
+	c.Check(err, ErrorMatches, ".*missing.example.test.*")
+}
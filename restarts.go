@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxRestartEvents is how many restarts are kept for each server.
+const maxRestartEvents = 50
+
+// RestartEvent is a restart of a server, or a reset of its query
+// counter, seen in its status updates.
+type RestartEvent struct {
+	Time time.Time `json:"time"`
+	IP   string    `json:"ip"`
+	Name string    `json:"name"`
+	// Reason is uuid, started, uptime or queries, for what showed
+	// the restart; Detail has the values before and after.
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+	// Queries is the count before the reset, which is added to the
+	// server's total.
+	Queries int64 `json:"queries"`
+}
+
+// detectRestart compares an update that has data with what the
+// status had before and returns the restart it shows, if any.
+func (st *Status) detectRestart(new *ServerUpdate, now time.Time) *RestartEvent {
+	ev := &RestartEvent{Time: now, IP: st.IP, Name: st.Name, Queries: st.Queries}
+	switch {
+	case len(st.UUID) > 0 && len(new.UUID) > 0 && st.UUID != new.UUID:
+		ev.Reason = "uuid"
+		ev.Detail = fmt.Sprintf("uuid changed from %s to %s", st.UUID, new.UUID)
+	case st.started > 0 && new.Started > 0 && st.started != new.Started:
+		ev.Reason = "started"
+		ev.Detail = fmt.Sprintf("start time changed from %s to %s",
+			time.Unix(int64(st.started), 0).UTC().Format(time.RFC3339),
+			time.Unix(int64(new.Started), 0).UTC().Format(time.RFC3339))
+	case st.Uptime > 0 && new.Uptime > 0 && new.Uptime < st.Uptime:
+		ev.Reason = "uptime"
+		ev.Detail = fmt.Sprintf("uptime went from %ds to %ds", st.Uptime, new.Uptime)
+	case new.Queries < st.Queries:
+		ev.Reason = "queries"
+		ev.Detail = fmt.Sprintf("query count went from %d to %d", st.Queries, new.Queries)
+	default:
+		return nil
+	}
+	return ev
+}
+
+// hasData returns false for the updates that only say the
+// connection isn't working.
+func (new *ServerUpdate) hasData() bool {
+	return len(new.UUID) > 0 || new.Uptime > 0 || new.Started > 0 || new.Queries > 0
+}
+
+// updateCounters applies the counters of an update that has data,
+// returning the restart it shows, if any. TotalQueries keeps going
+// up across restarts.
+func (st *Status) updateCounters(new *ServerUpdate, now time.Time) *RestartEvent {
+	ev := st.detectRestart(new, now)
+	if ev != nil {
+		st.queryBase += st.Queries
+		st.Restarts++
+		t := now
+		st.LastRestart = &t
+		// the uptime from before the restart mustn't be compared
+		// with the next update
+		st.Uptime = new.Uptime
+	}
+	st.Queries = new.Queries
+	st.TotalQueries = st.queryBase + st.Queries
+	if new.Started > 0 {
+		st.started = new.Started
+	}
+	return ev
+}
+
+// RestartLog keeps the recent restarts of each server.
+type RestartLog struct {
+	sync.RWMutex
+	events map[string][]RestartEvent
+}
+
+func NewRestartLog() *RestartLog {
+	return &RestartLog{events: make(map[string][]RestartEvent)}
+}
+
+// Record adds a restart of the server at ev.IP.
+func (rl *RestartLog) Record(ev *RestartEvent) {
+	rl.Lock()
+	defer rl.Unlock()
+	events := append(rl.events[ev.IP], *ev)
+	if len(events) > maxRestartEvents {
+		events = append([]RestartEvent{}, events[len(events)-maxRestartEvents:]...)
+	}
+	rl.events[ev.IP] = events
+}
+
+// Forget drops the restarts of a server that's no longer monitored.
+func (rl *RestartLog) Forget(ip string) {
+	rl.Lock()
+	defer rl.Unlock()
+	delete(rl.events, ip)
+}
+
+// Move makes the restarts of the server at from those of the server
+// at to, for a server found at another address.
+func (rl *RestartLog) Move(from, to string) {
+	rl.Lock()
+	defer rl.Unlock()
+	if from == to || len(rl.events[from]) == 0 {
+		return
+	}
+	events := append(rl.events[to], rl.events[from]...)
+	sort.Sort(sort.Reverse(restartsByTime(events)))
+	if len(events) > maxRestartEvents {
+		events = events[len(events)-maxRestartEvents:]
+	}
+	rl.events[to] = events
+	delete(rl.events, from)
+}
+
+// saved returns the restarts of the server at ip, oldest first, for
+// the state file.
+func (rl *RestartLog) saved(ip string) []RestartEvent {
+	rl.RLock()
+	defer rl.RUnlock()
+	return append([]RestartEvent(nil), rl.events[ip]...)
+}
+
+// restore sets the restarts of the server at ip from the state file.
+func (rl *RestartLog) restore(ip string, events []RestartEvent) {
+	rl.Lock()
+	defer rl.Unlock()
+	if len(events) == 0 {
+		return
+	}
+	if len(events) > maxRestartEvents {
+		events = events[len(events)-maxRestartEvents:]
+	}
+	rl.events[ip] = append([]RestartEvent(nil), events...)
+}
+
+// Events returns the restarts of the server at ip, newest first.
+func (rl *RestartLog) Events(ip string) []RestartEvent {
+	rl.RLock()
+	defer rl.RUnlock()
+	events := make([]RestartEvent, 0, len(rl.events[ip]))
+	for i := len(rl.events[ip]) - 1; i >= 0; i-- {
+		events = append(events, rl.events[ip][i])
+	}
+	return events
+}
+
+// All returns the restarts of all servers, newest first.
+func (rl *RestartLog) All() []RestartEvent {
+	rl.RLock()
+	defer rl.RUnlock()
+	events := []RestartEvent{}
+	for _, evs := range rl.events {
+		events = append(events, evs...)
+	}
+	sort.Sort(restartsByTime(events))
+	return events
+}
+
+type restartsByTime []RestartEvent
+
+func (s restartsByTime) Len() int           { return len(s) }
+func (s restartsByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s restartsByTime) Less(i, j int) bool { return s[i].Time.After(s[j].Time) }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type RestartsSuite struct{}
+
+var _ = Suite(&RestartsSuite{})
+
+func (s *RestartsSuite) TestDetect(c *C) {
+	srv := &Status{IP: "192.0.2.1", Name: "ns1"}
+
+	updates := []struct {
+		update  ServerUpdate
+		reason  string
+		total   int64
+		queries int64
+	}{
+		{ServerUpdate{UUID: "a", Uptime: 100, Started: 1000, Queries: 50}, "", 50, 50},
+		{ServerUpdate{UUID: "a", Uptime: 110, Started: 1000, Queries: 80}, "", 80, 80},
+		// the connection failed
+		{ServerUpdate{}, "", 80, 80},
+		{ServerUpdate{UUID: "a", Uptime: 5, Started: 1000, Queries: 10}, "uptime", 90, 10},
+		{ServerUpdate{UUID: "a", Uptime: 20, Started: 1200, Queries: 15}, "started", 105, 15},
+		{ServerUpdate{UUID: "b", Uptime: 30, Started: 1200, Queries: 20}, "uuid", 125, 20},
+		{ServerUpdate{UUID: "b", Uptime: 40, Started: 1200, Queries: 5}, "queries", 130, 5},
+		{ServerUpdate{UUID: "b", Uptime: 50, Started: 1200, Queries: 25}, "", 150, 25},
+	}
+	restarts := 0
+	for i, t := range updates {
+		update := t.update
+		ev := updateStatus(srv, &update)
+		if t.reason == "" {
+			c.Check(ev, IsNil, Commentf("update %d", i))
+		} else if c.Check(ev, NotNil, Commentf("update %d", i)) {
+			restarts++
+			c.Check(ev.Reason, Equals, t.reason)
+			c.Check(ev.IP, Equals, "192.0.2.1")
+		}
+		c.Check(srv.TotalQueries, Equals, t.total, Commentf("update %d", i))
+		c.Check(srv.Queries, Equals, t.queries, Commentf("update %d", i))
+		c.Check(srv.Restarts, Equals, restarts)
+	}
+	c.Check(srv.LastRestart, NotNil)
+
+	// the total keeps going up after the monitor restarts
+	restored := newSavedServer(srv).status()
+	c.Check(restored.TotalQueries, Equals, int64(150))
+	update := ServerUpdate{UUID: "b", Uptime: 5, Started: 1200, Queries: 3}
+	ev := updateStatus(restored, &update)
+	c.Assert(ev, NotNil)
+	c.Check(ev.Reason, Equals, "uptime")
+	c.Check(ev.Queries, Equals, int64(25))
+	c.Check(restored.TotalQueries, Equals, int64(153))
+	c.Check(restored.Restarts, Equals, 5)
+
+	// a restart without the uptime in the first update after it
+	srv = &Status{IP: "192.0.2.2"}
+	updateStatus(srv, &ServerUpdate{Uptime: 3600, Started: 1000, Queries: 30})
+	c.Check(updateStatus(srv, &ServerUpdate{Started: 4600}), NotNil)
+	c.Check(updateStatus(srv, &ServerUpdate{Uptime: 1, Started: 4600, Queries: 10}), IsNil)
+	c.Check(srv.Restarts, Equals, 1)
+}
+
+func (s *RestartsSuite) TestLog(c *C) {
+	rl := NewRestartLog()
+	now := time.Now()
+	for i := 0; i < maxRestartEvents+5; i++ {
+		rl.Record(&RestartEvent{Time: now.Add(time.Duration(i) * time.Second), IP: "192.0.2.1", Queries: int64(i)})
+	}
+	rl.Record(&RestartEvent{Time: now.Add(time.Hour), IP: "192.0.2.2"})
+
+	events := rl.Events("192.0.2.1")
+	c.Assert(events, HasLen, maxRestartEvents)
+	c.Check(events[0].Queries, Equals, int64(maxRestartEvents+4))
+	c.Check(events[maxRestartEvents-1].Queries, Equals, int64(5))
+
+	all := rl.All()
+	c.Check(all, HasLen, maxRestartEvents+1)
+	c.Check(all[0].IP, Equals, "192.0.2.2")
+
+	rl.Forget("192.0.2.1")
+	c.Check(rl.Events("192.0.2.1"), HasLen, 0)
+	c.Check(rl.All(), HasLen, 1)
+
+	// the server was found at another address
+	rl.Record(&RestartEvent{Time: now, IP: "192.0.2.3"})
+	rl.Move("192.0.2.2", "192.0.2.3")
+	c.Check(rl.Events("192.0.2.2"), HasLen, 0)
+	events = rl.Events("192.0.2.3")
+	c.Assert(events, HasLen, 2)
+	c.Check(events[0].IP, Equals, "192.0.2.2")
+	c.Check(events[1].IP, Equals, "192.0.2.3")
+}
+
+func (s *RestartsSuite) TestHub(c *C) {
+	fs := newFakeStatus()
+	defer fs.srv.Close()
+
+	hub := NewHub()
+	defer hub.Stop()
+	ip, ep := fs.Endpoint()
+	c.Assert(hub.AddNameEndpoint(ip.String(), ep), IsNil)
+
+	waitServer := func(f func(*Status) bool) *Status {
+		for i := 0; i < 50; i++ {
+			if st := hub.Snapshot().Server(ip.String()); st != nil && f(st) {
+				return st
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		c.Fatalf("server status didn't change: %#v", hub.Snapshot().Server(ip.String()))
+		return nil
+	}
+
+	before := waitServer(func(st *Status) bool { return st.Queries >= 30 })
+	fs.restart()
+	st := waitServer(func(st *Status) bool { return st.Restarts == 1 })
+	c.Check(st.TotalQueries > before.Queries, Equals, true)
+	c.Check(st.TotalQueries > st.Queries, Equals, true)
+
+	srv := httptest.NewServer(setupMux(hub))
+	defer srv.Close()
+
+	get := func(path string, v interface{}) {
+		res, err := http.Get(srv.URL + path)
+		c.Assert(err, IsNil)
+		defer res.Body.Close()
+		c.Assert(res.StatusCode, Equals, http.StatusOK)
+		c.Assert(json.NewDecoder(res.Body).Decode(v), IsNil)
+	}
+
+	all := struct{ Restarts []RestartEvent }{}
+	get("/api/restarts", &all)
+	c.Assert(all.Restarts, HasLen, 1)
+	c.Check(all.Restarts[0].Reason, Equals, "started")
+	c.Check(all.Restarts[0].IP, Equals, ip.String())
+
+	one := struct {
+		Restarts     int
+		TotalQueries int64 `json:"total_queries"`
+		Events       []RestartEvent
+	}{}
+	get("/api/servers/"+ip.String()+"/restarts", &one)
+	c.Check(one.Restarts, Equals, 1)
+	c.Check(one.TotalQueries > 0, Equals, true)
+	c.Check(one.Events, HasLen, 1)
+
+	res, err := http.Get(srv.URL + "/api/servers/192.0.2.99/restarts")
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Check(res.StatusCode, Equals, http.StatusNotFound)
+
+	res, err = http.Get(srv.URL + "/metrics")
+	c.Assert(err, IsNil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	c.Check(string(body), Matches, `(?s).*geodns_monitor_server_restarts_total\{[^}]*\} 1\n.*`)
+	c.Check(string(body), Matches, `(?s).*geodns_monitor_server_queries_cumulative_total\{.*`)
+
+	// the restarts are saved with the server and kept when the
+	// connection is replaced
+	saved := hub.SavedServers()
+	c.Assert(saved, HasLen, 1)
+	c.Check(saved[0].RestartLog, HasLen, 1)
+	c.Check(saved[0].LastRestart, NotNil)
+	ep.Interval = time.Hour
+	c.Assert(hub.AddNameEndpoint(ip.String(), ep), IsNil)
+	hub.sync()
+	c.Check(hub.Restarts().Events(ip.String()), HasLen, 1)
+
+	hub2 := NewHub()
+	defer hub2.Stop()
+	hub2.Restore(saved)
+	c.Check(hub2.Restarts().Events(ip.String()), HasLen, 1)
+	c.Check(hub2.Status()[0].LastRestart, NotNil)
+
+	// and forgotten when the server is gone
+	hub2.MarkConfigurationStart()
+	hub2.MarkConfigurationEnd()
+	c.Check(hub2.Status(), HasLen, 0)
+	c.Check(hub2.Restarts().Events(ip.String()), HasLen, 0)
+}
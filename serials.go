@@ -0,0 +1,246 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxSerialChanges is how many serial changes are remembered per zone.
+const maxSerialChanges = 20
+
+// ZoneServer is the serial a server has for a zone. Delay is how
+// long after the first server it started serving the serial.
+type ZoneServer struct {
+	IP      string    `json:"ip"`
+	Name    string    `json:"name"`
+	Serial  uint32    `json:"serial"`
+	Updated time.Time `json:"updated"`
+	Delay   float64   `json:"delay"`
+	Current bool      `json:"current"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// SerialChange is a new serial and how it reached the servers.
+// Delays are in seconds by server IP; Propagated is set when every
+// server has it.
+type SerialChange struct {
+	Serial      uint32             `json:"serial"`
+	FirstSeen   time.Time          `json:"first_seen"`
+	FirstServer string             `json:"first_server"`
+	Propagated  *time.Time         `json:"propagated,omitempty"`
+	Duration    float64            `json:"duration"`
+	Delays      map[string]float64 `json:"delays"`
+}
+
+// ZoneSerials is the serial tracking state of a zone.
+type ZoneSerials struct {
+	Zone       string          `json:"zone"`
+	Serial     uint32          `json:"serial"`
+	Propagated bool            `json:"propagated"`
+	Servers    []*ZoneServer   `json:"servers"`
+	Changes    []*SerialChange `json:"changes"`
+}
+
+// SerialTracker follows the SOA serials the consistency checks find
+// and measures how long new serials take to reach every server. The
+// times are only as precise as the consistency interval; serials
+// already served when the monitor started count as first seen then.
+type SerialTracker struct {
+	sync.RWMutex
+	zones map[string]*zoneSerials
+}
+
+type zoneSerials struct {
+	servers map[string]*ZoneServer
+	changes []*SerialChange
+}
+
+func NewSerialTracker() *SerialTracker {
+	return &SerialTracker{zones: make(map[string]*zoneSerials)}
+}
+
+// serialNewer compares serials with RFC 1982 arithmetic.
+func serialNewer(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+// Update records the SOA serials in a consistency report. It's meant
+// to be registered with ConsistencyChecker.OnReport.
+func (t *SerialTracker) Update(report *ConsistencyReport) {
+	t.Lock()
+	defer t.Unlock()
+
+	seen := make(map[string]bool)
+	for _, check := range report.Checks {
+		if check.Type != dns.TypeToString[dns.TypeSOA] || len(check.Subnet) > 0 {
+			continue
+		}
+		seen[check.Name] = true
+		zone := t.zones[check.Name]
+		if zone == nil {
+			zone = &zoneSerials{servers: make(map[string]*ZoneServer)}
+			t.zones[check.Name] = zone
+		}
+		zone.update(check, report.Time)
+	}
+	for name := range t.zones {
+		if !seen[name] {
+			delete(t.zones, name)
+		}
+	}
+}
+
+func (zone *zoneSerials) update(check *ConsistencyCheck, now time.Time) {
+	present := make(map[string]bool)
+	for _, v := range check.Variants {
+		for _, srv := range v.Servers {
+			present[srv.IP] = true
+			zs := zone.servers[srv.IP]
+			if zs == nil {
+				zs = &ZoneServer{IP: srv.IP}
+				zone.servers[srv.IP] = zs
+			}
+			zs.Name = srv.Name
+			zs.Error = v.Error
+			if len(v.Error) > 0 || v.Rcode != "NOERROR" {
+				if len(v.Error) == 0 {
+					zs.Error = v.Rcode
+				}
+				continue
+			}
+			known := !zs.Updated.IsZero()
+			if known && zs.Serial == v.Serial {
+				continue
+			}
+			if known && serialNewer(zs.Serial, v.Serial) {
+				log.Printf("Zone %s on %s went back from serial %d to %d", check.Name, srv.IP, zs.Serial, v.Serial)
+			}
+			zs.Serial = v.Serial
+			zs.Updated = now
+
+			change := zone.change(v.Serial)
+			if change == nil {
+				change = &SerialChange{
+					Serial:      v.Serial,
+					FirstSeen:   now,
+					FirstServer: srv.IP,
+					Delays:      make(map[string]float64),
+				}
+				zone.changes = append(zone.changes, change)
+				if len(zone.changes) > maxSerialChanges {
+					zone.changes = zone.changes[1:]
+				}
+			}
+			if _, ok := change.Delays[srv.IP]; !ok {
+				change.Delays[srv.IP] = now.Sub(change.FirstSeen).Seconds()
+			}
+		}
+	}
+	for ip := range zone.servers {
+		if !present[ip] {
+			delete(zone.servers, ip)
+		}
+	}
+
+	for _, change := range zone.changes {
+		if change.Propagated != nil {
+			continue
+		}
+		if zone.reached(change.Serial) {
+			t := now
+			change.Propagated = &t
+			change.Duration = now.Sub(change.FirstSeen).Seconds()
+		}
+	}
+}
+
+func (zone *zoneSerials) change(serial uint32) *SerialChange {
+	for _, change := range zone.changes {
+		if change.Serial == serial {
+			return change
+		}
+	}
+	return nil
+}
+
+// reached returns true if every server that answered has the serial
+// or a newer one.
+func (zone *zoneSerials) reached(serial uint32) bool {
+	for _, zs := range zone.servers {
+		if zs.Updated.IsZero() {
+			continue
+		}
+		if serialNewer(serial, zs.Serial) {
+			return false
+		}
+	}
+	return true
+}
+
+// Zones returns a copy of the state of every zone, sorted by name.
+func (t *SerialTracker) Zones() []*ZoneSerials {
+	t.RLock()
+	defer t.RUnlock()
+
+	zones := []*ZoneSerials{}
+	for name, zone := range t.zones {
+		zs := &ZoneSerials{
+			Zone:    name,
+			Servers: []*ZoneServer{},
+			Changes: []*SerialChange{},
+		}
+		found := false
+		for _, srv := range zone.servers {
+			if srv.Updated.IsZero() {
+				continue
+			}
+			if !found || serialNewer(srv.Serial, zs.Serial) {
+				zs.Serial = srv.Serial
+				found = true
+			}
+		}
+		zs.Propagated = zone.reached(zs.Serial)
+		for _, srv := range zone.servers {
+			s := *srv
+			s.Current = s.Serial == zs.Serial
+			if change := zone.change(s.Serial); change != nil {
+				s.Delay = change.Delays[s.IP]
+			}
+			zs.Servers = append(zs.Servers, &s)
+		}
+		sort.Sort(zoneServersByName(zs.Servers))
+		// newest first
+		for i := len(zone.changes) - 1; i >= 0; i-- {
+			change := *zone.changes[i]
+			change.Delays = make(map[string]float64)
+			for ip, d := range zone.changes[i].Delays {
+				change.Delays[ip] = d
+			}
+			zs.Changes = append(zs.Changes, &change)
+		}
+		zones = append(zones, zs)
+	}
+	sort.Sort(zonesByName(zones))
+	return zones
+}
+
+type zoneServersByName []*ZoneServer
+
+func (s zoneServersByName) Len() int      { return len(s) }
+func (s zoneServersByName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s zoneServersByName) Less(i, j int) bool {
+	if s[i].Name != s[j].Name {
+		return s[i].Name < s[j].Name
+	}
+	return s[i].IP < s[j].IP
+}
+
+type zonesByName []*ZoneSerials
+
+func (s zonesByName) Len() int           { return len(s) }
+func (s zonesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s zonesByName) Less(i, j int) bool { return s[i].Zone < s[j].Zone }
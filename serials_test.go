@@ -0,0 +1,94 @@
+package main
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SerialsSuite struct{}
+
+var _ = Suite(&SerialsSuite{})
+
+// soaReport makes a report with the serial each server has.
+func soaReport(t time.Time, serials map[string]uint32) *ConsistencyReport {
+	check := &ConsistencyCheck{Name: "example.com.", Type: "SOA"}
+	byserial := make(map[uint32]*AnswerVariant)
+	for ip, serial := range serials {
+		v := byserial[serial]
+		if v == nil {
+			v = &AnswerVariant{Rcode: "NOERROR", Serial: serial}
+			byserial[serial] = v
+			check.Variants = append(check.Variants, v)
+		}
+		v.Servers = append(v.Servers, &ConsistencyServer{IP: ip, Name: "ns-" + ip})
+	}
+	return &ConsistencyReport{Time: t, Checks: []*ConsistencyCheck{check}}
+}
+
+func (s *SerialsSuite) TestPropagation(c *C) {
+	tracker := NewSerialTracker()
+	start := time.Now()
+
+	tracker.Update(soaReport(start, map[string]uint32{"192.0.2.1": 10, "192.0.2.2": 10}))
+	zones := tracker.Zones()
+	c.Assert(zones, HasLen, 1)
+	c.Check(zones[0].Serial, Equals, uint32(10))
+	c.Check(zones[0].Propagated, Equals, true)
+
+	// the new serial shows up on one server, then the other
+	tracker.Update(soaReport(start.Add(30*time.Second), map[string]uint32{"192.0.2.1": 11, "192.0.2.2": 10}))
+	zones = tracker.Zones()
+	c.Check(zones[0].Serial, Equals, uint32(11))
+	c.Check(zones[0].Propagated, Equals, false)
+	c.Check(zones[0].Servers[0].Current, Equals, true)
+	c.Check(zones[0].Servers[1].Current, Equals, false)
+	c.Check(zones[0].Changes[0].Serial, Equals, uint32(11))
+	c.Check(zones[0].Changes[0].FirstServer, Equals, "192.0.2.1")
+	c.Check(zones[0].Changes[0].Propagated, IsNil)
+
+	tracker.Update(soaReport(start.Add(90*time.Second), map[string]uint32{"192.0.2.1": 11, "192.0.2.2": 11}))
+	zones = tracker.Zones()
+	c.Check(zones[0].Propagated, Equals, true)
+	c.Check(zones[0].Servers[0].Delay, Equals, 0.0)
+	c.Check(zones[0].Servers[1].Delay, Equals, 60.0)
+	c.Check(zones[0].Servers[1].Updated.Equal(start.Add(90*time.Second)), Equals, true)
+	change := zones[0].Changes[0]
+	c.Check(change.Propagated, NotNil)
+	c.Check(change.Duration, Equals, 60.0)
+	c.Check(change.Delays, DeepEquals, map[string]float64{"192.0.2.1": 0, "192.0.2.2": 60})
+
+	// serials wrap around
+	tracker.Update(soaReport(start.Add(120*time.Second), map[string]uint32{"192.0.2.1": 4294967295, "192.0.2.2": 11}))
+	tracker.Update(soaReport(start.Add(150*time.Second), map[string]uint32{"192.0.2.1": 1, "192.0.2.2": 4294967295}))
+	zones = tracker.Zones()
+	c.Check(zones[0].Serial, Equals, uint32(1))
+	c.Check(zones[0].Changes[1].Propagated, NotNil)
+	c.Check(zones[0].Changes[0].Propagated, IsNil)
+
+	// a removed server doesn't hold up the propagation
+	tracker.Update(soaReport(start.Add(180*time.Second), map[string]uint32{"192.0.2.1": 1}))
+	zones = tracker.Zones()
+	c.Check(zones[0].Servers, HasLen, 1)
+	c.Check(zones[0].Propagated, Equals, true)
+
+	// nor does a zone that isn't checked anymore stay around
+	tracker.Update(&ConsistencyReport{Time: start.Add(210 * time.Second)})
+	c.Check(tracker.Zones(), HasLen, 0)
+}
+
+func (s *SerialsSuite) TestErrors(c *C) {
+	tracker := NewSerialTracker()
+	report := soaReport(time.Now(), map[string]uint32{"192.0.2.1": 10})
+	report.Checks[0].Variants = append(report.Checks[0].Variants, &AnswerVariant{
+		Error:   "i/o timeout",
+		Servers: []*ConsistencyServer{{IP: "192.0.2.2", Name: "ns2"}},
+	})
+	tracker.Update(report)
+
+	zones := tracker.Zones()
+	c.Assert(zones[0].Servers, HasLen, 2)
+	c.Check(zones[0].Servers[1].Error, Equals, "i/o timeout")
+	c.Check(zones[0].Servers[1].Updated.IsZero(), Equals, true)
+	c.Check(zones[0].Propagated, Equals, true)
+}
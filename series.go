@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sample is a single reading of the counters a geodns server reports.
+// Queries is the total across restarts, so it never goes down.
+type Sample struct {
+	Time    time.Time
+	UUID    string
+	IP      string
+	Queries int64
+	Qps     float64
+	Qps1    float64
+	Uptime  int64
+}
+
+// SeriesSink is implemented by anything that wants to receive every
+// sample the StatusHub applies.
+type SeriesSink interface {
+	Record(*Sample)
+	Close() error
+}
+
+// seriesPoint is one (possibly downsampled) bucket of samples.
+type seriesPoint struct {
+	Start   int64
+	Count   int
+	QpsMin  float64
+	QpsMax  float64
+	QpsSum  float64
+	Qps1    float64
+	Queries int64
+	Uptime  int64
+}
+
+func (p *seriesPoint) add(sample *Sample) {
+	if p.Count == 0 || sample.Qps < p.QpsMin {
+		p.QpsMin = sample.Qps
+	}
+	if p.Count == 0 || sample.Qps > p.QpsMax {
+		p.QpsMax = sample.Qps
+	}
+	p.QpsSum += sample.Qps
+	p.Count++
+	p.Qps1 = sample.Qps1
+	p.Queries = sample.Queries
+	p.Uptime = sample.Uptime
+}
+
+// seriesTier keeps points at a fixed step for a fixed retention.
+type seriesTier struct {
+	Step      int64
+	Retention int64
+	Points    []seriesPoint
+}
+
+func (t *seriesTier) add(sample *Sample) {
+	ts := sample.Time.Unix()
+	start := ts - ts%t.Step
+
+	n := len(t.Points)
+	if n == 0 || t.Points[n-1].Start < start {
+		t.Points = append(t.Points, seriesPoint{Start: start})
+		n++
+	}
+	t.Points[n-1].add(sample)
+
+	t.expire(ts)
+}
+
+func (t *seriesTier) expire(now int64) {
+	oldest := now - t.Retention
+	i := 0
+	for i < len(t.Points) && t.Points[i].Start < oldest {
+		i++
+	}
+	if i > 0 {
+		t.Points = append(t.Points[:0], t.Points[i:]...)
+	}
+}
+
+type series struct {
+	IP    string
+	UUID  string
+	Tiers []*seriesTier
+}
+
+// SeriesStore is an embedded time series store. Samples are kept
+// in memory in a number of tiers with decreasing resolution and
+// periodically written to disk.
+type SeriesStore struct {
+	sync.RWMutex
+	path   string
+	tiers  []seriesTier
+	series map[string]*series
+
+	// flushMu keeps flushes from writing the file at the same time
+	flushMu  sync.Mutex
+	dirty    bool
+	running  bool
+	quit     chan bool
+	done     chan bool
+	quitOnce sync.Once
+}
+
+var defaultSeriesTiers = []string{"10s:24h", "5m:720h", "1h:17520h"}
+
+func parseSeriesTiers(specs []string) ([]seriesTier, error) {
+	if len(specs) == 0 {
+		specs = defaultSeriesTiers
+	}
+	tiers := []seriesTier{}
+	for _, spec := range specs {
+		x := strings.SplitN(spec, ":", 2)
+		if len(x) != 2 {
+			return nil, fmt.Errorf("invalid history tier '%s', expected step:retention", spec)
+		}
+		step, err := time.ParseDuration(strings.TrimSpace(x[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid history tier '%s': %s", spec, err)
+		}
+		retention, err := time.ParseDuration(strings.TrimSpace(x[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid history tier '%s': %s", spec, err)
+		}
+		if step < time.Second || retention < step {
+			return nil, fmt.Errorf("invalid history tier '%s'", spec)
+		}
+		if len(tiers) > 0 && int64(step.Seconds()) <= tiers[len(tiers)-1].Step {
+			return nil, fmt.Errorf("history tiers must be listed from finest to coarsest")
+		}
+		tiers = append(tiers, seriesTier{
+			Step:      int64(step.Seconds()),
+			Retention: int64(retention.Seconds()),
+		})
+	}
+	return tiers, nil
+}
+
+// NewSeriesStore opens (or creates) the store at path. The tier
+// specifications are "step:retention" durations, finest first.
+func NewSeriesStore(path string, tierSpecs []string) (*SeriesStore, error) {
+	tiers, err := parseSeriesTiers(tierSpecs)
+	if err != nil {
+		return nil, err
+	}
+	st := &SeriesStore{
+		path:   path,
+		tiers:  tiers,
+		series: make(map[string]*series),
+		quit:   make(chan bool),
+		done:   make(chan bool),
+	}
+	err = st.load()
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Run flushes the store to disk every interval until Close is called.
+func (st *SeriesStore) Run(interval time.Duration) {
+	st.Lock()
+	st.running = true
+	st.Unlock()
+	defer close(st.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := st.Flush()
+			if err != nil {
+				log.Printf("Could not save history: %s", err)
+			}
+		case <-st.quit:
+			return
+		}
+	}
+}
+
+// Record adds the sample to every tier of the server's series.
+func (st *SeriesStore) Record(sample *Sample) {
+	st.Lock()
+	defer st.Unlock()
+
+	srs, ok := st.series[sample.IP]
+	if !ok {
+		srs = &series{IP: sample.IP}
+		for _, tier := range st.tiers {
+			t := tier
+			srs.Tiers = append(srs.Tiers, &t)
+		}
+		st.series[sample.IP] = srs
+	}
+	if len(sample.UUID) > 0 {
+		srs.UUID = sample.UUID
+	}
+	for _, tier := range srs.Tiers {
+		tier.add(sample)
+	}
+	st.dirty = true
+}
+
+// Close stops the background flushing and writes the store to disk.
+func (st *SeriesStore) Close() error {
+	st.RLock()
+	running := st.running
+	st.RUnlock()
+	st.quitOnce.Do(func() { close(st.quit) })
+	if running {
+		<-st.done
+	}
+	return st.Flush()
+}
+
+// Flush writes the store to disk if anything changed since the last
+// flush. The file is replaced atomically. The series are encoded
+// under the lock, but written without it so samples aren't held up
+// by the disk.
+func (st *SeriesStore) Flush() error {
+	st.flushMu.Lock()
+	defer st.flushMu.Unlock()
+
+	st.Lock()
+	if !st.dirty {
+		st.Unlock()
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	err := gob.NewEncoder(buf).Encode(st.series)
+	if err == nil {
+		st.dirty = false
+	}
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = st.write(buf.Bytes())
+	if err != nil {
+		st.Lock()
+		st.dirty = true
+		st.Unlock()
+	}
+	return err
+}
+
+func (st *SeriesStore) write(data []byte) error {
+	tmp := st.path + ".tmp"
+	fh, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(data)
+	if err == nil {
+		err = fh.Sync()
+	}
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+func (st *SeriesStore) load() error {
+	err := os.MkdirAll(filepath.Dir(st.path), 0755)
+	if err != nil {
+		return err
+	}
+	fh, err := os.Open(st.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer fh.Close()
+
+	saved := make(map[string]*series)
+	err = gob.NewDecoder(fh).Decode(&saved)
+	if err != nil {
+		return fmt.Errorf("could not read history from %s: %s", st.path, err)
+	}
+
+	// The tier configuration might have changed since the file was
+	// written; keep the points from tiers with a matching step.
+	now := time.Now().Unix()
+	for ip, old := range saved {
+		srs := &series{IP: old.IP, UUID: old.UUID}
+		for _, tier := range st.tiers {
+			t := tier
+			for _, ot := range old.Tiers {
+				if ot.Step == t.Step {
+					t.Points = ot.Points
+					t.expire(now)
+				}
+			}
+			srs.Tiers = append(srs.Tiers, &t)
+		}
+		st.series[ip] = srs
+	}
+	return nil
+}
+
+// HistoryPoint is an aggregated point returned by the history API.
+type HistoryPoint struct {
+	Time    int64   `json:"t"`
+	Samples int     `json:"samples"`
+	QpsMin  float64 `json:"qps_min"`
+	QpsMax  float64 `json:"qps_max"`
+	QpsAvg  float64 `json:"qps_avg"`
+	QpsP95  float64 `json:"qps_p95"`
+	Qps1    float64 `json:"qps1m"`
+	Queries int64   `json:"queries"`
+}
+
+// Known returns true if the store has a series for the IP.
+func (st *SeriesStore) Known(ip string) bool {
+	st.RLock()
+	defer st.RUnlock()
+	_, ok := st.series[ip]
+	return ok
+}
+
+// chooseTier returns the index of the finest tier that still has
+// data going back to from.
+func (st *SeriesStore) chooseTier(from time.Time) int {
+	age := int64(time.Since(from).Seconds())
+	for i, tier := range st.tiers {
+		if tier.Retention >= age {
+			return i
+		}
+	}
+	return len(st.tiers) - 1
+}
+
+// Query returns the points between from and to for the servers with
+// the given IPs, aggregated to step. When more than one IP is given
+// the qps values are summed across servers. The returned step is
+// the one actually used; it is never finer than the stored data.
+func (st *SeriesStore) Query(ips []string, from, to time.Time, step time.Duration) ([]HistoryPoint, time.Duration) {
+	st.RLock()
+	defer st.RUnlock()
+
+	tierIdx, stepSecs := st.step(from, step)
+
+	fromTs, toTs := from.Unix(), to.Unix()
+
+	// merge the servers' points by bucket start
+	merged := make(map[int64]*seriesPoint)
+	for _, ip := range ips {
+		srs, ok := st.series[ip]
+		if !ok {
+			continue
+		}
+		for _, p := range srs.Tiers[tierIdx].Points {
+			if p.Start < fromTs || p.Start > toTs || p.Count == 0 {
+				continue
+			}
+			avg := p.QpsSum / float64(p.Count)
+			m, ok := merged[p.Start]
+			if !ok {
+				m = &seriesPoint{Start: p.Start, Count: 1}
+				merged[p.Start] = m
+			}
+			m.QpsMin += p.QpsMin
+			m.QpsMax += p.QpsMax
+			m.QpsSum += avg
+			m.Qps1 += p.Qps1
+			m.Queries += p.Queries
+		}
+	}
+
+	buckets := make(map[int64][]*seriesPoint)
+	for start, p := range merged {
+		b := start - start%stepSecs
+		buckets[b] = append(buckets[b], p)
+	}
+
+	starts := make([]int64, 0, len(buckets))
+	for b := range buckets {
+		starts = append(starts, b)
+	}
+	sort.Sort(int64s(starts))
+
+	rv := []HistoryPoint{}
+	for _, b := range starts {
+		points := buckets[b]
+		sort.Sort(seriesPointsByStart(points))
+		hp := HistoryPoint{Time: b}
+		avgs := make([]float64, 0, len(points))
+		for i, p := range points {
+			if i == 0 || p.QpsMin < hp.QpsMin {
+				hp.QpsMin = p.QpsMin
+			}
+			if p.QpsMax > hp.QpsMax {
+				hp.QpsMax = p.QpsMax
+			}
+			hp.QpsAvg += p.QpsSum
+			avgs = append(avgs, p.QpsSum)
+		}
+		last := points[len(points)-1]
+		hp.Samples = len(points)
+		hp.QpsAvg /= float64(len(points))
+		hp.QpsP95 = percentile(avgs, 0.95)
+		hp.Qps1 = last.Qps1
+		hp.Queries = last.Queries
+		rv = append(rv, hp)
+	}
+
+	return rv, time.Duration(stepSecs) * time.Second
+}
+
+// step returns the tier with data going back to from and the step in
+// seconds: the requested one rounded up to a multiple of the tier's.
+func (st *SeriesStore) step(from time.Time, step time.Duration) (int, int64) {
+	tierIdx := st.chooseTier(from)
+	tierStep := st.tiers[tierIdx].Step
+
+	stepSecs := int64(step.Seconds())
+	if stepSecs < tierStep {
+		stepSecs = tierStep
+	}
+	if rem := stepSecs % tierStep; rem > 0 {
+		stepSecs += tierStep - rem
+	}
+	return tierIdx, stepSecs
+}
+
+// Step returns the step Query would use for the time and step.
+func (st *SeriesStore) Step(from time.Time, step time.Duration) time.Duration {
+	st.RLock()
+	defer st.RUnlock()
+	_, stepSecs := st.step(from, step)
+	return time.Duration(stepSecs) * time.Second
+}
+
+type int64s []int64
+
+func (s int64s) Len() int           { return len(s) }
+func (s int64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type seriesPointsByStart []*seriesPoint
+
+func (s seriesPointsByStart) Len() int           { return len(s) }
+func (s seriesPointsByStart) Less(i, j int) bool { return s[i].Start < s[j].Start }
+func (s seriesPointsByStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// percentile returns the p (0-1) percentile of values using the
+// nearest rank method. The slice is sorted in place.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(p*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank]
+}
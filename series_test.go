@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SeriesSuite struct {
+	dir string
+}
+
+var _ = Suite(&SeriesSuite{})
+
+func (s *SeriesSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "dnsmonitor-series")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *SeriesSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *SeriesSuite) TestTiers(c *C) {
+	_, err := parseSeriesTiers([]string{"10s"})
+	c.Check(err, ErrorMatches, ".*expected step:retention")
+
+	_, err = parseSeriesTiers([]string{"1m:1h", "10s:24h"})
+	c.Check(err, ErrorMatches, ".*finest to coarsest")
+
+	tiers, err := parseSeriesTiers(nil)
+	c.Assert(err, IsNil)
+	c.Check(tiers, HasLen, 3)
+	c.Check(tiers[0].Step, Equals, int64(10))
+	c.Check(tiers[0].Retention, Equals, int64(86400))
+}
+
+func (s *SeriesSuite) TestRecord(c *C) {
+	path := filepath.Join(s.dir, "history.db")
+	st, err := NewSeriesStore(path, []string{"10s:1m", "1m:1h"})
+	c.Assert(err, IsNil)
+
+	start := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	for i := 0; i < 120; i++ {
+		st.Record(&Sample{
+			Time:    start.Add(time.Duration(i) * time.Second),
+			IP:      "192.0.2.1",
+			UUID:    "abc",
+			Queries: int64(i * 10),
+			Qps:     float64(i),
+			Uptime:  int64(i),
+		})
+	}
+
+	srs := st.series["192.0.2.1"]
+	c.Assert(srs, NotNil)
+	c.Check(srs.UUID, Equals, "abc")
+
+	// 10 second buckets are only kept for a minute
+	fine := srs.Tiers[0].Points
+	c.Check(fine, HasLen, 6)
+	last := fine[len(fine)-1]
+	c.Check(last.Count, Equals, 10)
+	c.Check(last.QpsMin, Equals, float64(110))
+	c.Check(last.QpsMax, Equals, float64(119))
+	c.Check(last.Queries, Equals, int64(1190))
+
+	coarse := srs.Tiers[1].Points
+	c.Check(coarse, HasLen, 2)
+	c.Check(coarse[1].Count, Equals, 60)
+
+	c.Assert(st.Close(), IsNil)
+
+	st, err = NewSeriesStore(path, []string{"1m:8760h"})
+	c.Assert(err, IsNil)
+	srs = st.series["192.0.2.1"]
+	c.Assert(srs, NotNil)
+	c.Check(srs.Tiers, HasLen, 1)
+	c.Check(srs.Tiers[0].Points, HasLen, 2)
+}
+
+func (s *SeriesSuite) TestQuery(c *C) {
+	st, err := NewSeriesStore(filepath.Join(s.dir, "history.db"), []string{"10s:24h", "5m:720h"})
+	c.Assert(err, IsNil)
+
+	start := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	for i := 0; i < 600; i++ {
+		ts := start.Add(time.Duration(i) * time.Second)
+		st.Record(&Sample{Time: ts, IP: "192.0.2.1", Qps: 10, Queries: int64(i)})
+		st.Record(&Sample{Time: ts, IP: "192.0.2.2", Qps: float64(i % 60)})
+	}
+
+	points, step := st.Query([]string{"192.0.2.1"}, start, start.Add(10*time.Minute), time.Second)
+	c.Check(step, Equals, 10*time.Second)
+	c.Check(points, HasLen, 60)
+
+	points, step = st.Query([]string{"192.0.2.2"}, start, start.Add(10*time.Minute), time.Minute)
+	c.Check(step, Equals, time.Minute)
+	c.Assert(points, HasLen, 10)
+	c.Check(points[0].Samples, Equals, 6)
+	c.Check(points[0].QpsMin, Equals, float64(0))
+	c.Check(points[0].QpsMax, Equals, float64(59))
+	c.Check(points[0].QpsAvg, Equals, 29.5)
+	c.Check(points[0].QpsP95, Equals, 54.5)
+
+	points, _ = st.Query([]string{"192.0.2.1", "192.0.2.2"}, start, start.Add(10*time.Minute), 10*time.Minute)
+	c.Assert(points, HasLen, 1)
+	c.Check(points[0].QpsAvg, Equals, 39.5)
+	c.Check(points[0].Queries, Equals, int64(599))
+}
+
+func (s *SeriesSuite) TestHistoryTime(c *C) {
+	now := time.Unix(1500000000, 0)
+
+	t, err := parseHistoryTime("", now, now)
+	c.Check(err, IsNil)
+	c.Check(t, Equals, now)
+
+	t, err = parseHistoryTime("-1h", now, now)
+	c.Check(err, IsNil)
+	c.Check(t.Unix(), Equals, int64(1500000000-3600))
+
+	t, err = parseHistoryTime("1400000000", now, now)
+	c.Check(err, IsNil)
+	c.Check(t.Unix(), Equals, int64(1400000000))
+
+	_, err = parseHistoryTime("yesterday", now, now)
+	c.Check(err, ErrorMatches, "could not parse time.*")
+}
+
+func (s *SeriesSuite) TestHistoryLimits(c *C) {
+	st, err := NewSeriesStore(filepath.Join(s.dir, "history.db"), nil)
+	c.Assert(err, IsNil)
+	now := time.Now()
+	st.Record(&Sample{Time: now.Add(-time.Minute), IP: "192.0.2.1", Qps: 10})
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetHistory(st)
+	srv := httptest.NewServer(setupMux(hub))
+	defer srv.Close()
+
+	get := func(query string) (int, map[string]interface{}) {
+		res, err := http.Get(srv.URL + "/api/history/192.0.2.1?" + query)
+		c.Assert(err, IsNil)
+		defer res.Body.Close()
+		rv := map[string]interface{}{}
+		json.NewDecoder(res.Body).Decode(&rv)
+		return res.StatusCode, rv
+	}
+
+	// the end is in the far future
+	code, rv := get("to=9999999999&from=-1h")
+	c.Check(code, Equals, http.StatusOK)
+	c.Check(rv["to"].(float64) <= float64(time.Now().Unix()), Equals, true)
+	c.Check(rv["points"], HasLen, 1)
+
+	code, rv = get("from=-12h")
+	c.Check(code, Equals, http.StatusOK)
+	c.Check(rv["step"], Equals, float64(150))
+
+	code, rv = get("from=-12h&step=10")
+	c.Check(code, Equals, http.StatusBadRequest)
+	c.Check(rv["Error"], Matches, "Too many points.*")
+}
@@ -1,32 +1,77 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net"
-	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
+// Endpoint is where the status of a geodns server is: the monitor
+// websocket, or with Protocol "http" the /status JSON.
+type Endpoint struct {
+	Port     int
+	Path     string
+	Protocol string
+	// Interval is how often HTTP endpoints are polled.
+	Interval time.Duration
+}
+
+// defaultEndpoint is used when the configuration doesn't say
+// otherwise.
+var defaultEndpoint = Endpoint{Port: 8053, Path: "/monitor"}
+
+// Address returns the host:port to dial for the server at ip.
+func (ep Endpoint) Address(ip net.IP) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(ep.Port))
+}
+
+// URL returns the websocket or HTTP URL for the server at ip.
+func (ep Endpoint) URL(ip net.IP) (*url.URL, error) {
+	u, err := url.Parse(ep.Path)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "ws"
+	if ep.Protocol == "http" {
+		u.Scheme = "http"
+	}
+	u.Host = ep.Address(ip)
+	return u, nil
+}
+
+// ServerStatusMsg tells the hub about the state of a connection. An
+// empty Status keeps the last one.
 type ServerStatusMsg struct {
-	ConnID int
-	Status string
+	ConnID    int
+	Status    string
+	State     ConnState
+	NextRetry time.Time
 }
 
 type ServerConnection struct {
 	ConnID        int
 	IP            net.IP
+	Endpoint      Endpoint
 	updateChan    chan *ServerUpdate
 	statusMsgChan chan *ServerStatusMsg
-
-	quit           chan bool
-	sleep          chan int
-	configRevision int
+	probeChan     chan *ProbeReport
+	probes        *probeConfig
+	connection    *connectionConfig
+	collector     Collector
+	sessions      *sessionTracker
+
+	// state and session are only used by the connection goroutine;
+	// session is set once the collector got an update.
+	state   ConnState
+	session bool
+
+	quit     chan bool
+	quitOnce sync.Once
+	done     chan bool
 }
 
 type ServerUpdate struct {
@@ -44,19 +89,22 @@ type ServerUpdate struct {
 	UUID     string   `json:"uuid"`
 }
 
-func NewServerConnection(ip net.IP, updates chan *ServerUpdate, sm chan *ServerStatusMsg) *ServerConnection {
+func NewServerConnection(ip net.IP, ep Endpoint, updates chan *ServerUpdate, sm chan *ServerStatusMsg) *ServerConnection {
 	sc := new(ServerConnection)
 	sc.IP = ip
+	sc.Endpoint = ep
+	sc.collector = newCollector(ep)
+	sc.sessions = newSessionTracker()
 	sc.updateChan = updates
 	sc.statusMsgChan = sm
-	sc.quit = make(chan bool, 1)
-	sc.sleep = make(chan int, 1)
+	sc.quit = make(chan bool)
+	sc.done = make(chan bool)
 	return sc
 }
 
 func (sc *ServerConnection) Start(id int) {
 	sc.ConnID = id
-	sc.statusMsg("Starting")
+	sc.stateMsg(StateConnecting, "Starting")
 
 	su := new(ServerUpdate)
 	su.ConnID = id
@@ -65,129 +113,99 @@ func (sc *ServerConnection) Start(id int) {
 	sc.updateChan <- su
 
 	go sc.start()
+	go sc.probe()
 }
 
+// Stop closes the connection to the server. It doesn't wait for it
+// to finish; Done is closed when it has.
 func (sc *ServerConnection) Stop() {
-	sc.quit <- true
+	sc.quitOnce.Do(func() { close(sc.quit) })
+}
+
+// Done returns a channel that's closed when the connection has
+// stopped.
+func (sc *ServerConnection) Done() <-chan bool {
+	return sc.done
 }
 
-func (sc *ServerConnection) statusErrorMsg(str string) {
-	sc.statusMsg(str)
+func (sc *ServerConnection) stopped() bool {
+	select {
+	case <-sc.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// statusErrorMsg reports the state and clears the server data the
+// hub has, as the connection isn't streaming anymore.
+func (sc *ServerConnection) statusErrorMsg(state ConnState, str string, nextRetry time.Time) {
+	sc.state = state
+	sc.statusMsgChan <- &ServerStatusMsg{
+		ConnID:    sc.ConnID,
+		Status:    str,
+		State:     state,
+		NextRetry: nextRetry,
+	}
 	su := new(ServerUpdate)
 	su.ConnID = sc.ConnID
 	su.IP = sc.IP.String()
 	sc.updateChan <- su
 }
 
-func (sc *ServerConnection) statusMsg(str string) {
-	msg := &ServerStatusMsg{sc.ConnID, str}
-	sc.statusMsgChan <- msg
+func (sc *ServerConnection) stateMsg(state ConnState, str string) {
+	sc.state = state
+	sc.statusMsgChan <- &ServerStatusMsg{ConnID: sc.ConnID, Status: str, State: state}
 }
 
+// streaming is called by the collectors for each update they get.
+func (sc *ServerConnection) streaming() {
+	sc.session = true
+	if sc.state != StateStreaming {
+		sc.stateMsg(StateStreaming, "Ok")
+	}
+}
+
+// start runs the collector until the connection is stopped, waiting
+// longer after each failure. The backoff starts over after a
+// connection that got updates.
 func (sc *ServerConnection) start() {
-	log.Println("Fetch for", sc.IP)
+	defer close(sc.done)
 
-	retries := 0
+	log.Printf("Fetch for %s over %s", sc.Endpoint.Address(sc.IP), sc.collector)
 
-	for {
+	bo := newBackoff()
 
-		select {
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			reconnectAttempts.Inc()
+		}
 
-		case <-sc.quit:
+		sc.session = false
+		sc.stateMsg(StateConnecting, "")
+		err := sc.collector.Collect(sc)
+		if sc.stopped() {
 			log.Println("sc got quit!")
-			sc.statusErrorMsg("stopped")
+			sc.sessions.disconnect("stopped")
+			sc.statusErrorMsg(StateStopped, "stopped", time.Time{})
 			return
-
-		case retries := <-sc.sleep:
-			delay := retries * retries / 2
-			if delay > 60 {
-				delay = 30
-			}
-			time.Sleep(time.Duration(delay) * time.Second)
-
-		default:
-
-			retries++
-
-			conn, err := net.Dial("tcp", net.JoinHostPort(sc.IP.String(), "8053"))
-			if err != nil {
-				status := fmt.Sprintf("%s", err)
-				sc.statusErrorMsg(status)
-				log.Println(status)
-				sc.sleep <- retries
-				continue
-			}
-			url, err := url.Parse("/monitor")
-			if err != nil {
-				log.Println("Could not parse url", err)
-			}
-			header := http.Header{}
-			header.Add("Origin", "http://monitor.pgeodns")
-			header.Add("Host", sc.IP.String())
-			header.Add("Set-WebSocket-Protocol", "chat")
-
-			ws, _, err := websocket.NewClient(conn, url, header, 1024, 1024)
-			if err != nil {
-				status := fmt.Sprintf("Could not upgrade WS on '%s': %s", sc.IP, err)
-				sc.statusErrorMsg(status)
-				log.Println(status)
-				sc.sleep <- retries
-				continue
-			}
-			sc.read(ws)
-			log.Println("server reader stopped")
-			err = conn.Close()
-			if err != nil {
-				log.Printf("Error closing connection to %s: %s", sc.IP, err)
-			}
-			sc.sleep <- retries
-			continue
 		}
-	}
-}
-
-func (sc *ServerConnection) read(ws *websocket.Conn) {
-
-	// log.Println("Response", resp)
-
-	status := new(ServerUpdate)
-	status.ConnID = sc.ConnID
+		if err == nil {
+			err = fmt.Errorf("Connection to server closed")
+		}
+		sc.sessions.disconnect(err.Error())
+		if sc.session {
+			bo.reset()
+		}
 
-	for {
+		delay := bo.next(sc.connection.Settings())
+		status := err.Error()
+		sc.statusErrorMsg(StateBackoff, status, time.Now().Add(delay))
+		log.Printf("%s, retrying in %s", status, delay.Round(time.Millisecond))
 
 		select {
+		case <-time.After(delay):
 		case <-sc.quit:
-			log.Println("server reader got quit message")
-			sc.quit <- true
-			return
-
-		default:
-
-			ws.SetReadDeadline(time.Now().Add(time.Second * 3))
-			sc.statusMsg("Ok")
-			op, r, err := ws.NextReader()
-			if err != nil {
-				status := fmt.Sprintf("Error reading from server: %s", err)
-				sc.statusErrorMsg(status)
-				log.Println(status)
-				return
-			}
-			msg, err := ioutil.ReadAll(r)
-
-			// log.Println("op", op, "msg", string(msg), "err", err)
-
-			if op == websocket.TextMessage {
-				err = json.Unmarshal(msg, &status)
-				if err != nil {
-					log.Printf("Unmarshall err from '%s': '%s', data: '%s'\n", sc.IP.String(), err, msg)
-				}
-				// log.Printf("Got status: %#v\n", status)
-				sc.updateChan <- status
-			} else {
-				log.Println("op", op, "msg", string(msg), "err", err)
-			}
-
-			// os.Exit(0)
 		}
 	}
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "gopkg.in/check.v1"
+)
+
+type ServerSuite struct{}
+
+var _ = Suite(&ServerSuite{})
+
+// fakeMonitor is a geodns /monitor websocket that sends the update
+// every 100ms and reports how the client closed the connection.
+type fakeMonitor struct {
+	srv    *httptest.Server
+	update map[string]interface{}
+	closed chan int
+	quit   chan bool
+}
+
+func newFakeMonitor(update map[string]interface{}) *fakeMonitor {
+	fm := &fakeMonitor{update: update, closed: make(chan int, 10), quit: make(chan bool)}
+	fm.srv = httptest.NewServer(http.HandlerFunc(fm.serve))
+	return fm
+}
+
+// newFakeMonitorAt starts a fake monitor listening on addr, for
+// example "[::1]:0".
+func newFakeMonitorAt(addr string, update map[string]interface{}) (*fakeMonitor, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	fm := &fakeMonitor{update: update, closed: make(chan int, 10), quit: make(chan bool)}
+	fm.srv = httptest.NewUnstartedServer(http.HandlerFunc(fm.serve))
+	fm.srv.Listener.Close()
+	fm.srv.Listener = l
+	fm.srv.Start()
+	return fm, nil
+}
+
+func (fm *fakeMonitor) serve(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	go func() {
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				if ce, ok := err.(*websocket.CloseError); ok {
+					fm.closed <- ce.Code
+				} else {
+					fm.closed <- 0
+				}
+				return
+			}
+		}
+	}()
+
+	for {
+		ws.SetWriteDeadline(time.Now().Add(time.Second))
+		if err := ws.WriteJSON(fm.update); err != nil {
+			return
+		}
+		select {
+		case <-fm.quit:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Endpoint returns the IP and endpoint to connect to the fake monitor.
+func (fm *fakeMonitor) Endpoint() (net.IP, Endpoint) {
+	host, port, _ := net.SplitHostPort(fm.srv.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return net.ParseIP(host), Endpoint{Port: p, Path: "/monitor"}
+}
+
+// Close stops the server, dropping the websockets.
+func (fm *fakeMonitor) Close() {
+	close(fm.quit)
+	fm.srv.Close()
+}
+
+func (s *ServerSuite) TestStop(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-1", "qps": 10})
+	defer fm.Close()
+
+	updates := make(chan *ServerUpdate, 100)
+	msgs := make(chan *ServerStatusMsg, 100)
+	ip, ep := fm.Endpoint()
+	sc := NewServerConnection(ip, ep, updates, msgs)
+	sc.Start(1)
+
+	timeout := time.After(5 * time.Second)
+	for got := false; !got; {
+		select {
+		case up := <-updates:
+			got = up.UUID == "uuid-1"
+		case <-timeout:
+			c.Fatal("no update from the fake monitor")
+		}
+	}
+
+	sc.Stop()
+	select {
+	case <-sc.Done():
+	case <-time.After(2 * time.Second):
+		c.Fatal("connection didn't stop")
+	}
+
+	select {
+	case code := <-fm.closed:
+		c.Check(code, Equals, websocket.CloseNormalClosure)
+	case <-time.After(2 * time.Second):
+		c.Fatal("websocket wasn't closed")
+	}
+
+	// stopping again is fine
+	sc.Stop()
+}
+
+func (s *ServerSuite) TestHubStop(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-2", "qps": 10})
+	defer fm.Close()
+
+	hub := NewHub()
+	ip, ep := fm.Endpoint()
+	c.Assert(hub.AddNameEndpoint(ip.String(), ep), IsNil)
+
+	for i := 0; i < 50; i++ {
+		if st := hub.Status(); len(st) == 1 && st[0].UUID == "uuid-2" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	hub.Stop()
+	select {
+	case code := <-fm.closed:
+		c.Check(code, Equals, websocket.CloseNormalClosure)
+	case <-time.After(2 * time.Second):
+		c.Fatal("websocket wasn't closed")
+	}
+	c.Check(hub.Status(), HasLen, 0)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionStats say how well the connection to a server has been
+// working since the monitor started it. A session is from the
+// websocket upgrade, or the first HTTP poll that worked, until the
+// connection fails.
+type SessionStats struct {
+	Sessions  int  `json:"sessions"`
+	Connected bool `json:"connected"`
+	// ConnectedTime is the total time of the sessions in seconds,
+	// including the current one.
+	ConnectedTime    float64   `json:"connected_time"`
+	LastConnect      time.Time `json:"last_connect"`
+	LastDisconnect   time.Time `json:"last_disconnect"`
+	DisconnectReason string    `json:"disconnect_reason"`
+	Messages         int64     `json:"messages"`
+	Bytes            int64     `json:"bytes"`
+	DecodeErrors     int64     `json:"decode_errors"`
+	// AverageInterval is the average time between messages in a
+	// session, in seconds.
+	AverageInterval float64 `json:"average_interval"`
+}
+
+// sessionTracker counts the sessions and messages of a connection.
+// The connection updates it and the hub reads it.
+type sessionTracker struct {
+	sync.Mutex
+	stats       SessionStats
+	connected   time.Duration
+	since       time.Time
+	lastMessage time.Time
+	intervals   time.Duration
+	nIntervals  int64
+	now         func() time.Time
+}
+
+func newSessionTracker() *sessionTracker {
+	return &sessionTracker{now: time.Now}
+}
+
+// connect starts a session.
+func (t *sessionTracker) connect() {
+	t.Lock()
+	defer t.Unlock()
+	now := t.now()
+	t.stats.Sessions++
+	t.stats.Connected = true
+	t.stats.LastConnect = now
+	t.since = now
+	t.lastMessage = time.Time{}
+}
+
+// disconnect ends the session, if there is one.
+func (t *sessionTracker) disconnect(reason string) {
+	t.Lock()
+	defer t.Unlock()
+	if !t.stats.Connected {
+		return
+	}
+	now := t.now()
+	t.connected += now.Sub(t.since)
+	t.stats.Connected = false
+	t.stats.LastDisconnect = now
+	t.stats.DisconnectReason = reason
+}
+
+// message counts a message of size bytes; decodeErr is set if it
+// couldn't be decoded.
+func (t *sessionTracker) message(size int, decodeErr bool) {
+	t.Lock()
+	defer t.Unlock()
+	now := t.now()
+	t.stats.Messages++
+	t.stats.Bytes += int64(size)
+	if decodeErr {
+		t.stats.DecodeErrors++
+	}
+	if !t.lastMessage.IsZero() {
+		t.intervals += now.Sub(t.lastMessage)
+		t.nIntervals++
+	}
+	t.lastMessage = now
+}
+
+// Stats returns the statistics as of now.
+func (t *sessionTracker) Stats() SessionStats {
+	t.Lock()
+	defer t.Unlock()
+	stats := t.stats
+	connected := t.connected
+	if stats.Connected {
+		connected += t.now().Sub(t.since)
+	}
+	stats.ConnectedTime = connected.Seconds()
+	if t.nIntervals > 0 {
+		stats.AverageInterval = t.intervals.Seconds() / float64(t.nIntervals)
+	}
+	return stats
+}
+
+// updateSession copies the session statistics of the connection
+// into the status.
+func (st *Status) updateSession() {
+	if st.Connection != nil {
+		st.Session = st.Connection.sessions.Stats()
+	}
+}
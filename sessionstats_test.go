@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SessionStatsSuite struct{}
+
+var _ = Suite(&SessionStatsSuite{})
+
+func (s *SessionStatsSuite) TestTracker(c *C) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	t := newSessionTracker()
+	t.now = func() time.Time { return now }
+
+	c.Check(t.Stats(), Equals, SessionStats{})
+	t.disconnect("not connected")
+	c.Check(t.Stats().LastDisconnect.IsZero(), Equals, true)
+
+	t.connect()
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second)
+		t.message(100, false)
+	}
+	now = now.Add(2 * time.Second)
+	t.message(50, true)
+
+	st := t.Stats()
+	c.Check(st.Sessions, Equals, 1)
+	c.Check(st.Connected, Equals, true)
+	c.Check(st.ConnectedTime, Equals, 5.0)
+	c.Check(st.Messages, Equals, int64(4))
+	c.Check(st.Bytes, Equals, int64(350))
+	c.Check(st.DecodeErrors, Equals, int64(1))
+	// 1s, 1s and 2s
+	c.Check(st.AverageInterval, Equals, 4.0/3)
+
+	now = now.Add(time.Second)
+	t.disconnect("Error reading from server: EOF")
+	disconnected := now
+	now = now.Add(time.Minute)
+
+	st = t.Stats()
+	c.Check(st.Connected, Equals, false)
+	c.Check(st.ConnectedTime, Equals, 6.0)
+	c.Check(st.LastDisconnect, Equals, disconnected)
+	c.Check(st.DisconnectReason, Equals, "Error reading from server: EOF")
+
+	// the time between sessions isn't an interval
+	t.connect()
+	t.message(100, false)
+	now = now.Add(3 * time.Second)
+	t.message(100, false)
+	st = t.Stats()
+	c.Check(st.Sessions, Equals, 2)
+	c.Check(st.LastConnect, Equals, disconnected.Add(time.Minute))
+	c.Check(st.ConnectedTime, Equals, 9.0)
+	c.Check(st.AverageInterval, Equals, 7.0/4)
+}
+
+func (s *SessionStatsSuite) TestHub(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-4", "up": 10})
+
+	hub := NewHub()
+	defer hub.Stop()
+	hub.SetConnectionSettings(&ConnectionSettings{
+		DialTimeout:      time.Second,
+		HandshakeTimeout: time.Second,
+		ReadTimeout:      time.Second,
+		MinBackoff:       time.Minute,
+		MaxBackoff:       time.Minute,
+	})
+	ip, ep := fm.Endpoint()
+	c.Assert(hub.AddNameEndpoint(ip.String(), ep), IsNil)
+
+	var st *Status
+	for i := 0; i < 50; i++ {
+		if sts := hub.Status(); len(sts) == 1 && sts[0].Session.Messages >= 3 {
+			st = sts[0]
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Assert(st, NotNil)
+	c.Check(st.Session.Sessions, Equals, 1)
+	c.Check(st.Session.Connected, Equals, true)
+	c.Check(st.Session.Bytes > st.Session.Messages*10, Equals, true)
+	c.Check(st.Session.DecodeErrors, Equals, int64(0))
+	c.Check(st.Session.AverageInterval > 0.05, Equals, true)
+
+	fm.Close()
+	st = waitState(c, hub, StateBackoff)
+	c.Check(st.Session.Connected, Equals, false)
+	c.Check(st.Session.DisconnectReason, Equals, st.Status)
+	c.Check(st.Session.LastDisconnect.IsZero(), Equals, false)
+
+	srv := httptest.NewServer(setupMux(hub))
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/metrics")
+	c.Assert(err, IsNil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	c.Check(string(body), Matches, `(?s).*geodns_monitor_server_sessions_total\{[^}]*uuid="uuid-4"[^}]*\} 1\n.*`)
+	c.Check(string(body), Matches, `(?s).*geodns_monitor_server_last_disconnect_timestamp_seconds\{.*`)
+	c.Check(string(body), Matches, `(?s).*geodns_monitor_server_connection_state\{[^}]*state="backoff"[^}]*\} 1\n.*`)
+	c.Check(string(body), Matches, `(?s).*geodns_monitor_server_connection_state\{[^}]*state="streaming"[^}]*\} 0\n.*`)
+
+	// the age of the last update keeps going up while the server is
+	// down
+	age := regexp.MustCompile(`geodns_monitor_server_last_update_age_seconds\{[^}]*\} ([0-9.e+-]+)\n`)
+	m := age.FindStringSubmatch(string(body))
+	c.Assert(m, HasLen, 2)
+	seconds, err := strconv.ParseFloat(m[1], 64)
+	c.Assert(err, IsNil)
+	c.Check(seconds >= time.Since(st.LastSeen).Seconds()-0.5, Equals, true)
+	c.Check(seconds > 0.1, Equals, true)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxSnapshotTombstones is how many removed servers a snapshot
+// remembers for ChangesSince. Clients asking for changes from before
+// the oldest one get everything.
+const maxSnapshotTombstones = 1000
+
+// Snapshot is the state of the hub at one generation. Snapshots and
+// the statuses in them are never modified, so they can be read
+// without locking; every change the arbiter makes publishes a new
+// one.
+type Snapshot struct {
+	Generation uint64
+	Time       time.Time
+
+	servers map[string]*Status
+	removed map[string]uint64
+	// oldest is the generation from which the removals are known.
+	oldest uint64
+}
+
+// SnapshotChanges are the servers that changed or were removed after
+// a generation. If Full is set the changes since that generation
+// aren't known and Servers has every server.
+type SnapshotChanges struct {
+	Generation uint64    `json:"generation"`
+	Since      uint64    `json:"since"`
+	Full       bool      `json:"full"`
+	Servers    []*Status `json:"servers"`
+	Removed    []string  `json:"removed"`
+}
+
+func newSnapshot() *Snapshot {
+	return &Snapshot{
+		Time:    time.Now(),
+		servers: make(map[string]*Status),
+		removed: make(map[string]uint64),
+	}
+}
+
+// Statuses returns the servers the API shows, by IP.
+func (snap *Snapshot) Statuses() []*Status {
+	rv := make([]*Status, 0, len(snap.servers))
+	for _, st := range snap.servers {
+		if st.visible() {
+			rv = append(rv, st)
+		}
+	}
+	sort.Sort(statusesByIP(rv))
+	return rv
+}
+
+// Server returns the server with the IP, or nil if there's none the
+// API shows.
+func (snap *Snapshot) Server(ip string) *Status {
+	st, ok := snap.servers[ip]
+	if !ok || !st.visible() {
+		return nil
+	}
+	return st
+}
+
+// ChangesSince returns what changed after the generation.
+func (snap *Snapshot) ChangesSince(generation uint64) *SnapshotChanges {
+	changes := &SnapshotChanges{
+		Generation: snap.Generation,
+		Since:      generation,
+		Servers:    []*Status{},
+		Removed:    []string{},
+	}
+	// a generation from the future is from before a restart
+	if generation < snap.oldest || generation > snap.Generation {
+		changes.Full = true
+		changes.Servers = snap.Statuses()
+		return changes
+	}
+	for _, st := range snap.Statuses() {
+		if st.Generation > generation {
+			changes.Servers = append(changes.Servers, st)
+		}
+	}
+	for ip, removed := range snap.removed {
+		if removed > generation {
+			changes.Removed = append(changes.Removed, ip)
+		}
+	}
+	sort.Strings(changes.Removed)
+	return changes
+}
+
+// next returns a new snapshot with the changed and removed servers.
+// The changed statuses are copied.
+func (snap *Snapshot) next(changed map[string]*Status, removed map[string]bool) *Snapshot {
+	gen := snap.Generation + 1
+	next := &Snapshot{
+		Generation: gen,
+		Time:       time.Now(),
+		servers:    make(map[string]*Status, len(snap.servers)+len(changed)),
+		removed:    make(map[string]uint64, len(snap.removed)+len(removed)),
+		oldest:     snap.oldest,
+	}
+	for ip, st := range snap.servers {
+		next.servers[ip] = st
+	}
+	for ip, g := range snap.removed {
+		next.removed[ip] = g
+	}
+	for ip, srv := range changed {
+		srv.Generation = gen
+		next.servers[ip] = srv.clone()
+		delete(next.removed, ip)
+	}
+	for ip := range removed {
+		if _, ok := next.servers[ip]; ok {
+			delete(next.servers, ip)
+			next.removed[ip] = gen
+		}
+	}
+	next.pruneTombstones()
+	return next
+}
+
+func (snap *Snapshot) pruneTombstones() {
+	if len(snap.removed) <= maxSnapshotTombstones {
+		return
+	}
+	gens := make([]uint64, 0, len(snap.removed))
+	for _, g := range snap.removed {
+		gens = append(gens, g)
+	}
+	sort.Sort(generations(gens))
+	cutoff := gens[len(gens)-maxSnapshotTombstones]
+	for ip, g := range snap.removed {
+		if g < cutoff {
+			delete(snap.removed, ip)
+		}
+	}
+	snap.oldest = cutoff - 1
+}
+
+// clone returns a copy of the status that shares nothing the arbiter
+// modifies.
+func (st *Status) clone() *Status {
+	c := *st
+	c.Names = append([]string(nil), st.Names...)
+	c.Groups = append([]string(nil), st.Groups...)
+	c.Data.Groups = append([]string(nil), st.Data.Groups...)
+	c.LastRestart = copyTime(st.LastRestart)
+	c.NextRetry = copyTime(st.NextRetry)
+	c.RemoveAt = copyTime(st.RemoveAt)
+	c.Probes = append([]ProbeResult(nil), st.Probes...)
+	c.Sources = make([]Provenance, len(st.Sources))
+	for i, src := range st.Sources {
+		c.Sources[i] = src
+		if src.Metadata != nil {
+			c.Sources[i].Metadata = make(map[string]string, len(src.Metadata))
+			for k, v := range src.Metadata {
+				c.Sources[i].Metadata[k] = v
+			}
+		}
+	}
+	return &c
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+type statusesByIP []*Status
+
+func (s statusesByIP) Len() int           { return len(s) }
+func (s statusesByIP) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s statusesByIP) Less(i, j int) bool { return s[i].IP < s[j].IP }
+
+type generations []uint64
+
+func (s generations) Len() int           { return len(s) }
+func (s generations) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s generations) Less(i, j int) bool { return s[i] < s[j] }
+
+// snapshotHolder holds the hub's latest snapshot.
+type snapshotHolder struct {
+	sync.RWMutex
+	snapshot *Snapshot
+}
+
+func (sh *snapshotHolder) Snapshot() *Snapshot {
+	sh.RLock()
+	defer sh.RUnlock()
+	return sh.snapshot
+}
+
+func (sh *snapshotHolder) Set(snap *Snapshot) {
+	sh.Lock()
+	defer sh.Unlock()
+	sh.snapshot = snap
+}
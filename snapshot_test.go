@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SnapshotSuite struct{}
+
+var _ = Suite(&SnapshotSuite{})
+
+func (s *SnapshotSuite) TestChanges(c *C) {
+	a := &Status{IP: "192.0.2.1", Status: "Ok", Names: []string{"a"}}
+	b := &Status{IP: "192.0.2.2", Status: "Ok"}
+	hidden := &Status{IP: "192.0.2.3"}
+
+	snap1 := newSnapshot().next(map[string]*Status{a.IP: a, b.IP: b, hidden.IP: hidden}, nil)
+	c.Check(snap1.Generation, Equals, uint64(1))
+	c.Check(snap1.Statuses(), HasLen, 2)
+	c.Check(snap1.Server(hidden.IP), IsNil)
+
+	// the snapshot doesn't see later changes
+	a.addName("b")
+	a.Status = "Error"
+	c.Check(snap1.Server(a.IP).Names, DeepEquals, []string{"a"})
+	c.Check(snap1.Server(a.IP).Status, Equals, "Ok")
+
+	snap2 := snap1.next(map[string]*Status{a.IP: a}, nil)
+	snap3 := snap2.next(nil, map[string]bool{b.IP: true, "192.0.2.99": true})
+	c.Check(snap3.Generation, Equals, uint64(3))
+	c.Check(snap3.Statuses(), HasLen, 1)
+
+	changes := snap3.ChangesSince(1)
+	c.Check(changes.Full, Equals, false)
+	c.Assert(changes.Servers, HasLen, 1)
+	c.Check(changes.Servers[0].Status, Equals, "Error")
+	c.Check(changes.Servers[0].Generation, Equals, uint64(2))
+	c.Check(changes.Removed, DeepEquals, []string{"192.0.2.2"})
+
+	changes = snap3.ChangesSince(2)
+	c.Check(changes.Servers, HasLen, 0)
+	c.Check(changes.Removed, HasLen, 1)
+
+	changes = snap3.ChangesSince(3)
+	c.Check(changes.Servers, HasLen, 0)
+	c.Check(changes.Removed, HasLen, 0)
+
+	// from before a restart
+	changes = snap3.ChangesSince(10)
+	c.Check(changes.Full, Equals, true)
+	c.Check(changes.Servers, HasLen, 1)
+
+	// added back
+	snap4 := snap3.next(map[string]*Status{b.IP: b}, nil)
+	changes = snap4.ChangesSince(1)
+	c.Check(changes.Servers, HasLen, 2)
+	c.Check(changes.Removed, HasLen, 0)
+}
+
+func (s *SnapshotSuite) TestTombstones(c *C) {
+	snap := newSnapshot()
+	for i := 0; i < maxSnapshotTombstones+10; i++ {
+		st := &Status{IP: fmt.Sprintf("10.0.%d.%d", i/256, i%256), Status: "Ok"}
+		snap = snap.next(map[string]*Status{st.IP: st}, nil)
+		snap = snap.next(nil, map[string]bool{st.IP: true})
+	}
+	c.Check(snap.removed, HasLen, maxSnapshotTombstones)
+	c.Check(snap.ChangesSince(1).Full, Equals, true)
+	changes := snap.ChangesSince(snap.Generation - 4)
+	c.Check(changes.Full, Equals, false)
+	c.Check(changes.Removed, HasLen, 2)
+}
+
+func (s *SnapshotSuite) TestHub(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{"id": "ns1", "uuid": "uuid-12", "up": 10})
+	defer fm.Close()
+	ip, ep := fm.Endpoint()
+
+	hub := NewHub()
+	c.Check(hub.Snapshot().Generation, Equals, uint64(0))
+
+	configRound(c, hub, ep, ip.String())
+	st := waitStatus(c, hub, func(st *Status) bool { return st.Uptime > 0 })
+	generation := hub.Snapshot().Generation
+	c.Check(st.Generation > 0, Equals, true)
+	c.Check(st.Generation <= generation, Equals, true)
+
+	srv := httptest.NewServer(setupMux(hub))
+	defer srv.Close()
+	get := func(query string) map[string]interface{} {
+		res, err := http.Get(srv.URL + "/api/status" + query)
+		c.Assert(err, IsNil)
+		defer res.Body.Close()
+		c.Assert(res.StatusCode, Equals, 200)
+		rv := make(map[string]interface{})
+		c.Assert(json.NewDecoder(res.Body).Decode(&rv), IsNil)
+		return rv
+	}
+
+	full := get("")
+	c.Check(full["servers"], HasLen, 1)
+	c.Check(full["generation"].(float64) >= float64(generation), Equals, true)
+
+	// removed from the configuration
+	configRound(c, hub, ep)
+	snap := hub.Snapshot()
+	c.Check(snap.Statuses(), HasLen, 0)
+	changes := get("?since=" + strconv.FormatUint(generation, 10))
+	c.Check(changes["full"], Equals, false)
+	c.Check(changes["removed"], DeepEquals, []interface{}{ip.String()})
+	c.Check(changes["generation"], Equals, float64(snap.Generation))
+
+	res, err := http.Get(srv.URL + "/api/status?since=abc")
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Check(res.StatusCode, Equals, 400)
+
+	// readers don't wait for the arbiter, even when it's gone
+	hub.Stop()
+	done := make(chan bool)
+	go func() {
+		hub.Status()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		c.Fatal("Status blocked")
+	}
+}
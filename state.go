@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultStateInterval is how often the hub state is saved if the
+// configuration doesn't say.
+const defaultStateInterval = time.Minute
+
+// savedServer is what's remembered about a server across restarts.
+type savedServer struct {
+	IP       string    `json:"ip"`
+	Port     int       `json:"port"`
+	Name     string    `json:"name"`
+	Names    []string  `json:"names"`
+	Groups   []string  `json:"groups"`
+	UUID     string    `json:"uuid"`
+	Version  string    `json:"version"`
+	Queries  int64     `json:"queries"`
+	Qps1     float64   `json:"qps1m"`
+	Uptime   int64     `json:"uptime"`
+	LastSeen time.Time `json:"last_seen"`
+
+	Sources []Provenance `json:"sources"`
+	Pinned  bool         `json:"pinned,omitempty"`
+
+	// the restart detection, so the query total keeps going up
+	Started     int            `json:"started,omitempty"`
+	QueryBase   int64          `json:"query_base,omitempty"`
+	Restarts    int            `json:"restarts,omitempty"`
+	LastRestart *time.Time     `json:"last_restart,omitempty"`
+	RestartLog  []RestartEvent `json:"restart_log,omitempty"`
+}
+
+type savedState struct {
+	Saved   time.Time      `json:"saved"`
+	Servers []*savedServer `json:"servers"`
+}
+
+func newSavedServer(st *Status) *savedServer {
+	return &savedServer{
+		IP:       st.IP,
+		Port:     st.Port,
+		Name:     st.Name,
+		Names:    st.Names,
+		Groups:   st.Groups,
+		UUID:     st.UUID,
+		Version:  st.Version,
+		Queries:  st.Queries,
+		Qps1:     st.Qps1,
+		Uptime:   st.Uptime,
+		LastSeen: st.LastSeen,
+		Sources:  st.Sources,
+		Pinned:   st.manualPin,
+
+		Started:     st.started,
+		QueryBase:   st.queryBase,
+		Restarts:    st.Restarts,
+		LastRestart: st.LastRestart,
+	}
+}
+
+// status returns a Status for a server that hasn't been heard from
+// since the restart.
+func (saved *savedServer) status() *Status {
+	return &Status{
+		Name:             saved.Name,
+		Names:            saved.Names,
+		Groups:           saved.Groups,
+		IP:               saved.IP,
+		Family:           ipFamily(saved.IP),
+		Port:             saved.Port,
+		UUID:             saved.UUID,
+		Version:          saved.Version,
+		Queries:          saved.Queries,
+		Qps1:             saved.Qps1,
+		Uptime:           saved.Uptime,
+		Stale:            true,
+		LastSeen:         saved.LastSeen,
+		LastStatusUpdate: saved.LastSeen,
+		Sources:          saved.Sources,
+		Pinned:           saved.Pinned,
+		manualPin:        saved.Pinned,
+		TotalQueries:     saved.QueryBase + saved.Queries,
+		Restarts:         saved.Restarts,
+		LastRestart:      saved.LastRestart,
+		started:          saved.Started,
+		queryBase:        saved.QueryBase,
+	}
+}
+
+// StateStore saves what the hub knows about the servers, so after a
+// restart the dashboard shows them right away.
+type StateStore struct {
+	sync.Mutex
+	path   string
+	closed bool
+	quit   chan bool
+}
+
+func NewStateStore(path string) *StateStore {
+	return &StateStore{path: path, quit: make(chan bool)}
+}
+
+// Load returns the servers saved by the previous run, if any.
+func (ss *StateStore) Load() ([]*savedServer, error) {
+	js, err := ioutil.ReadFile(ss.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	state := new(savedState)
+	err = json.Unmarshal(js, state)
+	if err != nil {
+		return nil, fmt.Errorf("could not read state from %s: %s", ss.path, err)
+	}
+	return state.Servers, nil
+}
+
+// Run saves the hub state every interval until the store is closed.
+func (ss *StateStore) Run(hub *StatusHub, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			servers := hub.SavedServers()
+			if servers == nil {
+				// the hub has stopped
+				continue
+			}
+			err := ss.Save(servers)
+			if err != nil {
+				log.Printf("Could not save state: %s", err)
+			}
+		case <-ss.quit:
+			return
+		}
+	}
+}
+
+// Save writes the servers to disk, unless the store has been closed.
+func (ss *StateStore) Save(servers []*savedServer) error {
+	ss.Lock()
+	defer ss.Unlock()
+	if ss.closed {
+		return nil
+	}
+	return ss.write(servers)
+}
+
+// Close writes the final state and stops Run. Later saves are
+// ignored so they can't replace it with something older.
+func (ss *StateStore) Close(servers []*savedServer) error {
+	ss.Lock()
+	defer ss.Unlock()
+	if ss.closed {
+		return nil
+	}
+	ss.closed = true
+	close(ss.quit)
+	return ss.write(servers)
+}
+
+// write replaces the state file atomically.
+func (ss *StateStore) write(servers []*savedServer) error {
+	js, err := json.MarshalIndent(&savedState{Saved: time.Now(), Servers: servers}, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(ss.path), 0755)
+	if err != nil {
+		return err
+	}
+	tmp := ss.path + ".tmp"
+	fh, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(js)
+	if err == nil {
+		err = fh.Sync()
+	}
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, ss.path)
+}
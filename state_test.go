@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type StateSuite struct {
+	dir string
+}
+
+var _ = Suite(&StateSuite{})
+
+func (s *StateSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "dnsmonitor-state")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *StateSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+// waitStatus polls the hub until fn returns true for one of the
+// servers.
+func waitStatus(c *C, hub *StatusHub, fn func(*Status) bool) *Status {
+	for i := 0; i < 50; i++ {
+		for _, st := range hub.Status() {
+			if fn(st) {
+				return st
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Fatal("timed out waiting for the server status")
+	return nil
+}
+
+func (s *StateSuite) TestRestore(c *C) {
+	fm := newFakeMonitor(map[string]interface{}{
+		"id": "ns1", "uuid": "uuid-3", "v": "2.4.0", "groups": []string{"edge"}, "up": 100, "qs": 5000,
+	})
+	defer fm.Close()
+	ip, ep := fm.Endpoint()
+
+	path := filepath.Join(s.dir, "state.json")
+
+	hub := NewHub()
+	hub.SetStateStore(NewStateStore(path))
+	c.Assert(hub.AddNameEndpoint(ip.String(), ep), IsNil)
+	waitStatus(c, hub, func(st *Status) bool { return st.Uptime > 0 })
+	hub.Stop()
+
+	servers, err := NewStateStore(path).Load()
+	c.Assert(err, IsNil)
+	c.Assert(servers, HasLen, 1)
+	c.Check(servers[0].UUID, Equals, "uuid-3")
+	c.Check(servers[0].Queries, Equals, int64(5000))
+
+	// the restarted hub shows the server as stale until it's heard from
+	hub = NewHub()
+	defer hub.Stop()
+	hub.Restore(servers)
+	statuses := hub.Status()
+	c.Assert(statuses, HasLen, 1)
+	c.Check(statuses[0].Stale, Equals, true)
+	c.Check(statuses[0].Name, Equals, "ns1")
+	c.Check(statuses[0].Version, Equals, "2.4.0")
+	c.Check(statuses[0].Groups, DeepEquals, []string{"edge"})
+
+	hub.MarkConfigurationStart()
+	c.Assert(hub.AddNameEndpoint(ip.String(), ep), IsNil)
+	hub.MarkConfigurationEnd()
+
+	st := waitStatus(c, hub, func(st *Status) bool { return !st.Stale })
+	c.Check(st.UUID, Equals, "uuid-3")
+	c.Check(hub.Status(), HasLen, 1)
+}
+
+func (s *StateSuite) TestForget(c *C) {
+	hub := NewHub()
+	defer hub.Stop()
+	hub.Restore([]*savedServer{{IP: "192.0.2.1", Name: "gone", LastSeen: time.Now()}})
+	c.Check(hub.Status(), HasLen, 1)
+
+	// not found by the discovery
+	hub.MarkConfigurationStart()
+	hub.MarkConfigurationEnd()
+	c.Check(hub.Status(), HasLen, 0)
+}
@@ -224,24 +224,60 @@ TFl6GGK8lPyLsUBjcea+n29uDyrfSxdtp8vAUUuwC2U2OzBFOodAgJ0MgX0p6YfmyW+ZXQCHWa2mTYif
 	},
 
 	"/js/dns.js": {
-		local: "static/js/dns.js", size: 2514, modtime: 1441656343,
+		local: "static/js/dns.js", size: 11380, modtime: 1792314652,
 		compressed: `
-H4sIAAAJbogA/5xWT2/bNhS/+1M8cEFFdY4cD9klbjJg22U7rBt2LAqDkWiJLSWyJJXMM/zd9yiRsqQo
-WFFeTJPv7++996NIazlYZ0TuyG61ooe2yZ1QDdCrFE6rFeB6Ygby1hjeuL1WWj1xs7vctLpgjsM9RFXq
-FSGsq6zk7ve/3/9Bkw3TYmMdc61N1hfp/mSs49dmk6vGKskzqUpKcrKGILibyPkILDcYksUQepEsHOxm
-FmGfHYR03NCp3DgYjAMMd61pAO97sZq5vKJkm93ekBTO6WpitzRMV5hlww3i8IuSylj6/vETz132mR8t
-DV7STPKmdFW6m+pf0eS7mIHVrPlguLx3Skkn9MckzcKWJpUoeDJLf6zsHlVxRIXK1ZISMpPcZ5xhFvhr
-lXE/H+ly8hMdv8QBqM0aVmOJ7+8B7V4QIv/2i8D5hd4Aoled3J7T//PZQ2p4rkwRnGP5sy96Xn2/+ntf
-/T1WSgf5cV7NKOQT+Ns7aOCMgSxZy30F0Vqsq+tKGswuamBc+1wy23Wg/wdv3oTNA2x/vIGfgFSirK6/
-tNwcr32bELhDKF8xtq2joW2N5f8TgRDWJ3K76N5wq3FW+N6Jmg+B0NlFH9P06AFub25SH56V6vk6Xr4W
-nJ81x2st+3mP2zhHaLwpcLhOYSDvwC5CPOpZ7FamNarRaGwmf55PC07xpDuIbeuamePAD1k4WOgW1O18
-9wJxUsZ5BNWQSLAIKXzrzJ6QWMvSQ0EqT5sYJbrKeY1Uimd4WTnyIseO05zvQU+cmWfnphSHY6CtNbQY
-3kE0vFjDD0uE0Inti7bWMUm0MRKMVTkHxwGYgj+25d6pspRINBk2XJJLkX8eszWP84o6y/56fRpcoNiQ
-37TwY/OEZUKTJTd+8Uwb/oSQ/coPrJWOjlLxWAmNUF1RVwkkWcf/mQhMn5HpK4YeZyevKvpAeQH4MHaB
-Cr2Gzh9cFDxTzs0h38yOsvAb+XxEnTGFKHGCS/vUrGmZRM/ECSc5waODUmQyYHN9Yiv1PH4HZqFcUAsF
-Giq1eTsvWNfmWKRkFN4YKtd19OInwFeVya9A0ck7LPdD8oI3vl8eh/iKf8DRm43Ggonk3aazPhqGIXX/
-+3YzjEREqeC1CnAQ1k16uPlIoocBk+Ggaxj6tf0crvynRbftv6kiPs+iKdQz5ul+Q5zNE5O0F1jDdosE
-vludU/rpL/+44P6/AAAA//8afmmt0gkAAA==
+H4sIAAAAAAAC/60aXXPbuPHdvwJh0xN5kWm7k+ZBipOZXu5mrtNe0qZvmYwGJiEJZ4pkCFCO4tN/7y4+
+SIAEZV17erApYLG72O9dKmoFI0I2PJPR8uIiXrdlJnlVkvh5Qh4vLgh89rQhWds0rJSruqqrPWuW/Q4s
+56wht8QejYWkshV4nJjP1VVWlaIqWFpUmzjKojkxQMsOBnEJ1gByAcj0dmoWlg4mskrXvJCsiX2YucMA
+0Aa+ZNuUBPY12I7KbBtHN+nL6yghx+Siw7lpaL1NN6xkDZXsh6qoGhG/v/uVZTK9ZwcRGwpJWrByI7fJ
+sj/7PJ79yXItalp+alhxK6uqkLz+PEtS8xjPtjxnM+e67kF5V+UHAN7KXRFHUeJd1wI1jGZbelcwggog
+d5Xckp8/7F8SWub48Aog6qqRRG5Bo3THXCRty3MFSBvY3FYPJaGCVCWbk4LfM3UmAt3wjBZRR7Jauziu
+aM2vtDA9pZljoLRVummqtv7bIV6le1q0rBfdQDsdAvx0mlJc/vYbiXi9iMgLWOF1L4vjwFgUrV/goq7t
+qcUJAmg4ZQ681UWb3WvQOYlKQBEBg6sUVFRKLg+JYiJySDsaX6WoiBj+C5C2e1cjCPeup9jp+LdQSPSb
+/ri0n8SnFpX4DUfmZhP+sKY7XhxAvBGxQvZka+Wr4DgTnmLPQh3ClrfGRAT/xmKLOyFvyM0YuG74jjYH
+Ba90dpqsNkpye3tLovf3EdBHWaozn64/O7rr4ozCnBXgALGhNWBZpKW2rKGWlgPRY+hoWFY1eazPQGhL
+v9QiiE/T3dEajKYt+Rf4l1W7mmYSntYFlZKVQfsUUQIfRwClI4BHgiALUpLjSPQCCEA8UxfRUU6qAGeY
+HUED56usoELFYPxGvvvOPICm/npN3pJoyzfbyy8taw6XGDAjsvCcpUN0s7NIbnYQCD+AmLhA5l+OyNI8
+b5gQjoCGGqdDq3c8abyBHwgihIJxz4O7GCpxH/+HISBllUwRX/EcQd9RSeH++iH1tpUIwmi0T6wKescK
+xGJ8RBkrr/evIhQp/ltoH8FvL6OnESot9WcU/kterqszzkKQK1h/Fv9fghNl9yb0n0IBeqohmTNAsmOW
+i5im3jpazXDpDXl5fY2eGUSLH8CSl2Jl3FmhcL4/Q4lV95C8gWVRVA+XFv8pdnsECx+dCvGTZxYj9t+O
+ViCC7gTQ/iPus6a8YPmpi9Qc7A3s8NkzMFr1PAEH9RgvN6uG7SpITOaAvxg+uePggfkKHK/MlQC8BRTY
+dfggXAjNCQmpx0koyXo/UF+1UPSjkgeUogxstNxESuB6Z1ooGqcxZ5qW7KuEO0pIHSBT9QCoCJUq05Xs
+gYDrstgFxBLtHxWkbfYf0OlHqITLTZw8QVIbk2tII9CjH+JCKVGyXV3g/W67R1vNprqqjh+NQy4gZQ1R
+OBUk1I60Rh3HFlHi101uHeflrEi0O0x/XUWemoVBDoNzip7etLWqy7c5Zhg32EhC/pdq+RHUsNngtaMt
+VrvAHZDJ2A7qM1iDza2MvHuprC4xz/394/tfUqH0yNcH0yTMCZgwg1ICvIb8ZViGK5BV3u5qezE4b4Bs
+6QcC+FAVhVsFzwldQx+iiuc1bwSU3hgWqhLC+7rS6+a2FoXcgi1CGV9uWE4ELzNdekMQlcQ0INh8PbDZ
+Hs+yMu36rLbOta10PVrspkQtAF0HEWs2YKaPUBP4htzT6cVgEmkQc8dAgwXczBHAzDdIviaxcwn0507q
+WK4ggheA4a26+O0MXNIBP/rGjZUKqjKGU04ZADIIVgID2rcubfRQPJeu26JARvzGEeV1HJB3Cn11MtBj
+zqHAGCP7BIaMVc/IW4cYVSRGa+wwanQ5K5hkIawhjO6V9R1D2u21rHxz1HoPA5SJXcckTnrr/wmsv3qw
+9o9RmjxsWans966pHoBVItoa6ylBuFyqDakaVt7Zv5AcfKhheUOhBQWuqfIZOFkpeBWb4FaAgkKJxksJ
++QznAlBt5b0vGPq35P90BVG1TYY+hanhxz1El49qJZ4515y5cUafSKsSanJBN17vyUJew/Y2JtW0ESxm
+qTLhQQH8wGW2JTHbp/JQj/BkVEB7LkpaQ+suo3HBMTJoQGS/gPE/Hse2cAdXu18GyOg48ySRTx2JVJt8
+9/130NJOEKAV9gIgAbTOwn8M9u5TDvAAPWb1AHTkzyVEdKiQvCA7OAdWRG5uoJb1M0Q/DPsBakQuoJfL
+Dq596PnM0FKzLcvu+75HA6V61YkOamFkGLjo9LIaaDmG0f37qgCunBZUDbecfZGoCULsTRxO9V26O16Q
+zZyous62Ay7OT5vPWIyp0tY0KTu8Ii1l9FSVpPGAlDhA9zLylx1m9xCUQ/zuHRntA2F0n0IA6/refcqa
+BvI3cP1Am1IVowvCoYFR7a/aDDW9GlPvhJrZ/cSAcqK5MoLF5hUnM3PT25t5BDiznteMKYfSg0G3Py1l
+A6WkGh63YZWU9Ua90tZpi6W+CHRg+gpWAy+soR+TgN/ooDPhN66w+rpAh2iH4mw+dr/Eu2iKXZbv2adv
+FrkcGf5xglpWkrASc1ueqmHy+EY6ZQlvLu5eBAsWQV6TV9fOJOefVEJlju0WAkN/Ce3lcVikKaB1UeEQ
+h1wpBNiJYofjnid/tlsimgpUHxm4UOExOSywEPgb+E1v0KrMUEuOReP3oVHjmuN4CmQ5ghg5jLvo+kyz
+D3kNLDs0EGgZgrHjvO4RPanZewNmF9yNB/g9FBFw3bwX6SKcDg5hnNrI81VtCg7Vizob4VY0jAsSJD0o
+TD4XxuziDiaZCFR2eNo8ERyUNrZUrHTXgvJQS+areSWCsTFwrj/jqNYserkNV0La1TtehlOgywnIVPVh
+K+ycfDGPtnthTwvaHMpbXVArjGatbqqablBrjtAH8Er0vCQAu8Hp5rQW9MGzojSKcDpI4y5cT3n1ODyb
+jT40Ky9eGP8+EZgDceJUULYMzP0wM1kvveMiwzb/8FQg0tX3IBSZRS9UZENjgiUvTGTDCrzJBj6fpdX9
+SbdGEGzcVzi239Vy6Nf+7jnOjWc8Y+u9ud9IJrgQbQZSECYm+Isp1Lfs6/t1HF1fX99cQsrCBllVMyUz
+894x5+bwU57SRZJs2i5zq+GV0dbYODuQzjwDrRoYq1W3t4sBagjhhCYfWF2uaUHEzq2VKdmd8ZV9DL2S
+Fp2OFIJOSY4kJr0qaPan/KoTUedZHYqgb0G/0kjV1nquy9SKS6h7QYpOpbfnLvzQm5ibc9kw5WIXi+8G
+PH8wi2caE9uPbWkswH/rG54dl4xEMDCdHCg50kPcniDt9EbvBkayZmulxTi2c3s0bObmDYuCWHRP40k0
+GvwYzjH5QS5JpuVpRrs5u2s3K1ltNgUDrkE0s6zg2b0rrC5Hw5nw9FSft1oFsG5K64+rXfQR+A2TUJqL
+aD4xTcGEqwT6jq1pW8h48FsAjrb2PJZbDuEKNRRHvHZ/SBFIUcjJFQ4heX2qNXPfFY/f6g4zkjgvHZ2T
+krq0xERV7Md1Y79zTi0TitJTLybUXM/xKXliBiB/V26RT7F6HAkYMpAeb3aSsmvJBKx9NQsi6+KQ2xlN
+wHm90hipyg3mhEKJUorD+8lJJCqMn8bTg0yioiBbumErbiZWOvFPboPcf+JfWR7fBO+pI4ByQv06DX2Z
+fZWxP3gYxruTXgV/ZmfHXH05P3iGY69JXwFnSZ2o2KMYYp1sWYZycH+V5dQpejf8hi45iRGQ7aqcFvEM
+f4I1OzWBtzH6rOgJoe4PCZxK4Q6A/6M9/xeAQHGwMnkQGYU+CZxYMYrhVtEjS28aMkRHHocUUvPf/prO
+mY3YK1iIR9K/QtzRsqUFUI6UZUewtK6qaFCk+ucj1JCbQAas9FIzCuo0dfX9RehVJyhp5rDnikqqt5on
+372dVJMTjWevQd1vZiMjfBF+Leq+Xxq8Ig2gmL2+UtgdM71wjfX7q66gsFLK2a4y4oioettrdj5HlkIn
+k25BGUx8rj1fWI+50NRHo0QrqsCQfwQ7JzeQxexk32t+n0Rj4EIoujL9SSQdZAiNrXefxGIBeyQX1svM
+Gedllyte/cbL4j8SVgjmbGvs8ek3JxrIf0VycUziX//V6kblv7esFJh0LAAA
 `,
 	},
 
@@ -262,19 +298,50 @@ QhWyQj/Phq7VJZrcy5HCGF9j3laUsv5X9m2a0K3rNan2Gbtsx7V3DA07fwMAAP//EDGmY4wGAAA=
 	},
 
 	"/js/templates.js": {
-		local: "static/js/templates.js", size: 2318, modtime: 1441705446,
+		local: "static/js/templates.js", size: 16997, modtime: 1792314653,
 		compressed: `
-H4sIAAAJbogA/7RWTXObMBA9t79io0MHpgoEYyeOv0499Af0Vnc8MsiOpiAUaUkn4/i/V4BNYxk3dj8y
-w0TKwnv7dqW3ESvwrq6ukOcqY8iND09MQ7uFKWy24/ft/isxXD9xTb7ZiOQ/4HOxZjL4sot7m6RI+QhW
-pUxQFBK8hCoqfNg0sFN8EGaMwdITU/HyQohfb8gE9Wy/nksCH0H4Y7HyMDD2WXl7VlrBRX7964ZGt3QQ
-DynZbGC7Jb6/wUCbmnHPX2+wCtQk6WxiFJNg8Dnj0zlZsuT7WhelTK+TIiv0SK/te00eGDw11HWkYb7x
-/V2S/pzMPsilUeNJWEHOoEHWPLO4WBQZCjUngAJrJnIoR7KcG1dNNKRR7+5cOW1+FZabHli+rT9OAlUo
-zy6bwpKZq63r252gSWjL9aonbnfakjrSPjFkrrK7Po3uo4uVJYWUvA4vRPoqzSNlZ+faNCnJmDG2KVWH
-jo9d8zKDB81X9qUHRDUKQ7dyQrl1Gw1vBnFokGFpOkp9/MEkZKfYz9TTKnHJHpVZ1DGX86RgsD9OJy2I
-08i416NxHF/cyBbpVyJh9beuQ/pHhTgh6t2xoih3Nd0OaHx3tou81rTH+t+qWk5rgcbmc3yQTlagOfQ5
-yzL3nla+d9TgfnxP+/3BZcVIPRKcZUDWWepM3sjXVV0qFDlfdNyfi2DsdcBFqVI7pv4Sqbnjb4G4cF2u
-VU89zbHUEix0ZmOwpYppFCwzIzt7KZhyWa3ANsQ/nMRlnjP9/O9G8cHA3YE7Tt6jw/MHbuUph467RAn2
-uRZyVdSLjOk173DLDseAx5JrYf8lUVyD4XY4pLtR9dtSX1TdnwEAAP//pWZFrg4JAAA=
+H4sIAAAAAAAC/9Uba2/juPFz+ysYF2htVJtY8kN24jVQ3PbaA66Ha3evX7qFIVu0TUSmtCSdXC6X/35D
+SbZlkZQpPy5ZLDaJpCE5Q857hmSOmldXVwKvkigQmLfQQ8DQ9hG9R88vd3/cPv+vMYspJ1xgOntq/B8+
+U/yI/hkvAnr9KQdqPs/iEN+i+ZrOBIkpas6cxCEt9JzN/V4sCb8T19MmeU9+/bXRaN2RefNKXPOmuJ43
+G7Mlnt3zhiNHua3sl9OGfwDZepbjGqNk/EOMCqigbJB8NSeLNcPh9egmGcPUKfxn2kB/RaR19yKXqlqp
+7fh9Z+B7TuP5Gb28ZCsynpKwISh9EBtUll11mfQJofy9uH7I1qPBCmertVutDVQZSDwlRaAivnw9pViU
+8HVdz3G79gijEV8FUTTGM/6+vHZxgR2Ko5tsBEC/tO5m10mcNOFPE8l7O7w5IgVr33U8r8Y28ySgaBYF
+nL//3IiCKY5Q+vMdX89mmPPPjfFuMcAYwGsgfHUIY4UDjfiQVRIzEVABGIXkAbPFPkJ6Vhltt7i4fQsW
+r5NJBPiUtq/T9Z1uu33S9pUPP307SWHKHACklKFT1DScIslEuo0vcJFmB0Y3RjkaiWAa4S3y2VP68x0c
+Vogpx+EOQWXwEgeh8SMzyi4ciQgRF08RhkUfSSiWt6jTbic/w1p/o/wRs9GNCKvHjz9iBhzAKyDhEzN/
+qkR+GodP6sci/4C+JcCJZRXX84fOoFuDewTbbn+ZD1j8eIhnFMTDMp9jxmJWQrLvuU6/Y43kFqHCXCky
+RUbck3R10ZKQ72iUBs2kkzFscVTG3Yf/g4G9Ts5mUUSyOLmOmC0WQcqQiilzXcfv9OzPecrGoz0pzTAJ
+m41rS6PwsmXd0P74eSYlZewll7r9mjpOEJFKbHkrSWKh1HQGulqn1ZRr3Qx6Md58lXqueh6GxZoB4dfz
+CB7Ri5METADb8Fvw3RwENl3+hWAPW3ueXIhFQCJ+Vi+udKSKqwKeyrCG3gmjrd4Jo3fLmJFfYiqCyKhb
+QOuGYvzdj6Mb+DUKw/FhNkA6jgfIebAi0ZOJ7WGBsBKHn3767oMRi/WahOrMB2b8AZiTF6cs7rfk3LIA
+uT3fcfv9ehpUK+tTNtaz/wGU/yGdBCPOqQtRRtpzu+AYtk9HGh2F8X9BD8ESxpN7yL7XPryPIhBrbpyW
+p59rz/rvNRgIbJ5WxCAsky8ZlC3jm8A5oTNwvJYYHF0uEMOANBPWAvGfDN6MbD5hnV2AT1G1B7QM+CSf
+eIIfsOoLdf2B47dr2Mhlr0AKPFzEaT3s2lUS1et7Tr/v13Hwqq31PleRFZ5ofP9Kk6+JQDQGmOGA66Qr
+M8EGhs0MmVlTvwEbvW8a+U6F7LydLhhHt9epxYjfxJTi9FMVKx5pRT9meFYorRygvPOOTMNIvHCoeLTb
+LxMTFx1QI99L3ZPPYsRMKqhJDnTsGiHhVsvs4CbWvkVhjJHj7bTqv+AMgkWFCVjlAApqzTLk9ElowNK3
+LQeBnmFPynEG8BZmnxAqwOEDW1N/sz9g6WiiNBozkxGmUJMM6mQLoYo4SM+38ZqGQO/ltPopqQgp62lq
+M8jE/WDqAYxUHD2ACErXsAb8a+UqeLxmM9WH7XT7EDT0hmeyZSPJRmONVoK9VdkqBTYJcYbwMWZHY1P1
+kWetKVh+gPVM89sPU6WulMrnQuUGHd/p6w15mqJmkUF6oHre9j3H92t4nklmmNiaIq0lgg/q2TtIxPG9
+MiDMFYk6QE/Tq6u/v1PBnizU2KeALbDgFpDpZgZCspqwBc+LDTaZ3zzge0vKtON1wc/svm7e10rx1lJ8
+IjvyE2dJRShnB7Mn17QXpNaRpiBFJGe02mFWKcUS35fD3aHn9OqkhC3qbvG9vt62p2ZLmBxXT5tDnKcP
+KjierQV5wBMJAqpZ4YafzSW4g5WIrpdm9E9No2uKE/b11SKS+zTu8ByCeLuD3zPdr1deX6+zsc1BXcbX
+2E9xVTobG1DwOjC19TO084OjAXJfo0PgNc38J2IVrGR1VauoRobXFoB5KhVN8Txm+LXstuEAPTDaXbf9
+lvJ5Vr0tBi1IkiOjpjeZRNRshiGF/lWrxqwWfSnN+EtMrWKwFK4QgSFC05KE2gtmozPVVdvOoO+47mB4
+kQYwuZ5aV7Gs/dv0WyUsToIFnEeo5FEGTi2qLPy+3WIn9FsZMLb3Dx8DRgldFPCBpwP9Vl9Ht5HrZd1G
+tsbONF6Ww2uPbW/XBi48YbwsGlqY3w84Cp5eLVrW9p/0+llV5u1Ey2dIEpJT7bxeLdWcZJ2EUuJPjW61
+wZo/rNN6dcm2sVDy9B6NL6/sB5TjhdkyoAs1Lwnb57r+VxEwXEpvfUuYTPdB7HW83t3MYRmq/LgxX5Xx
+ykUVoZ4f3HanAwxRTxX+3iplLjd7Ig/s5FBmM9Wug+3oqczZwTcRC5wpLpD7dLawwMxAh/sLZanQq5Hc
+3IaUGwmeBrN72ZZGQ9BcUcxu2WLaVNONkZrEa4HA/5lOeXK3CzTlzAxHUiXGcSRI8rlR7E892L/ngh72
+/NqmzHTNRPXNa3XAljnW1koHYcggYFDJA0vttes3eM+2TS8TTRelsVXxvMh7naHT7RwbT0lOMMltgJYM
+zwFoKURye3Nz2IO7LYPIhHkZ6CZrMdQcuc4lDKqlL+uNnaQBmFJj6tVLVVncTMmXMzjQxpbvfFj62aL5
+WyVKEQGb7HcmKwY2rE6Vm5jSGFZ8SXjNsEI6GyUW/6L04PZAKnuuW1sytzMV2E6+O9tGGIj6g0qRuyrT
+1O04vV7/GJo2c12aqsNNxgeSo8YrZEqlyPWdvte5WJP1UUnTdXKWRHRaPs0CzNOiS5Pq992O4w+Pvbqo
+6dpJZPky64esq+JCyif63nGNggspN5l2S6t53IYNOmDsu22rvoO9ZCYBQ19OZA4gDBmepYBN6DwubO09
+ToTscqTocQk/tm1HKIwxp38RaE5oiIgsQ2eIGS4G7VGAaUjoYsLwKn5QbokN++CvtgfuOWjZFcm3BNEY
+cM57Gndt+0p/KIETCyepz6t2f+52ga2pdB5SSnYJ1irigS83drfg0so7QF77HInobeJ3j2KIgFmI5ixe
+FS4srGJKRMw2RdU0G5GiZ0eGwFpXx/WAD91O+6RbzBXCna1s674oeFpdYTtwAwXt3NE/AabbNvLs6hi8
+ATUbvCOJ7YW73Ebl43eGIhgf67jrBqQzHR3Prler4MzdhoUb/NnkZUZy6lwWlfmiPUaaCorgf6rR0j8i
+2RGl4RGNg4byWiVKMEMcy3zdztk9UxXxN4MDaKVlQgAA
 `,
 	},
 
@@ -295,15 +362,85 @@ ovsjAAD//99994BiCAAA
 `,
 	},
 
+	"/templates/client/consistency.html": {
+		local: "templates/client/consistency.html", size: 884, modtime: 1792311342,
+		compressed: `
+H4sIAAAAAAAC/41TwW6DMAy98xUIzh2VttOURtoP7LJ7q5B4BS0FFId2KOLf5yQlUGmadnHMy8uL82yc
+O8oG5BfOc8YG/t7nsu+wRQudnPK45aHP9jwaUE+sGnjmXJUOOVeuAs0Lz/LcuU5cYJ4psdNACXFwrDuw
+hDG8CK05SDw4t6CsiigJL1DQKVMxnoSD6HKpBeKh0KIGnYe4w1FKQCz4yiZBInu9rULQPP5Ls70MvbGi
+swVX7RXM+S9RtlRfnk0/DidNe79qOxfWUwDnuaAj4URwwGsTo3rQuBuTscp7y6yoNSya8SPEHVWkoENQ
+hWc1IJRfjW8H1WdVjnbScChurbLNa/683w/fBX/r8AaGVVYlIv8AQ+/FCFI0IS6Kda8mPwDlVZiW7Alt
+t2YpyTnT39bnZV6QyGBMb/wcpKRK2TFlRvbqPi1A4pqmJSbkyoL4CUlpKUL9dBWrDU9deHoYqMRZL72/
+LdaG8b1Lv2xrvU/OtUNsUJzlTX/WAxuLCN86Ut2NosS35/GX+QEcdC51dAMAAA==
+`,
+	},
+
+	"/templates/client/details.html": {
+		local: "templates/client/details.html", size: 1502, modtime: 1792313633,
+		compressed: `
+H4sIAAAAAAAC/5VUTW/cIBC9+1egzSWVkvrUG/WlUatIbdQ0Sq8WNpM1EoYN4JW2Fv+9A9hrnHUV9YLx
+480wH28YxysL5gjG+4JySVrJrP284/K200b80coxuasKQih31f1PWuKHcl6Nozh4T6jtmZT498J6IU/e
+0zIhSOSz2fPz/V1mOAyCB+JCeGA92IxxpQLg/Th+RGJjEConKDf7ZvRwWNntIzIZErSagdzsNxgrtMrs
+jglZ054cc0Pu3UZgTXocwIhV7E5jxerXhOcVWiArVAvEdUCw2I4YQM/GbVXuVzrK/U/scxy4yqrA3Dtm
+6+mwhiOoQClo9ylzgj8FdayRMPc5/cT1ttWKg7LAd4HVaH6Kfi99OhMIMVnRQ30IoTieMGoPTM3eJWsA
+1ROCZjbVNxxXS1E4OCZkLpvoqAxXYPsu7y6nwHATgo6szczHIGyb2hrL8EUrBa2LnY+FeE/tT8l8JYEJ
+8v6GtMkfcNTZeV8vFVm6+D10eaJkzkLz6wneNOHC/sNqOalXU5jhWckvZPUD02D7lWz7CUJv1+PYnFzc
+xu+HG4JVNSfMk+EXWbVQDh8N1PmbsO+g1RwIGKNN7p1HvE74W+WW6z591YPiePP/ybUDFhVoQigYDMoI
+G/4i9oNhqeeOL0c4EloesXXhVdk+ypWI6+z/PBZWD6aF1TzQkGQV1YAXhzQjsLQn2VyoPY5SiCQfpDjp
+MZJswOa5yC7fGojzi/4Xn2ymwN4FAAA=
+`,
+	},
+
+	"/templates/client/discovery.html": {
+		local: "templates/client/discovery.html", size: 792, modtime: 1792312144,
+		compressed: `
+H4sIAAAAAAAC/31SwW6DMAy98xURvWzSWn6A5bbb1Mt2LgokbVEpQY7pVln59zkB1mabxsE4L++ZZ2Oi
+nbMjNMZ5n5WD3FrhDFwMONHYft8eRjB6UxaDzIiKG5VodVSuSrSvyqGAsRdEHacVp9Xg/ZNAa08M6hEU
+tjaCU8kSVd0Z0TDdPefTIcY1f1yb3hmdB9bRKB3eIDPBT4lavvQI17Lg7Bt6V3Aw6FIwmlKI5jzgHzdu
+bNj/D80bKhxnjCPEuHiorb6GYazuekdYeiAC+1HFg/fRu5ZE0yi9n0tGDCe3KRjnNrsNYxKlO6uukw/p
+9B7LYsJ/aed+Aun+bmVPDLhB9YvRTtWmEzGuZ1Eu7YkLM4kVRVAQ7f4VtufBAqoec7lXbWe0iL0604zY
+XkwVQF4gbvIzLRzmZwAscPEa5Nwl0YIVC1DMSBDcqiWaTcK/kbL7H5gsL0PTX+QkbFu8Ttf5CzK6Y+8Y
+AwAA
+`,
+	},
+
+	"/templates/client/restarts.html": {
+		local: "templates/client/restarts.html", size: 460, modtime: 1792313633,
+		compressed: `
+H4sIAAAAAAAC/21R227DIAx9z1eg9HnLD1A+YdIuz62c4qmRCGQ2m1RZ/Psc0rTNNB6MfXx8OSByIOQM
+lLmUxk7uJZkVMIwYn203uUake6CJ7M7Ax8fCDH1AcwrAvG+XoNqnU4oeI6NvnbLOCH6+yTVGj83efQwj
+2k6dG/KO9IO0xd4QOMUt9vqNNCCbHj8TXXuopWrXSX3yl3n/3WbbmaN0kazTj1Mp1+qKRRixFGN5hBA0
+Hmp+ie48yxPEVXGAHkOrXKp7Vr6m3b2JxwxD+K+RyNci5LZF1bB9csUWJerM71rzfz7hF9DWmCbMAQAA
+`,
+	},
+
+	"/templates/client/serials.html": {
+		local: "templates/client/serials.html", size: 1200, modtime: 1792311427,
+		compressed: `
+H4sIAAAAAAAC/61Uy27DIBC85yuQfU6dVj1VDqeqUi9VpN5jEdjEqC62ADd1Ef9ewMGx+0hSqRe8u4wH
+ZmdtY9YftQBl7Sxv8FONQoZoLbZ810pgiAukS/AVxZUGQTtES6Av6irPGjwzJosExqQDV3mLZwgZ4wvW
+IgWSk8rlfeAQfjNtZN2QHdHArM1VQwSiFVFqmVRkAxUK61y1lIJSCT6i88yDsTt7zBA41xdx7okUXOyO
+nC75hTTPvJZck00FkapPwjp3jWEgFLDEo0ogzD+ll49QrhlSuqtgmew50+Udur5ZNO8Jfgb5BjLPNDsD
+fFydBC0im+vqJUAuKExw+B4q0vUlt8qwRhWbmnXe4lSF6wZntYxdMEbW+yIk1gb1zHVPkFfn+IEwVHgz
+zeMMjGttw3y/iy/QFKSspbXGDEE2ROshYl6Df/e4PVbkqiMB2UGWC7yBQV9JVEFLInb99P6b2X+054FL
+pd3HAuKCyYjgb4OEV3Goa3HO2LFoecqgrT+t8Ff76lHc8feY7rBWhkuM3oh+jM79wY9s6sfoH/MJ69q+
+5rAEAAA=
+`,
+	},
+
 	"/templates/client/server.html": {
-		local: "templates/client/server.html", size: 556, modtime: 1441705443,
+		local: "templates/client/server.html", size: 1443, modtime: 1792314652,
 		compressed: `
-H4sIAAAJbogA/1RSTW/kIAw9b35FxEqr7aGlVVWpmhJO/R8Rk9CZqAQoOJUqi/9eO0zmI4dgHs/PzwYF
-STeIf7NN3zaV0igYtcrR+DbDj7Od2Jvh85DC4sf7IbiQdumw/4+4xqXcCf3P73N8U5KTdFtzk3WdgBAc
-TFG0MAErURlvZptLQeSglBZRniChN/CkpCQ5aVY/lPhuwHDeELy3A0zB99PIgKwnV+zqYHAm505Qed0o
-0x6T/ejEESDupEScYim718eXZ5nBwJK5OmNKGqKftTYVxK+Y+3XDTpuWPjJFIFtYF0l/crPGVwq6+VOJ
-T/OJysGFzLvmplW6hkztbS3VjmbjHI+BL6IWfajT2wAa2sq5JCEuEabZ9vFaCpGagH6JowF7e1AncR4l
-iV8eheRn8hsAAP///MEK9CwCAAA=
+H4sIAAAAAAAC/31U247jIAx93nwFotJeHrrRvnbT/EpEAm3REGDA7ahC/PsaSJq0M9k+UHBsn2P7QAOu
+rULYeeFuwsVYNcDbxlumiYe7Ekfas+Ht7MxV8/1glHEHd+5/hpD3Mf6i7Xfde/u3qVNQS0qsE+pIwRgF
+0lICElImhNFsFD7GENImRhJCPZloOxunTE2NTKrMBwMZ5054X4IHo7UYQBrdSY4BvUOXeuWyGVvYDYp5
+f6RIra0aRi5OnI70AmAPdR2CtDEeQrDGQYy1BwZXn9gle1Oz3K4TG6W6d4r1Qr1kzTYsbHLJVixvacL0
+IZ9L3S/ZSv1Y0bO9mhvzqdxqqXdmEcK79Q/wtiL4Q95oTA3MfzWumCfvVxna6ltx/DNOrmmzOKdT9dRg
+FI7HWcxtLwoamVKp+Uk6BfR3mfdswGqyzxIUwtWCHEVn16lCwCKgu1rOQDx/2JxsCGi2RnvR5YSfh8C1
+78poywjwvChvQ09fSXFnJWqRf6mBvO6lPpkH8JuwQMRNaPJxwYVLPxhs351wI7z+AeQkNScSaFvyzrcK
+6cxACVNoLvW5c2I0N6b+Bz4mGTMNDwbaIEi6zaS/E7gIkrqL+UeJJfEuX3SsbEXNXTXqP2Mh6JrRK430
+jgBLqt4k9MGcxpgnOhfBHCcnZ0bipR5EpjUaLcE4fEkwpQPBaZtzr/AnrIIKYvs2ruZePFd37zn0Kfli
+L25JK+TxXuzojMEFMKk8JahQtpc24aTHgs7XYHJYFM82NVYl6MdbXKfX+R+5sYEWowUAAA==
 `,
 	},
 
@@ -316,29 +453,35 @@ CwuKa2sVCktTizJTixUKUosUilOT8/NSbPRB+u24qqv1EeYCAgAA//+eRmtkZQAAAA==
 	},
 
 	"/templates/index.html": {
-		local: "templates/index.html", size: 3692, modtime: 1441705316,
+		local: "templates/index.html", size: 5263, modtime: 1792313633,
 		compressed: `
-H4sIAAAJbogA/6RXbW/bthN/309x1f9dUUlx+pA2lf3m36It0GHd2g0YimKgxbPEhCJZknLqDdtn35GU
-LaV2EwcNYIcPv/vd8Xh3PFf3X/78/49/vH8Fre/k4l4V/oFkqplnqLLFPYCqRcbDgIYdegZ1y6xDP896
-v8qfZcOWF17iokHNlYNOK+G1rcq0OhFWrMN5thZ4ZbT1GdRaeVREdiW4b+cc16LGPE4egiAWwWTuaiZx
-PitOsn0qjq62wnih1YTtAJD1vtX2OiaB7uc5vENwfiPRQZ4PslKoS2gtruZZ6705L0vnCyO6plDoy5qr
-UoqlK5dae+ctM+VpWbvJvOiEKmglA4tyniX6FtFvjYsraQyw1HwDfw8TAMM4F6rJvTbn8PTEfH0B5YM4
-AK+hY5cIvsV4GCYUWmg0MCnj4hXbBFAYLrX3ugO9ijMiWzILD8pBzT/JjnJiyA+fOrfojFZOrPEmB+wp
-IzXMizqSUQjdLDfc2JuPP717Aq4V3UNYaQtvXz3Nn4HrTYitcOgEQIkd3fjkakn+k1iB9CQCzz9v76BK
-oQTO1mRQGXLhSWAvGq0bibXmWNS6K91ald726jJBiguXLciLUXir4RMqLlafg8prNq/YGpjidBd93YKg
-C/w25NKhKVZ93fuIyAYfiY416EqiCKsFfWV7gswYiXlkzw/IfrtdGNUcQ+LEX+jm2dnp17PTWyjzCLoj
-8Wz2+Ct9bqMeYDvyqkzVKQxDBg0KuVhDLZkj4iuKSYN2FzphS/B51lHaZFvQLo0CrOrldl3RZdEn92zp
-kj4pFhUbjPxfqzvMgDPPyMaGImSeETJbvKH1qmQUEwTfk2rIovaQ2Ouw8X05t3EeO3dI8kPa+r4sx2Xf
-HJJ8GTZGuars6RUgH0w8SLh8KJrZvn/DrmEKgdWecj6Lzo2OGTw+8bnru47ZTUgWWhr3iUPihJAm8Tuo
-5agc8mFOFUYY5EmJQ7tG67Jd9vrxpQozu9hV0zDlqcAPL805nFEtJc9FEnqo+M3opxH99uXtyNlpgr6/
-HfosIn/p0Qp0x8L/nVFZhS/mCIF0xN/JSfQ6Hsv/2ur+GPKE/hWpbluP/FhrfjMUhMfAZycRPwXS2E7G
-1687pf+4O5aDOA3xs60Bk+g7FMopvFKajjZWZmvgipIhD3Xr3HX05r6AtBA2z4VnUtRDLjtgFoGjZBsK
-4eUGNOWJwxDVRVWaCXfN1Jq5Ue+HIbYhtUXZ85MTKo0ompYal8c0Ib8kmRtIPmoy5jDFbJ9i65Vb3LKt
-QqPeofhQt0ZvcMdCJ1bcwc+pNO1uypDHoh5qB3r3J+87M+p6p1noioqi2F0s4Q/ZHyfp0S3HJim+xtff
-4wtGHogvd1ye3/nvWlcB7yWr6a6Zjw0X9QDb3ovrug9dCLjUmZnwwIGkA1FLQA60I8+0C7mpB7v4QpVj
-U86Ks2I2TGLLdaAdOZZy2tZdfNvL/gBvT3XculpbJHMfkbnjQr5PHT15J7NZfbmk5CLy50S+ne5T393J
-rW6YKh8VJ8VpGh/jiqGXJQ9SZhhJBc/9iPdcR/fQCjrebnjAazdYUWup7a0mjPhYPo6Hh379Oji2ZqkC
-V2X6aXnvvwAAAP//MdPKeWwOAAA=
+H4sIAAAAAAAC/6VY62/bNhD/3r/iqgH7UFRSnLRNm8gGhqZoC3Rrt2QDhqIIaImWmEikSlJ23WH723d8
+6OFacZwkQBI+7n68F493Sh6ffXx98fenN1Doqpw9Ssw/KAnPpwHlwewRQFJQkpkBDiuqCaQFkYrqadDo
+Rfgy8Fua6ZLOcioyrqASnGkhk9itDpg5qeg0WDK6qoXUAaSCa8oRbMUyXUwzumQpDe3kKTBEYaQMVUpK
+Op1EB8E2VEZVKlmtmeADtBFC0uhCyE0aR/Q4DOEDBaXXJVUQhp63ZPwaCkkX06DQuj6JY6WjmlV5xKmO
+04zHJZureC6EVlqSOj6MUzWYRxXjEa4EIGk5DRx8QaluhbMrbgwwF9ka/vETgJpkGeN5qEV9Ai8O6m+n
+ED+xA9ACKnJNQRfUKkMYpxJyAaQs7eKKrA2RGc6F1qICsbAzBJsTCU9if8y/To54IMiDtQ4lVbXgii3p
+LgNsHYbHEM1SC4YhtJvPe+zdxa8fnoMqWPUUFkLC+zcvwpegmtrEllHaEdCSVujxgWuR/zNbQKmRBV59
+aX2QuFACJVMUKDZ34blBj3Ih8pKmIqNRKqpYLXmsZcOvHUl0pYIZWtEytyd8pjxjiy/myA2ZF2QJhGfo
+iyYtgKEDfww5pzTGqk4bbSkCbyNWkZyqGCHMaoR/gi1GUtclDS16OML743ZU83wfEMW+UzUNjg+/HR/e
+AhlaojsCTybPvuHvbdCerANPYpedzNDcIH9gxpaQlkQh8ApjsqayCx2zxbJpUOG1CVqi7hoZsqQp23WO
+zsLfUJO5cueVbJYQL+RPhahoABnRBGXMMUKmAVIGs3e4nsQEYwLJt7hylKgYY3trNm7mM6HCFOaudD3G
+/brfvhlDUYkJVY3xn7utm3kzplKxpHL09LN282Z+TAyaSD16+B9+b4fka9StGpfcbe2QnM6bfFRqs9Hz
+JXGDbyBGwCB+kC70T0awHV1mtyacAkk1ZrzAhpYNCx9vg4hTTVURtB4ehkv9PmKUdACIE/vXHJtRrmjm
+55hfWU0zdwh6Es2tgi536f6dNjM5694SM83c8+bf2RM4xpfE+hxB8JnOdlO/sNTvz26nnBw60k+3k760
+lL83GHdU7Uv+3wQfFfha78HgVPwLjYS1wb74b6Vo6r2l8WFLs32l+bPGINyf/Oy38z1MfmBph4Q4loPx
+ZmS4PNnv9nnTTk2otclyEKhjUe8i0eWzXsakbgVc4L0JTYI/URUWJ6fgFszmCdOkZKlPegqIpJDRkqwx
+2udrEHilFDUXIErieoCdEr4kqj/33F8DcPVj8OrgAN8QyvICK7xnOEG7OJ4dIBcChRmHmGxDtFa5xSzD
+dH1f41xg0aaweoWv7pagTbg2tR01qRZcDji1tV0llMZysMLSG+sLtcKSkCkojQQZLJjEKm7Tkm1aGsh5
+mRY0vcac8kEQU31GUeSV3T8a2hfmviqff/wFPAYsJNauvsxtZQQno1PaRozRsxArKAXPgSw0am72rM7e
+REAJFlt+nAttCdwpN1jlO0bgZafLA+zRv5r3tcg71M3Ii+gaOjjA+hNWJhxM5Wv1wwmuY3o01J/9A/HF
+GG/B8kYS0yPdoG4He6lEI1P6MJ27l/6+KrflgK2UTeyj20XDjWsRm2pzEShvVTWdQ6OgsblVPQVOV8i/
+M+i9hJd4j7h+YMD7wqQ/xdcjKB66pnJmv0vE2Gqly8g1ZkZ7jtXyMmuquj+rl7tL4Eg/lqfsxHUhcd81
+9u3JQJxKZKSEgmWdQEg9uNJbtKF5YGzx3Bl63mDjie5Z1+hyN+mr7VKotm7GwKtYBxTMftasouo0iR3P
+ALE4Ggpzab8smNRcHPWPV+e6MSHNO7eh0KVdmY14fLNluyKY+21zZ5end/7ZaDzhU0lSzMnEZSFsE9v2
+PBNpYxpVUK55r00PhGmNYALHu+/dtdWo7mrTr+zliSfRcTTxE9uVj3Ss+0IOO/+rHz93PAC3wWJXYhaS
+FMU9QnH7hXAb2lryTmKT9HqOSR3BXyF4O92GvruRC5ETHh9FB9GhG+9jCv+5Ay2IuaIuTeZ6iPVUhX4o
+GKrXDcM7SZGKUki1P70tnPYnN590Nolt9+5qzyR2Xx8f/Q+7+Tl0jxQAAA==
 `,
 	},
 
@@ -4,37 +4,210 @@
 
     var current_popover;
 
-    var update = function() {
-        $.getJSON('/api/status', function(status) {
-            //console.log("c", status);
-            var servers = status.servers;
-            // _.filter(status.servers, function(s) { return s.status.match("1.40") })
-
-            graph.generateColors(Object.keys(servers).length);
-
-            $('#servers span[rel=tooltip]').tooltip('hide');
-            $('#servers tbody').html("");
-            _.each( _.sortBy(servers, function(s) {
-                if (s.name === "") { return "zzzzzzz" }
-                return s.name
-            }), function(s) {
-                graph.record(s.name, s.qps);
-                s.names = _.map(s.names, function(n) { return { name: n } });
-                s.color = graph.getColor(s.name);
-                s.qps_class = s.qps && s.qps > 150 ? "high-query-rate" : "";
-                s.qps1m = s.qps1m.toPrecision(4);
-                s.response_time_class = (s.response_time && s.response_time > 400) ? "slow-response" : "";
-                var template = templates.server.render({ server: s });
-                $('#servers').append(template);
+    var render = function(status) {
+        //console.log("c", status);
+        var servers = status.servers;
+        // _.filter(status.servers, function(s) { return s.status.match("1.40") })
+
+        graph.generateColors(Object.keys(servers).length);
+
+        $('#servers span[rel=tooltip]').tooltip('hide');
+        $('#servers tbody').html("");
+        // servers reachable over both IPv4 and IPv6 report the same
+        // uuid and are shown as one, like the "logical" servers of
+        // /api/status
+        var logical = _.groupBy(_.values(servers), function(s) {
+            return s.uuid || "ip:" + s.ip;
+        });
+        var groupName = function(group) {
+            return _.find(_.pluck(group, "name"), _.identity) || "";
+        };
+
+        _.each( _.sortBy(_.values(logical), function(group) {
+            return groupName(group) || "zzzzzzz";
+        }), function(group) {
+            group = _.sortBy(group, function(s) { return s.family + " " + s.ip });
+            var families = _.groupBy(group, function(s) { return s.family });
+            var dual = _.size(families) > 1;
+            var primary = _.find(group, function(s) { return s.status === "Ok" }) || group[0];
+
+            var s = _.clone(primary);
+            s.name = groupName(group);
+            graph.record(s.name, s.qps);
+            s.names = _.map(_.uniq(_.compact(_.flatten(_.pluck(group, "names")))), function(n) { return { name: n } });
+            s.color = graph.getColor(s.name);
+            s.qps_class = s.qps && s.qps > 150 ? "high-query-rate" : "";
+            s.qps1m = s.qps1m.toPrecision(4);
+            s.addresses = _.map(group, function(a) {
+                return {
+                    ip: a.ip,
+                    port: a.port,
+                    connection_id: a.Data ? a.Data.connection_id : "",
+                    family_label: a.family === "ipv6" ? "v6" : dual ? "v4" : "",
+                    family_class: dual ? "label-info" : "",
+                    family_title: dual ? "dual-stack server" : "",
+                    response_time_class: (a.response_time && a.response_time > 400) ||
+                        (a.dns_status && a.dns_status !== "ok") ? "slow-response" : "",
+                    dns_status: a.dns_status || "",
+                    dns: a.response_time ? a.response_time + "ms" :
+                        (a.dns_status && a.dns_status !== "ok") ? "failed" : "",
+                    pinned: !!a.pinned,
+                    pending_removal: !!a.pending_removal,
+                    missed_rounds: a.missed_rounds || 0,
+                    stale: !!a.stale,
+                    state_label: a.state && a.state !== "streaming" ? a.state : "",
+                    state_title: a.next_retry ? "retrying at " + new Date(a.next_retry).toLocaleTimeString() : "",
+                    status: a.status || ""
+                };
+            });
+            var template = templates.server.render({ server: s });
+            $('#servers').append(template);
+        });
+
+        // graph.record("summary", status.summary.qps);
+        // $('#summary').html( templates.summary.render( status ) );
+
+        $('#servers span[rel=tooltip]').tooltip({trigger: "hover", placement: "right"});
+
+        var str = JSON.stringify(status, undefined, 2);
+        $('#status_dump').html(str);
+    };
+
+    // Poll /api/status, after the first time only for the servers
+    // that changed since the last generation we've seen.
+    var update = (function() {
+        var status = { servers: {} },
+            generation;
+        return function() {
+            var url = '/api/status';
+            if (generation !== undefined) { url += '?since=' + generation }
+            $.getJSON(url, function(data) {
+                if (generation === undefined || data.full) { status.servers = {} }
+                _.each(data.servers, function(s, ip) { status.servers[ip] = s });
+                _.each(data.removed, function(ip) { delete status.servers[ip] });
+                generation = data.generation;
+                render(status);
             });
+        };
+    })();
 
-            // graph.record("summary", status.summary.qps);
-            // $('#summary').html( templates.summary.render( status ) );
+    // Follow /api/stream when the browser supports it; the table is
+    // still redrawn on a timer so the graph gets a point per second.
+    var stream = function() {
+        var status = { servers: {} },
+            source = new EventSource('/api/stream');
 
-            $('#servers span[rel=tooltip]').tooltip({trigger: "hover", placement: "right"});
+        source.onmessage = function(e) {
+            var ev = JSON.parse(e.data);
+            switch (ev.type) {
+            case "snapshot":
+                status.servers = ev.servers || {};
+                break;
+            case "update":
+                status.servers[ev.server.ip] = ev.server;
+                break;
+            case "remove":
+                delete status.servers[ev.ip];
+                break;
+            }
+        };
 
-            var str = JSON.stringify(status, undefined, 2);
-            $('#status_dump').html(str);
+        render(status);
+        window.setInterval(function() { render(status) }, 1100);
+    };
+
+    var renderConsistency = function(report) {
+        var checks = _.map(report.checks, function(check) {
+            check = _.clone(check);
+            check.group_list = _.map(_.keys(check.groups).sort(), function(g) {
+                return { group: g, label_class: check.groups[g] ? "" : "label-important" };
+            });
+            check.variants = _.map(check.variants, function(v, i) {
+                v = _.clone(v);
+                v.row_class = v.error ? "warning" : i > 0 ? "error" : "";
+                v.servers = _.map(v.servers, function(s) {
+                    return { ip: s.ip, name: s.name || s.ip };
+                });
+                return v;
+            });
+            return check;
+        });
+        $('#consistency_checks').html(templates.consistency.render({ checks: checks }));
+    };
+
+    var updateConsistency = function() {
+        $.getJSON('/api/consistency', renderConsistency)
+            .fail(function() { $('#consistency_checks').html("Consistency checks are not enabled.") });
+    };
+
+    var seconds = function(s) {
+        if (s < 60) { return Math.round(s) + "s" }
+        return Math.floor(s / 60) + "m" + Math.round(s % 60) + "s";
+    };
+
+    var renderSerials = function(data) {
+        var zones = _.map(data.zones, function(zone) {
+            zone = _.clone(zone);
+            zone.servers = _.map(zone.servers, function(srv) {
+                srv = _.clone(srv);
+                srv.name = srv.name || srv.ip;
+                srv.row_class = srv.error ? "warning" : srv.current ? "" : "error";
+                srv.updated_p = new Date(srv.updated).toLocaleTimeString();
+                srv.delay_p = srv.current ? seconds(srv.delay) : "";
+                return srv;
+            });
+            zone.has_changes = zone.changes.length > 0;
+            zone.changes = _.map(zone.changes, function(change) {
+                change = _.clone(change);
+                change.first_seen_p = new Date(change.first_seen).toLocaleString();
+                change.duration_p = change.propagated ? seconds(change.duration) : "in progress";
+                return change;
+            });
+            return zone;
+        });
+        $('#zone_serials').html(templates.serials.render({ zones: zones }));
+    };
+
+    var updateSerials = function() {
+        $.getJSON('/api/serials', renderSerials);
+    };
+
+    var renderDiscovery = function(data) {
+        var sources = _.map(data.sources, function(src) {
+            src = _.clone(src);
+            src.row_class = src.ok ? "" : "error";
+            src.last_attempt_p = new Date(src.last_attempt).toLocaleTimeString();
+            src.duration_p = seconds(src.duration);
+            src.last_success_p = src.last_success.indexOf("0001-") === 0 ? "never" : new Date(src.last_success).toLocaleString();
+            return src;
+        });
+        $('#discovery_sources').html(templates.discovery.render({
+            sources: sources,
+            has_sources: sources.length > 0,
+            last_run_p: new Date(data.last_run).toLocaleString(),
+            duration_p: seconds(data.duration)
+        }));
+    };
+
+    var updateDiscovery = function() {
+        $.getJSON('/api/discovery', renderDiscovery);
+    };
+
+    var restartEvents = function(events) {
+        return _.map(events, function(ev) {
+            ev = _.clone(ev);
+            ev.time_p = new Date(ev.time).toLocaleString();
+            return ev;
+        });
+    };
+
+    var updateRestarts = function() {
+        $.getJSON('/api/restarts', function(data) {
+            var restarts = restartEvents(data.restarts);
+            $('#restart_events').html(templates.restarts.render({
+                restarts: restarts,
+                has_restarts: restarts.length > 0
+            }));
         });
     };
 
@@ -42,6 +215,34 @@
     //     $('#status_dump').toggle();
     // });
 
+    $('#servers').on('click', "a.details", function(e) {
+        e.preventDefault();
+        var ip = $(this).data("ip");
+        $.getJSON('/api/servers/' + ip, function(s) {
+            s = _.clone(s);
+            s.sources = _.map(s.sources, function(src) {
+                src = _.clone(src);
+                src.resolved_p = new Date(src.resolved).toLocaleString();
+                return src;
+            });
+            var when = function(t) {
+                return t.indexOf("0001-") === 0 ? "never" : new Date(t).toLocaleString();
+            };
+            s.session = _.clone(s.session);
+            s.session.connected_time_p = Math.round(s.session.connected_time) + "s";
+            s.session.last_connect_p = when(s.session.last_connect);
+            s.session.last_disconnect_p = when(s.session.last_disconnect);
+            s.session.average_interval_p = s.session.average_interval.toFixed(1) + "s";
+            $('#details_title').text(s.name || s.ip);
+            $.getJSON('/api/servers/' + ip + '/restarts', function(data) {
+                s.restart_events = restartEvents(data.events);
+                s.has_restart_events = s.restart_events.length > 0;
+                $('#details_body').html(templates.details.render({ server: s }));
+                $('#details').modal('show');
+            });
+        });
+    });
+
     $('#servers').on('click', "a.ip", function(e) {
         e.preventDefault();
         var ip = $(this).text();
@@ -73,6 +274,19 @@
       })
 
 
-    update();
-    window.setInterval(update, 1100);
+    updateConsistency();
+    window.setInterval(updateConsistency, 10000);
+    updateSerials();
+    window.setInterval(updateSerials, 10000);
+    updateDiscovery();
+    window.setInterval(updateDiscovery, 10000);
+    updateRestarts();
+    window.setInterval(updateRestarts, 10000);
+
+    if (window.EventSource) {
+        stream();
+    } else {
+        update();
+        window.setInterval(update, 1100);
+    }
 })(jQuery);
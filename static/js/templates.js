@@ -1,3 +1,8 @@
 if (!!!templates) var templates = {};
-templates["server"] = new Hogan.Template({code: function (c,p,i) { var t=this;t.b(i=i||"");t.b("<tr>");t.b("\n" + i);if(t.s(t.f("server",c,p,1),c,p,0,16,538,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<td><span style=\"background-color:rgb(");t.b(t.v(t.f("color",c,p,0)));t.b(")\">&nbsp;</span> <span rel=\"tooltip\" title=\"");if(t.s(t.f("names",c,p,1),c,p,0,118,127,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.f("name",c,p,0)));t.b(" ");});c.pop();}t.b("\">");t.b(t.v(t.f("name",c,p,0)));t.b("</span></td>");t.b("\n");t.b("\n" + i);t.b("<td>");if(t.s(t.f("Data",c,p,1),c,p,0,174,191,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.f("connection_id",c,p,0)));});c.pop();}t.b("</td>");t.b("\n");t.b("\n" + i);t.b("<td><span class=\"ip\">");t.b("\n" + i);t.b("<a href=\"http://");t.b(t.v(t.f("ip",c,p,0)));t.b(":8053/status\">");t.b(t.v(t.f("ip",c,p,0)));t.b("</a>");t.b("\n" + i);t.b("</td>");t.b("\n");t.b("\n" + i);t.b("<td class=\"");t.b(t.v(t.f("qps_class",c,p,0)));t.b("\">");t.b("\n" + i);t.b("    ");if(t.s(t.f("qps",c,p,1),c,p,0,322,333,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.f("qps",c,p,0)));t.b("/qps");});c.pop();}t.b("\n" + i);t.b("</td>");t.b("\n");t.b("\n" + i);t.b("<td>");t.b("\n" + i);t.b("	");if(t.s(t.f("qps1m",c,p,1),c,p,0,365,378,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.f("qps1m",c,p,0)));t.b("/qps");});c.pop();}t.b("\n" + i);t.b("</td>");t.b("\n");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("version",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td><small>");if(t.s(t.f("groups",c,p,1),c,p,0,439,445,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.d(".",c,p,0)));t.b(" ");});c.pop();}t.b("</small></td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("uptime_p",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("last_update",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("status",c,p,0)));t.b("</td>");t.b("\n");t.b("\n" + i);});c.pop();}t.b("</tr>");return t.fl(); },partials: {}, subs: {  }});
+templates["consistency"] = new Hogan.Template({code: function (c,p,i) { var t=this;t.b(i=i||"");if(!t.s(t.f("checks",c,p,1),c,p,1,0,0,"")){t.b("<p>No consistency checks configured.</p>");t.b("\n" + i);};if(t.s(t.f("checks",c,p,1),c,p,0,76,872,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<h4>");t.b("\n" + i);t.b("  ");t.b(t.v(t.f("name",c,p,0)));t.b(" ");t.b(t.v(t.f("type",c,p,0)));if(t.s(t.f("subnet",c,p,1),c,p,0,112,142,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(" <small>ecs=");t.b(t.v(t.f("subnet",c,p,0)));t.b("</small>");});c.pop();}t.b("\n" + i);t.b("  ");if(t.s(t.f("consistent",c,p,1),c,p,0,171,222,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"label label-success\">consistent</span>");});c.pop();}t.b("\n" + i);t.b("  ");if(!t.s(t.f("consistent",c,p,1),c,p,1,0,0,"")){t.b("<span class=\"label label-important\">divergent</span>");};t.b("\n" + i);t.b("  <small>");if(t.s(t.f("group_list",c,p,1),c,p,0,347,400,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"label ");t.b(t.v(t.f("label_class",c,p,0)));t.b("\">");t.b(t.v(t.f("group",c,p,0)));t.b("</span> ");});c.pop();}t.b("</small>");t.b("\n" + i);t.b("</h4>");t.b("\n" + i);t.b("<table class=\"table table-condensed\">");t.b("\n" + i);t.b("<thead>");t.b("\n" + i);t.b("<tr>");t.b("\n" + i);t.b("    <td style=\"width: 300px\">Answer</td>");t.b("\n" + i);t.b("    <td>Servers</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);t.b("</thead>");t.b("\n" + i);t.b("<tbody>");t.b("\n" + i);if(t.s(t.f("variants",c,p,1),c,p,0,579,840,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<tr class=\"");t.b(t.v(t.f("row_class",c,p,0)));t.b("\">");t.b("\n" + i);t.b("<td>");if(t.s(t.f("error",c,p,1),c,p,0,621,630,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.f("error",c,p,0)));});c.pop();}if(!t.s(t.f("error",c,p,1),c,p,1,0,0,"")){t.b(t.v(t.f("rcode",c,p,0)));if(t.s(t.f("serial",c,p,1),c,p,0,670,688,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(" serial ");t.b(t.v(t.f("serial",c,p,0)));});c.pop();}if(t.s(t.f("answers",c,p,1),c,p,0,711,735,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<br><small>");t.b(t.v(t.d(".",c,p,0)));t.b("</small>");});c.pop();}};t.b("</td>");t.b("\n" + i);t.b("<td>");if(t.s(t.f("servers",c,p,1),c,p,0,779,816,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span title=\"");t.b(t.v(t.f("ip",c,p,0)));t.b("\">");t.b(t.v(t.f("name",c,p,0)));t.b("</span> ");});c.pop();}t.b("</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);});c.pop();}t.b("</tbody>");t.b("\n" + i);t.b("</table>");t.b("\n" + i);});c.pop();}return t.fl(); },partials: {}, subs: {  }});
+templates["details"] = new Hogan.Template({code: function (c,p,i) { var t=this;t.b(i=i||"");if(t.s(t.f("server",c,p,1),c,p,0,11,1490,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<dl class=\"dl-horizontal\">");t.b("\n" + i);t.b("  <dt>IP</dt><dd>");t.b(t.v(t.f("ip",c,p,0)));t.b(" <small>");t.b(t.v(t.f("family",c,p,0)));t.b("</small></dd>");t.b("\n" + i);t.b("  <dt>UUID</dt><dd>");t.b(t.v(t.f("uuid",c,p,0)));t.b("</dd>");t.b("\n" + i);t.b("  <dt>Names</dt><dd>");if(t.s(t.f("names",c,p,1),c,p,0,157,166,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.d(".",c,p,0)));t.b("<br>");});c.pop();}t.b("</dd>");t.b("\n" + i);t.b("  <dt>Groups</dt><dd>");if(t.s(t.f("groups",c,p,1),c,p,0,214,220,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.d(".",c,p,0)));t.b(" ");});c.pop();}t.b("</dd>");t.b("\n" + i);t.b("  <dt>Version</dt><dd>");t.b(t.v(t.f("version",c,p,0)));t.b("</dd>");t.b("\n" + i);t.b("  <dt>Status</dt><dd>");t.b(t.v(t.f("status",c,p,0)));t.b("</dd>");t.b("\n" + i);t.b("  <dt>Queries</dt><dd>");t.b(t.v(t.f("total_queries",c,p,0)));t.b(" <small>");t.b(t.v(t.f("queries",c,p,0)));t.b(" since the last restart</small></dd>");t.b("\n" + i);t.b("  <dt>Restarts</dt><dd>");t.b(t.v(t.f("restarts",c,p,0)));t.b("</dd>");t.b("\n" + i);t.b("</dl>");t.b("\n" + i);if(t.s(t.f("has_restart_events",c,p,1),c,p,0,478,705,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<h5>Restarts</h5>");t.b("\n" + i);t.b("<table class=\"table table-condensed\">");t.b("\n" + i);t.b("<tbody>");t.b("\n" + i);if(t.s(t.f("restart_events",c,p,1),c,p,0,562,667,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<tr>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("time_p",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td><span class=\"label\">");t.b(t.v(t.f("reason",c,p,0)));t.b("</span> <small>");t.b(t.v(t.f("detail",c,p,0)));t.b("</small></td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);});c.pop();}t.b("</tbody>");t.b("\n" + i);t.b("</table>");t.b("\n" + i);});c.pop();}if(t.s(t.f("session",c,p,1),c,p,0,741,1153,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<h5>Connection</h5>");t.b("\n" + i);t.b("<dl class=\"dl-horizontal\">");t.b("\n" + i);t.b("  <dt>Sessions</dt><dd>");t.b(t.v(t.f("sessions",c,p,0)));t.b(", connected ");t.b(t.v(t.f("connected_time_p",c,p,0)));t.b("</dd>");t.b("\n" + i);t.b("  <dt>Last connect</dt><dd>");t.b(t.v(t.f("last_connect_p",c,p,0)));t.b("</dd>");t.b("\n" + i);t.b("  <dt>Last disconnect</dt><dd>");t.b(t.v(t.f("last_disconnect_p",c,p,0)));t.b(" <small>");t.b(t.v(t.f("disconnect_reason",c,p,0)));t.b("</small></dd>");t.b("\n" + i);t.b("  <dt>Messages</dt><dd>");t.b(t.v(t.f("messages",c,p,0)));t.b(" (");t.b(t.v(t.f("bytes",c,p,0)));t.b(" bytes), every ");t.b(t.v(t.f("average_interval_p",c,p,0)));t.b("</dd>");t.b("\n" + i);t.b("  <dt>Decode errors</dt><dd>");t.b(t.v(t.f("decode_errors",c,p,0)));t.b("</dd>");t.b("\n" + i);t.b("</dl>");t.b("\n" + i);});c.pop();}t.b("<h5>Found by</h5>");t.b("\n" + i);t.b("<table class=\"table table-condensed\">");t.b("\n" + i);t.b("<thead>");t.b("\n" + i);t.b("<tr>");t.b("\n" + i);t.b("    <td>Configuration</td>");t.b("\n" + i);t.b("    <td>Resolved name</td>");t.b("\n" + i);t.b("    <td>Resolved</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);t.b("</thead>");t.b("\n" + i);t.b("<tbody>");t.b("\n" + i);if(t.s(t.f("sources",c,p,1),c,p,0,1346,1459,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<tr>");t.b("\n" + i);t.b("<td><code>");t.b(t.v(t.f("config",c,p,0)));t.b("</code> <small>");t.b(t.v(t.f("source",c,p,0)));t.b("</small></td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("name",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("resolved_p",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);});c.pop();}t.b("</tbody>");t.b("\n" + i);t.b("</table>");t.b("\n" + i);});c.pop();}return t.fl(); },partials: {}, subs: {  }});
+templates["discovery"] = new Hogan.Template({code: function (c,p,i) { var t=this;t.b(i=i||"");if(!t.s(t.f("sources",c,p,1),c,p,1,0,0,"")){t.b("<p>No servers configured.</p>");t.b("\n" + i);};if(t.s(t.f("has_sources",c,p,1),c,p,0,72,775,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<p>Last run ");t.b(t.v(t.f("last_run_p",c,p,0)));t.b(", took ");t.b(t.v(t.f("duration_p",c,p,0)));t.b(".</p>");t.b("\n" + i);t.b("<table class=\"table table-condensed\">");t.b("\n" + i);t.b("<thead>");t.b("\n" + i);t.b("<tr>");t.b("\n" + i);t.b("    <td>Entry</td>");t.b("\n" + i);t.b("    <td>Targets</td>");t.b("\n" + i);t.b("    <td>Last attempt</td>");t.b("\n" + i);t.b("    <td>Last success</td>");t.b("\n" + i);t.b("    <td>Status</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);t.b("</thead>");t.b("\n" + i);t.b("<tbody>");t.b("\n" + i);if(t.s(t.f("sources",c,p,1),c,p,0,324,744,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<tr class=\"");t.b(t.v(t.f("row_class",c,p,0)));t.b("\">");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("config",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("targets",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("last_attempt_p",c,p,0)));t.b(" <small>(");t.b(t.v(t.f("duration_p",c,p,0)));t.b(")</small></td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("last_success_p",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");if(t.s(t.f("ok",c,p,1),c,p,0,492,535,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"label label-success\">ok</span>");});c.pop();}if(!t.s(t.f("ok",c,p,1),c,p,1,0,0,"")){t.b("<span class=\"label label-important\">failed ");t.b(t.v(t.f("consecutive_failures",c,p,0)));t.b("x</span>");};t.b("\n" + i);if(t.s(t.f("error",c,p,1),c,p,0,642,670,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<br><small>");t.b(t.v(t.f("error",c,p,0)));t.b("</small>");});c.pop();}t.b("\n" + i);if(t.s(t.f("failures",c,p,1),c,p,0,694,718,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<br><small>");t.b(t.v(t.d(".",c,p,0)));t.b("</small>");});c.pop();}t.b("\n" + i);t.b("</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);});c.pop();}t.b("</tbody>");t.b("\n" + i);t.b("</table>");t.b("\n" + i);});c.pop();}return t.fl(); },partials: {}, subs: {  }});
+templates["restarts"] = new Hogan.Template({code: function (c,p,i) { var t=this;t.b(i=i||"");if(!t.s(t.f("restarts",c,p,1),c,p,1,0,0,"")){t.b("<p>No restarts seen.</p>");t.b("\n" + i);};if(t.s(t.f("has_restarts",c,p,1),c,p,0,70,442,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<table class=\"table table-condensed\">");t.b("\n" + i);t.b("<thead>");t.b("\n" + i);t.b("<tr>");t.b("\n" + i);t.b("    <td>Time</td>");t.b("\n" + i);t.b("    <td>Server</td>");t.b("\n" + i);t.b("    <td>Reason</td>");t.b("\n" + i);t.b("    <td>Queries before</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);t.b("</thead>");t.b("\n" + i);t.b("<tbody>");t.b("\n" + i);if(t.s(t.f("restarts",c,p,1),c,p,0,244,410,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<tr>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("time_p",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("name",c,p,0)));t.b(" <small>");t.b(t.v(t.f("ip",c,p,0)));t.b("</small></td>");t.b("\n" + i);t.b("<td><span class=\"label\">");t.b(t.v(t.f("reason",c,p,0)));t.b("</span> <small>");t.b(t.v(t.f("detail",c,p,0)));t.b("</small></td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("queries",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);});c.pop();}t.b("</tbody>");t.b("\n" + i);t.b("</table>");t.b("\n" + i);});c.pop();}return t.fl(); },partials: {}, subs: {  }});
+templates["serials"] = new Hogan.Template({code: function (c,p,i) { var t=this;t.b(i=i||"");if(!t.s(t.f("zones",c,p,1),c,p,1,0,0,"")){t.b("<p>No zones configured in the consistency checks.</p>");t.b("\n" + i);};if(t.s(t.f("zones",c,p,1),c,p,0,86,1189,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<h4>");t.b("\n" + i);t.b("  ");t.b(t.v(t.f("zone",c,p,0)));t.b(" serial ");t.b(t.v(t.f("serial",c,p,0)));t.b("\n" + i);t.b("  ");if(t.s(t.f("propagated",c,p,1),c,p,0,138,189,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"label label-success\">propagated</span>");});c.pop();}t.b("\n" + i);t.b("  ");if(!t.s(t.f("propagated",c,p,1),c,p,1,0,0,"")){t.b("<span class=\"label label-warning\">propagating</span>");};t.b("\n" + i);t.b("</h4>");t.b("\n" + i);t.b("<table class=\"table table-condensed\">");t.b("\n" + i);t.b("<thead>");t.b("\n" + i);t.b("<tr>");t.b("\n" + i);t.b("    <td style=\"width: 120px\">Server</td>");t.b("\n" + i);t.b("    <td style=\"width: 120px\">IP</td>");t.b("\n" + i);t.b("    <td style=\"width: 100px\">Serial</td>");t.b("\n" + i);t.b("    <td style=\"width: 100px\">Since</td>");t.b("\n" + i);t.b("    <td>Delay</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);t.b("</thead>");t.b("\n" + i);t.b("<tbody>");t.b("\n" + i);if(t.s(t.f("servers",c,p,1),c,p,0,560,741,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<tr class=\"");t.b(t.v(t.f("row_class",c,p,0)));t.b("\">");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("name",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("ip",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("serial",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("updated_p",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");if(t.s(t.f("error",c,p,1),c,p,0,679,688,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.f("error",c,p,0)));});c.pop();}if(!t.s(t.f("error",c,p,1),c,p,1,0,0,"")){t.b(t.v(t.f("delay_p",c,p,0)));};t.b("</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);});c.pop();}t.b("</tbody>");t.b("\n" + i);t.b("</table>");t.b("\n" + i);if(t.s(t.f("has_changes",c,p,1),c,p,0,788,1172,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<table class=\"table table-condensed\">");t.b("\n" + i);t.b("<thead>");t.b("\n" + i);t.b("<tr>");t.b("\n" + i);t.b("    <td style=\"width: 100px\">Serial</td>");t.b("\n" + i);t.b("    <td style=\"width: 100px\">First seen</td>");t.b("\n" + i);t.b("    <td style=\"width: 120px\">First server</td>");t.b("\n" + i);t.b("    <td>Propagation</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);t.b("</thead>");t.b("\n" + i);t.b("<tbody>");t.b("\n" + i);if(t.s(t.f("changes",c,p,1),c,p,0,1033,1141,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<tr>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("serial",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("first_seen_p",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("first_server",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("duration_p",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("</tr>");t.b("\n" + i);});c.pop();}t.b("</tbody>");t.b("\n" + i);t.b("</table>");t.b("\n" + i);});c.pop();}});c.pop();}return t.fl(); },partials: {}, subs: {  }});
+templates["server"] = new Hogan.Template({code: function (c,p,i) { var t=this;t.b(i=i||"");t.b("<tr>");t.b("\n" + i);if(t.s(t.f("server",c,p,1),c,p,0,16,1425,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<td><span style=\"background-color:rgb(");t.b(t.v(t.f("color",c,p,0)));t.b(")\">&nbsp;</span> <span rel=\"tooltip\" title=\"");if(t.s(t.f("names",c,p,1),c,p,0,118,127,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.f("name",c,p,0)));t.b(" ");});c.pop();}t.b("\">");t.b(t.v(t.f("name",c,p,0)));t.b("</span></td>");t.b("\n");t.b("\n" + i);t.b("<td>");if(t.s(t.f("addresses",c,p,1),c,p,0,179,200,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.f("connection_id",c,p,0)));t.b("<br>");});c.pop();}t.b("</td>");t.b("\n");t.b("\n" + i);t.b("<td>");if(t.s(t.f("addresses",c,p,1),c,p,0,239,439,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"ip\">");t.b("\n" + i);t.b("<a href=\"http://");t.b(t.v(t.f("ip",c,p,0)));t.b(":");t.b(t.v(t.f("port",c,p,0)));t.b("/status\">");t.b(t.v(t.f("ip",c,p,0)));t.b("</a>");t.b("\n" + i);if(t.s(t.f("family_label",c,p,1),c,p,0,325,410,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"label ");t.b(t.v(t.f("family_class",c,p,0)));t.b("\" title=\"");t.b(t.v(t.f("family_title",c,p,0)));t.b("\">");t.b(t.v(t.f("family_label",c,p,0)));t.b("</span>");});c.pop();}t.b("\n" + i);t.b("</span><br>");});c.pop();}t.b("\n" + i);t.b("</td>");t.b("\n");t.b("\n" + i);t.b("<td class=\"");t.b(t.v(t.f("qps_class",c,p,0)));t.b("\">");t.b("\n" + i);t.b("    ");if(t.s(t.f("qps",c,p,1),c,p,0,500,511,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.f("qps",c,p,0)));t.b("/qps");});c.pop();}t.b("\n" + i);t.b("</td>");t.b("\n");t.b("\n" + i);t.b("<td>");t.b("\n" + i);t.b("	");if(t.s(t.f("qps1m",c,p,1),c,p,0,543,556,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.f("qps1m",c,p,0)));t.b("/qps");});c.pop();}t.b("\n" + i);t.b("</td>");t.b("\n");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("version",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td><small>");if(t.s(t.f("groups",c,p,1),c,p,0,617,623,"{{ }}")){t.rs(c,p,function(c,p,t){t.b(t.v(t.d(".",c,p,0)));t.b(" ");});c.pop();}t.b("</small></td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("uptime_p",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");t.b(t.v(t.f("last_update",c,p,0)));t.b("</td>");t.b("\n" + i);t.b("<td>");if(t.s(t.f("addresses",c,p,1),c,p,0,713,792,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"");t.b(t.v(t.f("response_time_class",c,p,0)));t.b("\" title=\"");t.b(t.v(t.f("dns_status",c,p,0)));t.b("\">");t.b(t.v(t.f("dns",c,p,0)));t.b("</span><br>");});c.pop();}t.b("</td>");t.b("\n" + i);t.b("<td>");if(t.s(t.f("addresses",c,p,1),c,p,0,830,1404,"{{ }}")){t.rs(c,p,function(c,p,t){if(t.s(t.f("pinned",c,p,1),c,p,0,841,935,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"label label-info\" title=\"kept even when discovery doesn't find it\">pinned</span> ");});c.pop();}if(t.s(t.f("pending_removal",c,p,1),c,p,0,966,1081,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"label label-important\" title=\"not found by the last ");t.b(t.v(t.f("missed_rounds",c,p,0)));t.b(" discovery runs\">removing</span> ");});c.pop();}if(t.s(t.f("stale",c,p,1),c,p,0,1111,1209,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"label label-warning\" title=\"not heard from since the monitor restarted\">stale</span> ");});c.pop();}if(t.s(t.f("state_label",c,p,1),c,p,0,1235,1302,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("<span class=\"label\" title=\"");t.b(t.v(t.f("state_title",c,p,0)));t.b("\">");t.b(t.v(t.f("state_label",c,p,0)));t.b("</span> ");});c.pop();}t.b(t.v(t.f("status",c,p,0)));t.b(" <a href=\"#\" class=\"details\" data-ip=\"");t.b(t.v(t.f("ip",c,p,0)));t.b("\"><small>details</small></a><br>");});c.pop();}t.b("</td>");t.b("\n");t.b("\n" + i);});c.pop();}t.b("</tr>");return t.fl(); },partials: {}, subs: {  }});
 templates["summary"] = new Hogan.Template({code: function (c,p,i) { var t=this;t.b(i=i||"");if(t.s(t.f("summary",c,p,1),c,p,0,12,88,"{{ }}")){t.rs(c,p,function(c,p,t){t.b("    <span class=\"btn btn-info btn-large\">");t.b(t.v(t.f("qps",c,p,0)));t.b(" queries per second</span>");t.b("\n" + i);});c.pop();}return t.fl(); },partials: {}, subs: {  }});
@@ -8,19 +8,57 @@ import (
 )
 
 type Status struct {
-	Name             string    `json:"name"`
-	Names            []string  `json:"names"`
-	Groups           []string  `json:"groups"`
-	IP               string    `json:"ip"`
-	UUID             string    `json:"uuid"`
-	Version          string    `json:"version"`
-	Queries          int64     `json:"queries"`
-	Qps              float64   `json:"qps"`
-	Qps1             float64   `json:"qps1m"`
-	Uptime           int64     `json:"uptime"`
-	Status           string    `json:"status"`
+	Name    string   `json:"name"`
+	Names   []string `json:"names"`
+	Groups  []string `json:"groups"`
+	IP      string   `json:"ip"`
+	Family  string   `json:"family"`
+	Port    int      `json:"port"`
+	UUID    string   `json:"uuid"`
+	Version string   `json:"version"`
+	Queries int64    `json:"queries"`
+	// TotalQueries is the query count across restarts; Restarts is
+	// the number of restarts and counter resets seen.
+	TotalQueries int64      `json:"total_queries"`
+	Restarts     int        `json:"restarts"`
+	LastRestart  *time.Time `json:"last_restart,omitempty"`
+	Qps          float64    `json:"qps"`
+	Qps1         float64    `json:"qps1m"`
+	Uptime       int64      `json:"uptime"`
+	Status       string     `json:"status"`
+	Stale        bool       `json:"stale"`
+	// State is where the connection is; Status says why it isn't
+	// streaming. NextRetry is set in the backoff state.
+	State     ConnState  `json:"state"`
+	NextRetry *time.Time `json:"next_retry,omitempty"`
+	// Generation is the hub snapshot in which the status last
+	// changed.
+	Generation       uint64    `json:"generation"`
+	LastSeen         time.Time `json:"last_seen"`
+	// LastStatusUpdate is the time of the last update with data.
 	LastStatusUpdate time.Time `json:"-"`
 
+	Sources []Provenance `json:"sources"`
+
+	// Pinned servers are kept when discovery doesn't find them;
+	// others are pending removal until the grace period is over.
+	Pinned         bool       `json:"pinned"`
+	PendingRemoval bool       `json:"pending_removal"`
+	MissedRounds   int        `json:"missed_rounds"`
+	RemoveAt       *time.Time `json:"remove_at,omitempty"`
+
+	revision     int
+	missingSince time.Time
+	manualPin    bool
+	started      int
+	queryBase    int64
+
+	ResponseTime float64       `json:"response_time"`
+	DNSStatus    string        `json:"dns_status"`
+	Probes       []ProbeResult `json:"probes"`
+
+	Session SessionStats `json:"session"`
+
 	Connection *ServerConnection
 
 	Data ServerUpdate
@@ -28,30 +66,96 @@ type Status struct {
 
 type statusMap map[int]*Status
 
+// connectionStopTimeout is how long the hub waits for the server
+// connections to close when it's stopped.
+const connectionStopTimeout = 5 * time.Second
+
+// serverTarget is a request to monitor the server at IP.
+type serverTarget struct {
+	IP       net.IP
+	Endpoint Endpoint
+	Source   Provenance
+}
+
 type StatusHub struct {
 	statusUpdates chan *ServerUpdate
 	statusMsgChan chan *ServerStatusMsg
-	addServerChan chan net.IP
+	probeResults  chan *ProbeReport
+	addServerChan chan *serverTarget
 	nextServerID  chan int
 	serverStatus  statusMap
-	statuses      chan statusMap
+	snapshots     *snapshotHolder
+	changed       map[string]*Status
+	removed       map[string]bool
+	syncRequests  chan chan bool
 	remove        chan string
 	quit          chan bool
-
-	configRevision int
-	configManager  chan bool
+	done          chan bool
+
+	clients     map[*streamClient]bool
+	subscribe   chan *streamClient
+	unsubscribe chan *streamClient
+
+	sinks   []SeriesSink
+	addSink chan SeriesSink
+	history *SeriesStore
+	alerts  *AlertEngine
+	config  *ConfigManager
+
+	consistency *ConsistencyChecker
+	serials     *SerialTracker
+	discovery   *DiscoveryTracker
+	restarts    *RestartLog
+
+	probes        *probeConfig
+	connection    *connectionConfig
+	family        *familyConfig
+	removal       *removalConfig
+	resolver      *resolverHolder
+	state         *StateStore
+	restore       chan []*savedServer
+	stateRequests chan chan []*savedServer
+	pinRequests   chan *pinRequest
+
+	configRevision  int
+	configManager   chan bool
+	failedDiscovery chan map[string]bool
+	// failedSources are the discoverers that failed in this
+	// configuration run
+	failedSources map[string]bool
 }
 
 func NewHub() *StatusHub {
 	hub := new(StatusHub)
 	hub.statusUpdates = make(chan *ServerUpdate, 10)
 	hub.statusMsgChan = make(chan *ServerStatusMsg, 10)
-	hub.addServerChan = make(chan net.IP)
-	hub.statuses = make(chan statusMap)
+	hub.probeResults = make(chan *ProbeReport, 10)
+	hub.probes = new(probeConfig)
+	hub.connection = new(connectionConfig)
+	hub.family = new(familyConfig)
+	hub.removal = new(removalConfig)
+	hub.discovery = NewDiscoveryTracker()
+	hub.restarts = NewRestartLog()
+	hub.resolver = new(resolverHolder)
+	hub.addServerChan = make(chan *serverTarget)
+	hub.snapshots = new(snapshotHolder)
+	hub.snapshots.Set(newSnapshot())
+	hub.changed = make(map[string]*Status)
+	hub.removed = make(map[string]bool)
+	hub.syncRequests = make(chan chan bool)
 	hub.quit = make(chan bool, 1)
+	hub.done = make(chan bool)
+	hub.clients = make(map[*streamClient]bool)
+	hub.subscribe = make(chan *streamClient)
+	hub.unsubscribe = make(chan *streamClient)
 	hub.serverStatus = make(statusMap)
 	hub.nextServerID = make(chan int)
 	hub.configManager = make(chan bool)
+	hub.failedDiscovery = make(chan map[string]bool)
+	hub.addSink = make(chan SeriesSink)
+	hub.restore = make(chan []*savedServer)
+	hub.stateRequests = make(chan chan []*savedServer)
+	hub.pinRequests = make(chan *pinRequest)
 	go hub.makeServerID()
 	go hub.arbiter()
 	return hub
@@ -61,8 +165,165 @@ func (s *StatusHub) MarkConfigurationStart() {
 	s.configManager <- false
 }
 
+// MarkDiscoveryFailed gives the discoverers (by their configuration
+// line) that failed in this configuration run. The servers only they
+// had found aren't counted as missing.
+func (s *StatusHub) MarkDiscoveryFailed(configs []string) {
+	failed := make(map[string]bool)
+	for _, config := range configs {
+		failed[config] = true
+	}
+	s.failedDiscovery <- failed
+}
+
+// MarkConfigurationEnd removes the servers that have been missing
+// long enough; they're gone from the snapshot when it returns.
 func (s *StatusHub) MarkConfigurationEnd() {
 	s.configManager <- true
+	s.sync()
+}
+
+// AddSink registers a sink that will get a Sample for every status
+// update received from a server.
+func (s *StatusHub) AddSink(sink SeriesSink) {
+	s.addSink <- sink
+}
+
+// SetHistory registers the series store as a sink and makes it
+// available for queries.
+func (s *StatusHub) SetHistory(store *SeriesStore) {
+	s.history = store
+	s.AddSink(store)
+}
+
+// History returns the series store or nil if history isn't enabled.
+func (s *StatusHub) History() *SeriesStore {
+	return s.history
+}
+
+// SetAlerts makes the alert engine available to the API.
+func (s *StatusHub) SetAlerts(alerts *AlertEngine) {
+	s.alerts = alerts
+}
+
+// Alerts returns the alert engine or nil if it isn't running.
+func (s *StatusHub) Alerts() *AlertEngine {
+	return s.alerts
+}
+
+// SetConfigManager makes the configuration status available to the
+// API.
+func (s *StatusHub) SetConfigManager(cm *ConfigManager) {
+	s.config = cm
+}
+
+// ConfigManager returns the configuration manager, if any.
+func (s *StatusHub) ConfigManager() *ConfigManager {
+	return s.config
+}
+
+// SetConsistency makes the consistency checker available to the API.
+func (s *StatusHub) SetConsistency(cc *ConsistencyChecker) {
+	s.consistency = cc
+}
+
+// Consistency returns the consistency checker or nil if it isn't
+// running.
+func (s *StatusHub) Consistency() *ConsistencyChecker {
+	return s.consistency
+}
+
+// SetSerials makes the SOA serial tracking available to the API.
+func (s *StatusHub) SetSerials(t *SerialTracker) {
+	s.serials = t
+}
+
+// Serials returns the serial tracker or nil if it isn't running.
+func (s *StatusHub) Serials() *SerialTracker {
+	return s.serials
+}
+
+// Restarts returns the restarts seen for each server.
+func (s *StatusHub) Restarts() *RestartLog {
+	return s.restarts
+}
+
+// Discovery returns the results of the server discovery.
+func (s *StatusHub) Discovery() *DiscoveryTracker {
+	return s.discovery
+}
+
+// SetProbeSettings changes the DNS queries sent to the servers.
+func (s *StatusHub) SetProbeSettings(ps *ProbeSettings) {
+	s.probes.Set(ps)
+}
+
+// SetConnectionSettings changes the timeouts and retry delays of the
+// server connections.
+func (s *StatusHub) SetConnectionSettings(cs *ConnectionSettings) {
+	s.connection.Set(cs)
+}
+
+// SetFamily chooses the address families names are resolved to.
+// Servers already monitored over another family are removed like
+// other servers discovery doesn't find anymore.
+func (s *StatusHub) SetFamily(f Family) {
+	s.family.Set(f)
+}
+
+// SetRemoval sets when servers discovery doesn't find anymore are
+// removed and which are pinned.
+func (s *StatusHub) SetRemoval(rs *RemovalSettings) {
+	s.removal.Set(rs)
+}
+
+// Pin keeps the server at ip from being removed when discovery
+// doesn't find it; unpinning lets it be removed again. It returns
+// the server's status, or nil if there's no such server.
+func (s *StatusHub) Pin(ip string, pinned bool) *Status {
+	req := &pinRequest{IP: ip, Pinned: pinned, result: make(chan *Status, 1)}
+	select {
+	case s.pinRequests <- req:
+		return <-req.result
+	case <-s.done:
+		return nil
+	}
+}
+
+// SetResolver sets the resolver used for discovery.
+func (s *StatusHub) SetResolver(r Resolver) {
+	s.resolver.Set(r)
+}
+
+// Resolver returns the resolver used for discovery.
+func (s *StatusHub) Resolver() Resolver {
+	return s.resolver.Resolver()
+}
+
+// SetStateStore makes the hub save its state to the store when it's
+// stopped.
+func (s *StatusHub) SetStateStore(ss *StateStore) {
+	s.state = ss
+}
+
+// Restore adds the servers remembered from the previous run. They
+// are marked stale until they're heard from again, and forgotten if
+// the next discovery doesn't find them.
+func (s *StatusHub) Restore(servers []*savedServer) {
+	s.restore <- servers
+	s.sync()
+}
+
+// SavedServers returns what should be remembered about the servers,
+// or nil if the hub has stopped.
+func (s *StatusHub) SavedServers() []*savedServer {
+	req := make(chan []*savedServer, 1)
+	select {
+	case s.stateRequests <- req:
+		return <-req
+	case <-s.done:
+		return nil
+	}
 }
 
 func (s *StatusHub) makeServerID() int {
@@ -77,67 +338,164 @@ func (s *StatusHub) makeServerID() int {
 func (s *StatusHub) arbiter() {
 	log.Println("running arbiter")
 	for {
+		// publish what the last message changed before waiting
+		// for the next one
+		s.commit()
+
 		select {
 		case new := <-s.statusUpdates:
 			// log.Println("Adding status for", new.IP)
 			srv, ok := s.serverStatus[new.ConnID]
 			if ok {
 				if len(new.UUID) > 0 {
-					if dupeID := s.FindUUID(new.UUID); dupeID > 0 && dupeID != new.ConnID {
+					// the same server over IPv4 and IPv6 isn't a
+					// duplicate
+					if dupeID := s.findUUIDFamily(new.UUID, srv.Family, new.ConnID); dupeID > 0 {
 						log.Printf("Duplicate connection to %s (uuid %s); this is %d, dupe is %d", new.IP, new.UUID, new.ConnID, dupeID)
 
-						// try keeping the connection that's the one reported by the server
-						if srv.Connection.IP.String() != new.IP {
-							dupeID = new.ConnID
+						if s.serverStatus[dupeID].Connection == nil {
+							// remembered from the last run, but
+							// now found at another address
+							s.restarts.Move(s.serverStatus[dupeID].IP, srv.IP)
+							s.removeServer(dupeID)
+						} else {
+							// try keeping the connection that's the one reported by the server
+							keepID := dupeID
+							if srv.Connection.IP.String() != new.IP {
+								dupeID, keepID = new.ConnID, dupeID
+							}
+							s.restarts.Move(s.serverStatus[dupeID].IP, s.serverStatus[keepID].IP)
+							s.removeServer(dupeID)
+							continue
 						}
-						s.serverStatus[dupeID].Connection.Stop()
-						delete(s.serverStatus, dupeID)
-						continue
 					}
 				}
 
-				updateStatus(srv, new)
+				if ev := updateStatus(srv, new); ev != nil {
+					log.Printf("Server %s (%s) restarted: %s", srv.IP, srv.Name, ev.Detail)
+					s.restarts.Record(ev)
+				}
+				srv.updateSession()
+				if new.Uptime > 0 {
+					s.record(srv)
+				}
+				s.statusChanged(srv)
+				s.publishUpdate(srv)
 			} else {
 				log.Printf("got status update for unknown connection %d (ip %s)", new.ConnID, new.IP)
 			}
 
-			// TODO: push to seriesly
+		case report := <-s.probeResults:
+			srv, ok := s.serverStatus[report.ConnID]
+			if ok {
+				srv.setProbes(report.Results)
+				s.statusChanged(srv)
+				s.publishUpdate(srv)
+			}
+
+		case sink := <-s.addSink:
+			s.sinks = append(s.sinks, sink)
 
 		case msg := <-s.statusMsgChan:
 			// log.Printf("Got StatusMsg from '%d': %s\n", msg.ConnID, msg.Status)
 			srv, ok := s.serverStatus[msg.ConnID]
 			if ok {
-				srv.Status = msg.Status
+				srv.updateSession()
+			}
+			if ok && srv.setConnState(msg) {
+				s.statusChanged(srv)
+				s.publishUpdate(srv)
+			}
+
+		case cl := <-s.subscribe:
+			s.clients[cl] = true
+			cl.send <- s.snapshot()
+
+		case cl := <-s.unsubscribe:
+			if s.clients[cl] {
+				delete(s.clients, cl)
+				close(cl.send)
+			}
+
+		case ch := <-s.syncRequests:
+			close(ch)
+
+		case servers := <-s.restore:
+			for _, saved := range servers {
+				if s.findIP(saved.IP) > 0 {
+					continue
+				}
+				connID := <-s.nextServerID
+				status := saved.status()
+				status.revision = s.configRevision
+				s.restarts.restore(saved.IP, saved.RestartLog)
+				s.serverStatus[connID] = status
+				s.statusChanged(status)
 			}
 
-		case s.statuses <- s.serverStatus:
+		case req := <-s.stateRequests:
+			req <- s.savedServers()
+
+		case req := <-s.pinRequests:
+			connID := s.findIP(req.IP)
+			if connID == 0 {
+				req.result <- nil
+				continue
+			}
+			srv := s.serverStatus[connID]
+			srv.manualPin = req.Pinned
+			srv.Pinned = srv.manualPin || s.removal.Settings().pinned(srv)
+			if srv.Pinned {
+				srv.found(srv.revision)
+			}
+			s.statusChanged(srv)
+			s.publishUpdate(srv)
+			req.result <- srv.clone()
 
 		case cm := <-s.configManager:
 			switch cm {
 			case false:
 				s.configRevision++
+				s.failedSources = nil
 			case true:
-				for connID, srv := range s.serverStatus {
-					if srv.Connection.configRevision < s.configRevision {
-						log.Printf("Server %s has an old config revision, disconnecting %d", srv.IP, connID)
-						srv.Connection.Stop()
-						delete(s.serverStatus, connID)
-					}
-				}
+				s.expireServers(time.Now())
 			}
 
-		case ip := <-s.addServerChan:
+		case failed := <-s.failedDiscovery:
+			s.failedSources = failed
+
+		case target := <-s.addServerChan:
+			ip := target.IP
+			target.Source.revision = s.configRevision
 
 			log.Println("Adding monitoring of", ip)
 
 			foundDuplicate := false
-			for _, server := range s.serverStatus {
-				if server.IP == ip.String() {
-					foundDuplicate = true
-					log.Printf("Already monitoring '%s'\n", ip.String())
-					server.Connection.configRevision = s.configRevision
+			restoredID := 0
+			for connID, server := range s.serverStatus {
+				if server.IP != ip.String() {
+					continue
+				}
+				if server.Connection == nil {
+					restoredID = connID
+					break
+				}
+				if server.Connection.Endpoint != target.Endpoint {
+					log.Printf("Monitor endpoint for '%s' changed, reconnecting", ip)
+					s.removeServer(connID)
 					break
 				}
+				foundDuplicate = true
+				log.Printf("Already monitoring '%s'\n", ip.String())
+				wasPending := server.PendingRemoval
+				server.found(s.configRevision)
+				server.addSource(target.Source)
+				s.statusChanged(server)
+				if wasPending {
+					log.Printf("Server %s was found again, no longer removing it", ip)
+					s.publishUpdate(server)
+				}
+				break
 			}
 			if foundDuplicate {
 				continue
@@ -145,29 +503,64 @@ func (s *StatusHub) arbiter() {
 
 			log.Printf("Creating new connection for %s", ip)
 
-			sc := NewServerConnection(ip, s.statusUpdates, s.statusMsgChan)
-			sc.configRevision = s.configRevision
+			sc := NewServerConnection(ip, target.Endpoint, s.statusUpdates, s.statusMsgChan)
+			sc.probes = s.probes
+			sc.connection = s.connection
+			sc.probeChan = s.probeResults
 
 			log.Printf("Start() on %s", sc.IP)
 
-			connID := <-s.nextServerID
+			// keep what was known about a server from the last run
+			connID, status := restoredID, s.serverStatus[restoredID]
+			if status == nil {
+				connID = <-s.nextServerID
+				status = new(Status)
+				status.IP = ip.String()
+				status.Family = ipFamily(status.IP)
+				s.serverStatus[connID] = status
+			}
 
 			log.Println("got server id", connID)
 
-			status := new(Status)
-			status.IP = ip.String()
+			status.Port = target.Endpoint.Port
 			status.Connection = sc
-			s.serverStatus[connID] = status
+			status.found(s.configRevision)
+			status.addSource(target.Source)
+			s.statusChanged(status)
 
 			sc.Start(connID)
 
 		case <-s.quit:
 			log.Printf("StatusHub got quit!\n")
+			if s.state != nil {
+				err := s.state.Close(s.savedServers())
+				if err != nil {
+					log.Printf("Could not save state: %s", err)
+				}
+			}
+			conns := []*ServerConnection{}
 			for connID, srv := range s.serverStatus {
-				log.Printf("Sending quit to %d (%s)\n", connID, srv.IP)
-				srv.Connection.Stop()
+				if srv.Connection != nil {
+					log.Printf("Sending quit to %d (%s)\n", connID, srv.IP)
+					srv.Connection.Stop()
+					conns = append(conns, srv.Connection)
+				}
+				s.statusRemoved(srv.IP)
 				delete(s.serverStatus, connID)
 			}
+			s.commit()
+			s.waitConnections(conns, connectionStopTimeout)
+			for _, sink := range s.sinks {
+				err := sink.Close()
+				if err != nil {
+					log.Printf("Error closing sink: %s", err)
+				}
+			}
+			for cl := range s.clients {
+				delete(s.clients, cl)
+				close(cl.send)
+			}
+			close(s.done)
 			// TODO: do we need to close the channels?
 			log.Println("Arbiter done")
 			return
@@ -175,6 +568,130 @@ func (s *StatusHub) arbiter() {
 	}
 }
 
+// expireServers handles the end of a configuration run: servers it
+// didn't find are pending removal until they've been missing for the
+// grace period, unless they're pinned. Servers that only failed
+// discoverers had found keep the rounds they had missed.
+func (s *StatusHub) expireServers(now time.Time) {
+	rs := s.removal.Settings()
+	for connID, srv := range s.serverStatus {
+		old := srv.removalState()
+		if s.expireServer(connID, srv, rs, now) && srv.removalState() != old {
+			s.statusChanged(srv)
+		}
+	}
+}
+
+// expireServer updates the removal state of a server after a
+// configuration run. It returns false if the server was removed.
+func (s *StatusHub) expireServer(connID int, srv *Status, rs *RemovalSettings, now time.Time) bool {
+	srv.Pinned = srv.manualPin || rs.pinned(srv)
+	if srv.revision >= s.configRevision {
+			srv.expireSources(s.configRevision, s.failedSources)
+		return true
+	}
+	if srv.onlyFailedSources(s.failedSources) {
+		log.Printf("Server %s was only found by discoverers that failed, keeping it", srv.IP)
+		srv.revision = s.configRevision - srv.MissedRounds
+		return true
+	}
+	if srv.Pinned {
+		if srv.PendingRemoval {
+			srv.found(srv.revision)
+			s.publishUpdate(srv)
+		}
+		return true
+	}
+	if srv.missingSince.IsZero() {
+		srv.missingSince = now
+	}
+	srv.MissedRounds = s.configRevision - srv.revision
+	if rs.expired(srv.MissedRounds, srv.missingSince, now) {
+		log.Printf("Server %s wasn't found by the last %d configuration runs, disconnecting %d", srv.IP, srv.MissedRounds, connID)
+		s.removeServer(connID)
+		s.restarts.Forget(srv.IP)
+		return false
+	}
+	srv.PendingRemoval = true
+	srv.RemoveAt = nil
+	if rs.Rounds == 0 {
+		removeAt := srv.missingSince.Add(rs.Grace)
+		srv.RemoveAt = &removeAt
+	}
+	log.Printf("Server %s wasn't found by the last %d configuration runs, pending removal", srv.IP, srv.MissedRounds)
+	s.publishUpdate(srv)
+	return true
+}
+
+// removeServer stops monitoring the server and forgets about it.
+// The restart log is kept, as the server might be added again.
+func (s *StatusHub) removeServer(connID int) {
+	srv := s.serverStatus[connID]
+	if srv.Connection != nil {
+		srv.Connection.Stop()
+	}
+	s.statusRemoved(srv.IP)
+	s.publishRemove(srv.IP)
+	delete(s.serverStatus, connID)
+}
+
+// statusChanged marks the status to be copied into the next
+// snapshot. It must only be called from the arbiter.
+func (s *StatusHub) statusChanged(srv *Status) {
+	s.changed[srv.IP] = srv
+	delete(s.removed, srv.IP)
+}
+
+// statusRemoved marks the server as gone in the next snapshot.
+func (s *StatusHub) statusRemoved(ip string) {
+	s.removed[ip] = true
+	delete(s.changed, ip)
+}
+
+// commit publishes a snapshot with the changes since the last one,
+// if there are any. It must only be called from the arbiter.
+func (s *StatusHub) commit() {
+	if len(s.changed) == 0 && len(s.removed) == 0 {
+		return
+	}
+	s.snapshots.Set(s.snapshots.Snapshot().next(s.changed, s.removed))
+	s.changed = make(map[string]*Status)
+	s.removed = make(map[string]bool)
+}
+
+// sync waits until the arbiter has published the changes from the
+// messages sent to it before.
+func (s *StatusHub) sync() {
+	ch := make(chan bool)
+	select {
+	case s.syncRequests <- ch:
+		<-ch
+	case <-s.done:
+	}
+}
+
+func (s *StatusHub) findIP(ip string) int {
+	for connID, server := range s.serverStatus {
+		if server.IP == ip {
+			return connID
+		}
+	}
+	return 0
+}
+
+// savedServers must only be called from the arbiter.
+func (s *StatusHub) savedServers() []*savedServer {
+	servers := []*savedServer{}
+	for _, st := range s.serverStatus {
+		if !st.LastSeen.IsZero() {
+			saved := newSavedServer(st)
+			saved.RestartLog = s.restarts.saved(st.IP)
+			servers = append(servers, saved)
+		}
+	}
+	return servers
+}
+
 func (s *StatusHub) FindUUID(UUID string) int {
 	for connID, server := range s.serverStatus {
 		if server.UUID == UUID {
@@ -184,9 +701,67 @@ func (s *StatusHub) FindUUID(UUID string) int {
 	return 0
 }
 
-func updateStatus(srv *Status, new *ServerUpdate) {
+// findUUIDFamily returns another server with the UUID on the same
+// address family, if there is one.
+func (s *StatusHub) findUUIDFamily(UUID, family string, except int) int {
+	for connID, server := range s.serverStatus {
+		if connID != except && server.UUID == UUID && server.Family == family {
+			return connID
+		}
+	}
+	return 0
+}
+
+// waitConnections waits for the stopped connections to finish, while
+// throwing away their last messages so they don't block.
+func (s *StatusHub) waitConnections(conns []*ServerConnection, timeout time.Duration) {
+	deadline := time.After(timeout)
+	for _, sc := range conns {
+		for waiting := true; waiting; {
+			select {
+			case <-sc.Done():
+				waiting = false
+			case <-s.statusUpdates:
+			case <-s.statusMsgChan:
+			case <-s.probeResults:
+			case <-deadline:
+				log.Printf("Timed out waiting for %d connections to close", len(conns))
+				return
+			}
+		}
+	}
+}
+
+func (s *StatusHub) record(srv *Status) {
+	if len(s.sinks) == 0 {
+		return
+	}
+	sample := &Sample{
+		Time:    srv.LastStatusUpdate,
+		UUID:    srv.UUID,
+		IP:      srv.IP,
+		Queries: srv.TotalQueries,
+		Qps:     srv.Qps,
+		Qps1:    srv.Qps1,
+		Uptime:  srv.Uptime,
+	}
+	for _, sink := range s.sinks {
+		sink.Record(sample)
+	}
+}
+
+// updateStatus applies an update from the server's connection and
+// returns the restart it shows, if any.
+func updateStatus(srv *Status, new *ServerUpdate) *RestartEvent {
 	srv.Data = *new
-	srv.LastStatusUpdate = time.Now()
+
+	// the empty updates sent when the connection fails don't make
+	// the status any newer
+	var restart *RestartEvent
+	if new.hasData() {
+		srv.LastStatusUpdate = time.Now()
+		restart = srv.updateCounters(new, srv.LastStatusUpdate)
+	}
 
 	if len(new.Version) > 0 {
 		srv.Version = new.Version
@@ -202,66 +777,92 @@ func updateStatus(srv *Status, new *ServerUpdate) {
 
 	if new.Uptime > 0 {
 		srv.Uptime = new.Uptime
+		srv.LastSeen = srv.LastStatusUpdate
+		srv.Stale = false
 	}
 
 	srv.Qps = new.Qps
-	srv.Queries = new.Queries
 
 	if new.Qps1 > 0 {
 		srv.Qps1 = new.Qps1
 	}
 
-	if len(new.Hostname) > 0 {
-		// This needs to accumulate the various names that have been
-		// discovered for this server, maybe.
-		srv.Names = []string{new.Hostname}
-	}
+	srv.addName(new.Hostname)
 
 	if len(new.Groups) > 0 {
 		srv.Groups = new.Groups
 	}
 
+	return restart
 }
 
+// Snapshot returns the latest state of the hub. It doesn't wait for
+// the arbiter.
+func (s *StatusHub) Snapshot() *Snapshot {
+	return s.snapshots.Snapshot()
+}
+
+// Status returns the servers in the latest snapshot, by IP. The
+// statuses must not be modified.
 func (s *StatusHub) Status() []*Status {
-	current := <-s.statuses
-	rv := make([]*Status, 0)
-	for _, status := range current {
-		// log.Printf("Status for '%name': %#v\n", name, status)
-		if !status.LastStatusUpdate.IsZero() || len(status.Status) > 0 {
-			rv = append(rv, status)
-		}
-	}
-	return rv
+	return s.Snapshot().Statuses()
 }
 
+// Stop closes all the server connections and sinks and waits for
+// the hub to finish.
 func (s *StatusHub) Stop() {
-	s.quit <- true
+	select {
+	case s.quit <- true:
+	case <-s.done:
+	}
+	<-s.done
 }
 
-func (s *StatusHub) addIP(ip net.IP) error {
-	s.addServerChan <- ip
+// QueueDepth returns the number of messages waiting for the arbiter.
+func (s *StatusHub) QueueDepth() int {
+	return len(s.statusUpdates) + len(s.statusMsgChan) + len(s.probeResults)
+}
+
+func (s *StatusHub) addIP(ip net.IP, ep Endpoint, src Provenance) error {
+	s.addServerChan <- &serverTarget{IP: ip, Endpoint: ep, Source: src}
 	return nil
 }
 
-func (s *StatusHub) AddNameBackground(ipstr string, ch chan error) {
+func (s *StatusHub) AddNameBackground(ipstr string, ep Endpoint, src Provenance, ch chan error) {
 	go func() {
-		err := s.AddName(ipstr)
+		err := s.AddNameSource(ipstr, ep, src)
 		if err == nil {
 			ch <- err
 		} else {
-			ch <- fmt.Errorf("error adding server '%s': %s", ipstr, err)
+			ch <- &AddError{Host: ipstr, Source: src, Err: err}
 		}
 	}()
 }
 
+// AddName monitors the server(s) with the given name or IP on the
+// default monitor port.
 func (s *StatusHub) AddName(ipstr string) error {
+	return s.AddNameEndpoint(ipstr, defaultEndpoint)
+}
+
+// AddNameEndpoint monitors the server(s) with the given name or IP,
+// connecting to the monitor websocket at ep.
+func (s *StatusHub) AddNameEndpoint(ipstr string, ep Endpoint) error {
+	return s.AddNameSource(ipstr, ep, manualSource)
+}
+
+// AddNameSource is AddNameEndpoint for a server found by the
+// configuration entry in src.
+func (s *StatusHub) AddNameSource(ipstr string, ep Endpoint, src Provenance) error {
+	src.Resolved = time.Now()
 	ip := net.ParseIP(ipstr)
 	if ip != nil {
-		return s.addIP(ip)
+		return s.addIP(ip, ep, src)
 	}
+	src.Name = ipstr
 	// return fmt.Errorf("Could not parse IP: '%s'", ipstr)
-	addrs, err := net.LookupIP(ipstr)
+	family := s.family.Family()
+	addrs, err := s.Resolver().LookupIP(ipstr)
 	log.Printf("IP: %s, %#v %d\n", ipstr, addrs, len(addrs))
 	if err != nil || len(addrs) == 0 {
 		return fmt.Errorf("Could not lookup name: '%s': %s", ipstr, err)
@@ -271,12 +872,21 @@ func (s *StatusHub) AddName(ipstr string) error {
 		return fmt.Errorf("Could not find IPs for: '%s'\n", ipstr)
 	}
 
+	allowed := 0
 	for _, addr := range addrs {
+		if !family.Allows(addr) {
+			log.Printf("Skipping %s for '%s', only monitoring %s", addr, ipstr, family)
+			continue
+		}
+		allowed++
 		log.Println("Adding", addr)
-		err = s.addIP(addr)
+		err = s.addIP(addr, ep, src)
 		if err != nil {
 			log.Printf("Could not add '%s': %s\n", addr, err)
 		}
 	}
+	if allowed == 0 {
+		return fmt.Errorf("No addresses left for '%s' by the family filter, only monitoring %s", ipstr, family)
+	}
 	return nil
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamBuffer is how many messages can be queued for a stream client
+// before it's considered too slow and disconnected.
+const streamBuffer = 64
+
+// streamClient is a browser (or script) following /api/stream.
+type streamClient struct {
+	send chan []byte
+}
+
+type streamEvent struct {
+	Type    string                `json:"type"`
+	Server  *apiStatus            `json:"server,omitempty"`
+	IP      string                `json:"ip,omitempty"`
+	Servers map[string]*apiStatus `json:"servers,omitempty"`
+}
+
+// visible returns true if the status is one the API shows.
+func (st *Status) visible() bool {
+	return !st.LastStatusUpdate.IsZero() || len(st.Status) > 0
+}
+
+// snapshot must only be called from the arbiter.
+func (s *StatusHub) snapshot() []byte {
+	byIP := make(map[string]*apiStatus)
+	for _, st := range s.serverStatus {
+		if st.visible() {
+			byIP[st.IP] = newAPIStatus(st)
+		}
+	}
+	js, err := json.Marshal(&streamEvent{Type: "snapshot", Servers: byIP})
+	if err != nil {
+		log.Printf("Could not marshal snapshot: %s", err)
+	}
+	return js
+}
+
+// publish sends an event to all stream clients. Clients that can't
+// keep up are dropped. It must only be called from the arbiter.
+func (s *StatusHub) publish(ev *streamEvent) {
+	if len(s.clients) == 0 {
+		return
+	}
+	js, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("Could not marshal %s event: %s", ev.Type, err)
+		return
+	}
+	for cl := range s.clients {
+		select {
+		case cl.send <- js:
+		default:
+			log.Println("Dropping slow stream client")
+			delete(s.clients, cl)
+			close(cl.send)
+		}
+	}
+}
+
+func (s *StatusHub) publishUpdate(srv *Status) {
+	if len(s.clients) == 0 || !srv.visible() {
+		return
+	}
+	s.publish(&streamEvent{Type: "update", Server: newAPIStatus(srv)})
+}
+
+func (s *StatusHub) publishRemove(ip string) {
+	s.publish(&streamEvent{Type: "remove", IP: ip})
+}
+
+// Subscribe returns a client that will get a snapshot of all servers
+// followed by updates as they arrive. The send channel is closed if
+// the client is dropped or the hub stops.
+func (s *StatusHub) Subscribe() *streamClient {
+	cl := &streamClient{send: make(chan []byte, streamBuffer)}
+	select {
+	case s.subscribe <- cl:
+	case <-s.done:
+		close(cl.send)
+	}
+	return cl
+}
+
+// Unsubscribe removes the client from the hub.
+func (s *StatusHub) Unsubscribe(cl *streamClient) {
+	select {
+	case s.unsubscribe <- cl:
+	case <-s.done:
+	}
+}
+
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+func streamHandler(hub *StatusHub) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			streamWebSocket(hub, w, r)
+			return
+		}
+		streamEvents(hub, w, r)
+	}
+}
+
+func streamWebSocket(hub *StatusHub, w http.ResponseWriter, r *http.Request) {
+	ws, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Could not upgrade stream connection: %s", err)
+		return
+	}
+	defer ws.Close()
+
+	cl := hub.Subscribe()
+	defer hub.Unsubscribe(cl)
+
+	// We don't expect anything from the client, but need to read to
+	// notice when it goes away.
+	closed := make(chan bool)
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case msg, ok := <-cl.send:
+			if !ok {
+				return
+			}
+			ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			err := ws.WriteMessage(websocket.TextMessage, msg)
+			if err != nil {
+				return
+			}
+		case <-ping.C:
+			ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			err := ws.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func streamEvents(hub *StatusHub, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	cl := hub.Subscribe()
+	defer hub.Unsubscribe(cl)
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case msg, ok := <-cl.send:
+			if !ok {
+				return
+			}
+			_, err := fmt.Fprintf(w, "data: %s\n\n", msg)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			_, err := fmt.Fprint(w, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
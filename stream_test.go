@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "gopkg.in/check.v1"
+)
+
+type StreamSuite struct {
+	hub *StatusHub
+	srv *httptest.Server
+}
+
+var _ = Suite(&StreamSuite{})
+
+func (s *StreamSuite) SetUpSuite(c *C) {
+	s.hub = NewHub()
+	s.srv = httptest.NewServer(setupMux(s.hub))
+}
+
+func (s *StreamSuite) TearDownSuite(c *C) {
+	s.srv.Close()
+	s.hub.Stop()
+}
+
+func readStreamEvent(c *C, r *bufio.Reader) *streamEvent {
+	for {
+		line, err := r.ReadString('\n')
+		c.Assert(err, IsNil)
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		ev := new(streamEvent)
+		c.Assert(json.Unmarshal([]byte(line[6:]), ev), IsNil)
+		return ev
+	}
+}
+
+func (s *StreamSuite) TestEvents(c *C) {
+	res, err := http.Get(s.srv.URL + "/api/stream")
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	c.Check(res.Header.Get("Content-Type"), Equals, "text/event-stream")
+
+	r := bufio.NewReader(res.Body)
+	ev := readStreamEvent(c, r)
+	c.Check(ev.Type, Equals, "snapshot")
+
+	c.Assert(s.hub.AddName("127.0.0.3"), IsNil)
+
+	ev = readStreamEvent(c, r)
+	c.Check(ev.Type, Equals, "update")
+	c.Assert(ev.Server, NotNil)
+	c.Check(ev.Server.IP, Equals, "127.0.0.3")
+}
+
+func (s *StreamSuite) TestWebSocket(c *C) {
+	url := "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/api/stream"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	c.Assert(err, IsNil)
+	defer ws.Close()
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	ev := new(streamEvent)
+	c.Assert(ws.ReadJSON(ev), IsNil)
+	c.Check(ev.Type, Equals, "snapshot")
+}
+
+func (s *StreamSuite) TestSlowClient(c *C) {
+	hub := &StatusHub{clients: make(map[*streamClient]bool)}
+	slow := &streamClient{send: make(chan []byte, 1)}
+	fast := &streamClient{send: make(chan []byte, 10)}
+	hub.clients[slow] = true
+	hub.clients[fast] = true
+
+	hub.publishRemove("192.0.2.1")
+	hub.publishRemove("192.0.2.2")
+
+	c.Check(hub.clients, HasLen, 1)
+	c.Check(hub.clients[fast], Equals, true)
+	c.Check(fast.send, HasLen, 2)
+
+	_, ok := <-slow.send
+	c.Check(ok, Equals, true)
+	_, ok = <-slow.send
+	c.Check(ok, Equals, false)
+}